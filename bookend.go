@@ -0,0 +1,128 @@
+package pgverify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// Lists the estimated number of rows in each table, from the statistics
+// gathered by ANALYZE. Tables that have never been analyzed have an estimate of
+// zero or below.
+const getEstimatedRowCountsQuery = `
+	SELECT n.nspname, c.relname, c.reltuples::INT8
+	FROM pg_catalog.pg_class AS c
+		JOIN pg_catalog.pg_namespace AS n ON n.oid = c.relnamespace
+	WHERE c.relkind IN ('r', 'p')`
+
+// bookendAsFullTestMode hashes the whole table in place of the bookend test,
+// for tables small enough that the bookend windows would overlap.
+type bookendAsFullTestMode struct{ hashTestMode }
+
+func (bookendAsFullTestMode) BuildQuery(config Config, schemaName, tableName string, columns []Column, predicates []string) string {
+	return buildFullHashQuery(config, schemaName, tableName, columns, predicates)
+}
+
+// fetchSmallBookendTables returns the tables, as "schema.table", estimated to
+// have fewer than twice the bookend limit of rows on every target, so that the
+// first and last rows hashed by the bookend test overlap, along with the
+// largest estimate for each. Tables without an estimate on any target are not
+// included. The same tables are returned for every target, so that all
+// targets run the same test on them.
+func (c Config) fetchSmallBookendTables(ctx context.Context, conns []*pgx.Conn, targetNames []string) map[string]int64 {
+	targetEstimates := make([]map[string]int64, len(conns))
+
+	for i, conn := range conns {
+		logger := c.Logger.WithField("target", targetNames[i])
+		targetConfig := c.withTargetShardedTables(targetNames[i])
+
+		rows, err := conn.Query(ctx, getEstimatedRowCountsQuery)
+		if err != nil {
+			logger.WithError(wrapQueryError(err, getEstimatedRowCountsQuery)).Warn("Failed to estimate table row counts for the bookend test")
+
+			return nil
+		}
+
+		estimates := make(map[string]int64)
+		unestimated := make(map[string]bool)
+
+		for rows.Next() {
+			var schema, table pgtype.Text
+
+			var estimate int64
+			if err := rows.Scan(&schema, &table, &estimate); err != nil {
+				rows.Close()
+				logger.WithError(err).Warn("Failed to scan table row count estimates for the bookend test")
+
+				return nil
+			}
+
+			// The shards of a sharded table are estimated together, as the
+			// logical table they are verified as.
+			tableName := targetConfig.logicalTableName(schema.String, table.String)
+			name := qualifiedTableName(c.comparisonSchema(targetNames[i], schema.String), tableName)
+
+			if estimate <= 0 {
+				unestimated[name] = true
+
+				continue
+			}
+
+			estimates[name] += estimate
+		}
+
+		if err := rows.Err(); err != nil {
+			logger.WithError(err).Warn("Failed to estimate table row counts for the bookend test")
+
+			return nil
+		}
+
+		for name := range unestimated {
+			delete(estimates, name)
+		}
+
+		targetEstimates[i] = estimates
+	}
+
+	return c.selectSmallBookendTables(targetEstimates)
+}
+
+// selectSmallBookendTables returns the tables estimated to have fewer than twice the
+// bookend limit of rows by every target's estimates, along with the largest
+// estimate for each.
+func (c Config) selectSmallBookendTables(targetEstimates []map[string]int64) map[string]int64 {
+	smallCounts := make(map[string]int)
+	largest := make(map[string]int64)
+
+	for _, estimates := range targetEstimates {
+		for name, estimate := range estimates {
+			if estimate >= 2*int64(c.BookendLimit) {
+				continue
+			}
+
+			smallCounts[name]++
+
+			if estimate > largest[name] {
+				largest[name] = estimate
+			}
+		}
+	}
+
+	smallTables := make(map[string]int64)
+
+	for name, count := range smallCounts {
+		if count == len(targetEstimates) {
+			smallTables[name] = largest[name]
+		}
+	}
+
+	return smallTables
+}
+
+// smallBookendWarning describes a table too small for the bookend test to be
+// cheaper than hashing the whole table.
+func (c Config) smallBookendWarning(schemaName, tableName string, estimate int64) string {
+	return fmt.Sprintf("table %s.%s is estimated to have %d rows, fewer than twice the bookend limit of %d, so the bookend test hashes the whole table; consider the full test", schemaName, tableName, estimate, c.BookendLimit)
+}
@@ -0,0 +1,53 @@
+package pgverify
+
+import "time"
+
+// TableVerification describes the outcome of a single test run against a
+// table on a target, as passed to the table callback.
+type TableVerification struct {
+	Target string
+	// Engine is the engine and version of the target, e.g. "PostgreSQL 14.5"
+	// or "CockroachDB CCL v23.2.0".
+	Engine   string
+	Schema   string
+	Table    string
+	TestMode string
+	// Columns are the names of the columns hashed.
+	Columns []string
+	// Query is the generated test query, empty for tests run as multiple
+	// queries, such as the full test when chunked.
+	Query string
+	// Output is the test output recorded in the results, redacted if
+	// configured.
+	Output   string
+	Duration time.Duration
+	// Err is the error the test failed with, if any.
+	Err error
+}
+
+// finishTest logs the outcome of a test query and passes it to the table
+// callback, if any.
+func (c Config) finishTest(test tableTest, output string, elapsed time.Duration, err error) {
+	c.logTestResult(test, output, elapsed, err)
+
+	if c.TableCallback == nil {
+		return
+	}
+
+	if err != nil {
+		output = errorOutput(err)
+	}
+
+	c.TableCallback(TableVerification{
+		Target:   test.targetName,
+		Engine:   test.engine,
+		Schema:   test.schemaName,
+		Table:    test.tableName,
+		TestMode: test.testMode,
+		Columns:  append([]string{}, test.columns...),
+		Query:    test.query,
+		Output:   c.logOutput(test.testMode, output),
+		Duration: elapsed,
+		Err:      err,
+	})
+}
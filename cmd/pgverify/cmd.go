@@ -1,58 +1,134 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v4"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
 
 	"github.com/cjfinnell/pgverify"
 )
 
 // Flags.
 var (
-	aliasesFlag, excludeSchemasFlag, excludeTablesFlag, includeSchemasFlag, includeTablesFlag, includeColumnsFlag, excludeColumnsFlag, testModesFlag *[]string
-	logLevelFlag, timestampPrecisionFlag                                                                                                             *string
-	bookendLimitFlag, sparseModFlag                                                                                                                  *int
+	aliasesFlag, excludeSchemasFlag, excludeTablesFlag, includeSchemasFlag, includeTablesFlag, includeColumnsFlag, excludeColumnsFlag, testModesFlag                                        *[]string
+	formatsFlag, outputFilesFlag, excludeColumnTypesFlag, caseInsensitiveColumnsFlag, distinctColumnsFlag, largeObjectColumnsFlag, systemColumnsFlag                                        *[]string
+	rowFiltersFlag, schemaPatternsFlag                                                                                                                                                      *[]string
+	logLevelFlag, timestampPrecisionFlag, catalogSourceFlag, columnOrderFlag, modifiedSinceFlag, applicationNameFlag, requireEngineFlag, asOfSystemTimeFlag                                 *string
+	bookendLimitFlag, sparseModFlag, batchSizeFlag, rowCountToleranceFlag, maxTablesFlag, columnParallelismFlag, shardIndexFlag, shardCountFlag                                             *int
+	latestPartitionsFlag, chunkSizeFlag                                                                                                                                                     *int
+	trimTextFlag, normalizeNewlinesFlag, normalizeNaiveTimestampsFlag, strictTypesFlag, onlyFailuresFlag, groupBySchemaFlag, throughputFlag, reportHashedColumnsFlag, allowNoPrimaryKeyFlag *bool
+	excludeSystemSchemasFlag, skipEmptyTablesFlag, skipOverExplainThresholdFlag, failOnNoTablesFlag, redactHashesFlag                                                                       *bool
+	verifyPartitionParentsFlag, consistentSnapshotFlag, batchedConsistentRunFlag, bookendAsFullFlag                                                                                         *bool
+	sampleTablesFlag                                                                                                                                                                        *float64
+	sampleSeedFlag, explainThresholdFlag                                                                                                                                                    *int64
+	statementTimeoutFlag, lockTimeoutFlag, watchFlag                                                                                                                                        *time.Duration
 )
 
 func init() {
-	aliasesFlag = rootCmd.Flags().StringSlice("aliases", []string{}, "alias names for the supplied targets (comma separated)")
+	aliasesFlag = rootCmd.Flags().StringSlice("aliases", []string{}, "alias names for the supplied targets, in order (comma separated, defaults to user@host:port/database)")
 	excludeSchemasFlag = rootCmd.Flags().StringSlice("exclude-schemas", []string{}, "schemas to skip verification, ignored if '--include-schemas' used (comma separated)")
+	excludeSystemSchemasFlag = rootCmd.Flags().Bool("exclude-system-schemas", false, "skip the system and temporary schemas of PostgreSQL and CockroachDB, e.g. pg_catalog and pg_temp_N, in addition to '--exclude-schemas'")
+	failOnNoTablesFlag = rootCmd.Flags().Bool("fail-on-no-tables", false, "fail if no tables are found to verify on a target, e.g. due to a typo in a filter, rather than only warning")
+	skipEmptyTablesFlag = rootCmd.Flags().Bool("skip-empty-tables", false, "skip tables without any rows on every target (tables empty on only some targets are still verified)")
+	latestPartitionsFlag = rootCmd.Flags().Int("latest-partitions", 0, "only verify the newest N partitions of each partitioned table, ordered by range partition bound (defaults to all partitions)")
+	verifyPartitionParentsFlag = rootCmd.Flags().Bool("verify-partition-parents", false, "also verify partitioned parent tables, which scans every partition, with '--latest-partitions'")
+	rowFiltersFlag = rootCmd.Flags().StringArray("row-filter", []string{}, "SQL predicate to filter the rows of a table on every target, as SCHEMA.TABLE:PREDICATE, e.g. \"public.events:created_at > now() - interval '1 day'\" (repeatable; the predicate is run as given, so must come from a trusted source)")
 	excludeTablesFlag = rootCmd.Flags().StringSlice("exclude-tables", []string{}, "tables to skip verification, ignored if '--include-tables' used (comma separated)")
 	excludeColumnsFlag = rootCmd.Flags().StringSlice("exclude-columns", []string{}, "column names to skip verification, ignored if '--include-columns' used (comma separated)")
 	includeSchemasFlag = rootCmd.Flags().StringSlice("include-schemas", []string{}, "schemas to verify (comma separated, defaults to all)")
+	schemaPatternsFlag = rootCmd.Flags().StringArray("schema-pattern", []string{}, "glob pattern of schemas to verify, where * matches any characters and ? any single character, e.g. 'tenant_*' (repeatable, defaults to all)")
 	includeTablesFlag = rootCmd.Flags().StringSlice("include-tables", []string{}, "tables to verify (comma separated, defaults to all)")
+	excludeColumnTypesFlag = rootCmd.Flags().StringSlice("exclude-column-types", []string{}, "data types of columns to skip verification, e.g. bytea (comma separated)")
 	includeColumnsFlag = rootCmd.Flags().StringSlice("include-columns", []string{}, "columns to explicitly verify (comma separated, defaults to all)")
+	distinctColumnsFlag = rootCmd.Flags().StringSlice("distinct-columns", []string{}, "columns to compare distinct value counts of (with --tests=distinct, comma separated, defaults to all)")
+	largeObjectColumnsFlag = rootCmd.Flags().StringSlice("large-object-columns", []string{}, "oid columns referencing large objects, compared by the contents of the large objects rather than their OIDs (comma separated, unsupported on CockroachDB)")
+	systemColumnsFlag = rootCmd.Flags().StringSlice("system-columns", []string{}, "system columns, such as xmin and ctid, to hash in every table for debugging, which almost always differ between independent databases (comma separated)")
+	caseInsensitiveColumnsFlag = rootCmd.Flags().StringSlice("case-insensitive-columns", []string{}, "text columns to lowercase before hashing, so values differing only in case match (comma separated, citext columns always are)")
 
-	timestampPrecisionFlag = rootCmd.Flags().String("tz-precision", "milliseconds", "precision level to use when comparing timestamps")
+	timestampPrecisionFlag = rootCmd.Flags().String("tz-precision", pgverify.TimestampPrecisionMilliseconds, "precision level to use when comparing timestamps (options: "+strings.Join(pgverify.TimestampPrecisions(), ",")+")")
 	logLevelFlag = rootCmd.Flags().String("level", "info", "logging level")
+	applicationNameFlag = rootCmd.Flags().String("application-name", pgverify.DefaultApplicationName, "application_name of the connections to the targets, shown in pg_stat_activity (an application_name in a target URI takes precedence)")
+	requireEngineFlag = rootCmd.Flags().String("require-engine", "", "fail before running any tests unless every target is this engine, optionally with a version prefix, as reported by version() (e.g. \"PostgreSQL\", \"PostgreSQL 14\", \"CockroachDB\")")
+	asOfSystemTimeFlag = rootCmd.Flags().String("as-of-system-time", "", "run all queries on each CockroachDB target in a transaction reading the data as of this timestamp or negative interval, e.g. \"-10s\" (ignored on PostgreSQL)")
+	catalogSourceFlag = rootCmd.Flags().String("catalog-source", pgverify.CatalogSourceInformationSchema,
+		"source of table and column metadata (options: "+pgverify.CatalogSourceInformationSchema+","+pgverify.CatalogSourcePgCatalog+")")
+	columnOrderFlag = rootCmd.Flags().String("column-order", pgverify.ColumnOrderAlphabetical,
+		"order columns are concatenated in when hashing rows (options: "+pgverify.ColumnOrderAlphabetical+","+pgverify.ColumnOrderOrdinal+")")
+	onlyFailuresFlag = rootCmd.Flags().Bool("only-failures", false, "only output tables with mismatches or errors")
+	groupBySchemaFlag = rootCmd.Flags().Bool("group-by-schema", false, "output a separate table for each schema")
+	throughputFlag = rootCmd.Flags().Bool("throughput", false, "report the rate rows are hashed on each target (requires --tests to include rowcount)")
+	reportHashedColumnsFlag = rootCmd.Flags().Bool("report-hashed-columns", false, "add a table of the columns hashed in each table on each target to the table output (always included in the json output)")
+	formatsFlag = rootCmd.Flags().StringSlice("format", []string{pgverify.OutputFormatTable},
+		"output formats to write the results in (comma separated, options: "+strings.Join(pgverify.OutputFormats(), ",")+")")
+	outputFilesFlag = rootCmd.Flags().StringSlice("output-file", []string{},
+		"files to write output formats to, as FORMAT=PATH (comma separated, formats without a file are written to stdout)")
 	testModesFlag = rootCmd.Flags().StringSliceP("tests", "t", []string{pgverify.TestModeFull},
-		"tests to use for verification (comma separated, options: "+strings.Join([]string{
+		"tests to use for verification (comma separated, overrides $"+pgverify.EnvTestModes+", options: "+strings.Join([]string{
 			pgverify.TestModeFull,
 			pgverify.TestModeBookend,
 			pgverify.TestModeSparse,
 			pgverify.TestModeRowCount,
+			pgverify.TestModeDDL,
+			pgverify.TestModeDefaults,
+			pgverify.TestModeNullability,
+			pgverify.TestModeComments,
+			pgverify.TestModeConstraints,
+			pgverify.TestModeColumns,
+			pgverify.TestModeDistinct,
+			pgverify.TestModeSelfCheck,
+			pgverify.TestModeExistence,
 		}, ",")+")")
 
-	bookendLimitFlag = rootCmd.Flags().Int("bookend-limit", pgverify.TestModeBookendDefaultLimit, "only check the first and last N rows (with --tests=bookend)")
-	sparseModFlag = rootCmd.Flags().Int("sparse-mod", pgverify.TestModeSparseDefaultMod, "only check every Nth row (with --tests=sparse)")
+	bookendLimitFlag = rootCmd.Flags().Int("bookend-limit", pgverify.TestModeBookendDefaultLimit, "only check the first and last N rows (with --tests=bookend, overrides $"+pgverify.EnvBookendLimit+")")
+	bookendAsFullFlag = rootCmd.Flags().Bool("bookend-as-full", false, "run the full test in place of the bookend test on tables estimated to have fewer than twice the bookend limit of rows, rather than warning")
+	sparseModFlag = rootCmd.Flags().Int("sparse-mod", pgverify.TestModeSparseDefaultMod, "only check every Nth row (with --tests=sparse, overrides $"+pgverify.EnvSparseMod+")")
+	sampleSeedFlag = rootCmd.Flags().Int64("sample-seed", 0, "seed selecting which rows are checked, reproducibly across targets and runs (with --tests=sparse), and which tables are checked with '--sample-tables'")
+	sampleTablesFlag = rootCmd.Flags().Float64("sample-tables", 0, "only verify a random sample of approximately this percentage of tables, the same on every target for the same '--sample-seed' (defaults to all tables)")
+	rowCountToleranceFlag = rootCmd.Flags().Int("rowcount-tolerance", 0, "consider row counts within N of each other as matching (with --tests=rowcount)")
+	modifiedSinceFlag = rootCmd.Flags().String("modified-since", "", "only verify tables modified since an RFC 3339 time or a duration ago, e.g. 24h, according to table statistics (defaults to all tables)")
+	maxTablesFlag = rootCmd.Flags().Int("max-tables", 0, "abort if more than N tables are found to verify on a target (defaults to no limit)")
+	columnParallelismFlag = rootCmd.Flags().Int("column-parallelism", 0, "open N connections to each target to hash columns concurrently (with --tests=columns, defaults to one)")
+	explainThresholdFlag = rootCmd.Flags().Int64("explain-threshold", 0, "warn before running the full test on tables estimated by EXPLAIN to have more than N rows (defaults to no estimate)")
+	skipOverExplainThresholdFlag = rootCmd.Flags().Bool("skip-over-explain-threshold", false, "skip the full test on tables over '--explain-threshold' rather than only warning")
+	shardIndexFlag = rootCmd.Flags().Int("shard-index", 0, "only check the rows in shard K of '--shard-count' (with --tests=full, zero-based)")
+	shardCountFlag = rootCmd.Flags().Int("shard-count", 0, "split the rows of each table into N shards by primary key, to verify one per worker (with --tests=full, defaults to no sharding)")
+	chunkSizeFlag = rootCmd.Flags().Int("chunk-size", 0, "run the full test in chunks of N rows by primary key, each hashed by a separate query, for tables too large to hash in one query (defaults to a single query)")
+	batchSizeFlag = rootCmd.Flags().Int("batch-size", 0, "send test queries to each target in batches of N to reduce round trips (defaults to no batching)")
+	statementTimeoutFlag = rootCmd.Flags().Duration("statement-timeout", 0, "server-side timeout for each query, e.g. 30m (defaults to none)")
+	lockTimeoutFlag = rootCmd.Flags().Duration("lock-timeout", 0, "server-side timeout for each query waiting on a lock, e.g. held by concurrent DDL, e.g. 5s (defaults to none)")
+	watchFlag = rootCmd.Flags().Duration("watch", 0, "re-run the verification on an interval, e.g. 10m, printing tables that start or stop failing (defaults to a single run)")
+
+	consistentSnapshotFlag = rootCmd.Flags().Bool("consistent-snapshot", false, "run all queries on each target in a single read only REPEATABLE READ transaction, so every test sees the same point in time")
+	batchedConsistentRunFlag = rootCmd.Flags().Bool("batched-consistent-run", false, "run all queries on each target in a single read only REPEATABLE READ transaction, sending the test queries in a single batch")
+	redactHashesFlag = rootCmd.Flags().Bool("redact-hashes", false, "show only the prefix and length of hashes and other outputs derived from table data in logs and reports")
+	trimTextFlag = rootCmd.Flags().Bool("trim-text", false, "ignore trailing whitespace in text columns")
+	normalizeNewlinesFlag = rootCmd.Flags().Bool("normalize-newlines", false, "ignore CRLF vs LF line ending differences in text columns")
+	normalizeNaiveTimestampsFlag = rootCmd.Flags().Bool("normalize-naive-timestamps", false, "hash timestamp without time zone columns as epochs in UTC, like timestamp with time zone columns, for consistent comparison between engines")
+	strictTypesFlag = rootCmd.Flags().Bool("strict-types", false, "fail instead of skipping columns with types that cannot be compared between engines")
+	allowNoPrimaryKeyFlag = rootCmd.Flags().Bool("allow-no-primary-key", false, "verify tables without a primary key with an order-independent full hash, skipping bookend and sparse")
 }
 
 var rootCmd = &cobra.Command{
-	Use:  "pgverify [flags] target-uri...",
-	Long: `Verify data consistency between PostgreSQL syntax compatible databases.`,
+	Use: "pgverify [flags] target-uri...",
+	Long: `Verify data consistency between PostgreSQL syntax compatible databases.
+
+Pass - as a target to also read target URIs from stdin, one per line.`,
 	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		var targets []*pgx.ConnConfig
-		for _, target := range args {
-			connConfig, err := pgx.ParseConfig(target)
-			if err != nil {
-				return fmt.Errorf("invalid target URI %s: %w", target, err)
-			}
-			targets = append(targets, connConfig)
+		targets, err := parseTargets(args, cmd.InOrStdin())
+		if err != nil {
+			return err
 		}
 
 		opts := []pgverify.Option{
@@ -62,10 +138,35 @@ var rootCmd = &cobra.Command{
 			pgverify.ExcludeSchemas(*excludeSchemasFlag...),
 			pgverify.IncludeColumns(*includeColumnsFlag...),
 			pgverify.ExcludeColumns(*excludeColumnsFlag...),
-			pgverify.WithTests(*testModesFlag...),
-			pgverify.WithSparseMod(*sparseModFlag),
-			pgverify.WithBookendLimit(*bookendLimitFlag),
+			pgverify.WithExcludeColumnTypes(*excludeColumnTypesFlag...),
 			pgverify.WithTimestampPrecision(*timestampPrecisionFlag),
+			pgverify.WithStatementTimeout(*statementTimeoutFlag),
+			pgverify.WithLockTimeout(*lockTimeoutFlag),
+			pgverify.WithCatalogSource(*catalogSourceFlag),
+			pgverify.WithColumnOrder(*columnOrderFlag),
+			pgverify.WithApplicationName(*applicationNameFlag),
+			pgverify.WithRequireEngine(*requireEngineFlag),
+			pgverify.WithAsOfSystemTime(*asOfSystemTimeFlag),
+			pgverify.WithQueryBatchSize(*batchSizeFlag),
+			pgverify.WithColumnParallelism(*columnParallelismFlag),
+			pgverify.WithRowCountTolerance(*rowCountToleranceFlag),
+			pgverify.WithMaxTables(*maxTablesFlag),
+			pgverify.WithSampleSeed(*sampleSeedFlag),
+		}
+
+		// The test modes, sparse mod, and bookend limit defaults can be
+		// overridden by environment variables, so are only set when the flags
+		// are explicitly given.
+		if cmd.Flags().Changed("tests") {
+			opts = append(opts, pgverify.WithTests(*testModesFlag...))
+		}
+
+		if cmd.Flags().Changed("sparse-mod") {
+			opts = append(opts, pgverify.WithSparseMod(*sparseModFlag))
+		}
+
+		if cmd.Flags().Changed("bookend-limit") {
+			opts = append(opts, pgverify.WithBookendLimit(*bookendLimitFlag))
 		}
 
 		logger := log.New()
@@ -77,13 +178,373 @@ var rootCmd = &cobra.Command{
 		logger.SetLevel(levelInt)
 		opts = append(opts, pgverify.WithLogger(logger))
 
+		if *excludeSystemSchemasFlag {
+			opts = append(opts, pgverify.WithExcludeSystemSchemas())
+		}
+
+		if *shardCountFlag > 0 {
+			opts = append(opts, pgverify.WithShard(*shardIndexFlag, *shardCountFlag))
+		}
+
+		if *explainThresholdFlag > 0 {
+			opts = append(opts, pgverify.WithExplainThreshold(*explainThresholdFlag))
+		}
+
+		if *skipOverExplainThresholdFlag {
+			opts = append(opts, pgverify.WithSkipOverExplainThreshold())
+		}
+
+		if *failOnNoTablesFlag {
+			opts = append(opts, pgverify.WithFailOnNoTables())
+		}
+
+		for _, pattern := range *schemaPatternsFlag {
+			opts = append(opts, pgverify.WithSchemaPattern(pattern))
+		}
+
+		for _, rowFilter := range *rowFiltersFlag {
+			schema, table, predicate, err := parseRowFilter(rowFilter)
+			if err != nil {
+				return err
+			}
+
+			opts = append(opts, pgverify.WithRowFilter(schema, table, predicate))
+		}
+
+		if *sampleTablesFlag > 0 {
+			opts = append(opts, pgverify.WithSampleTables(*sampleTablesFlag, *sampleSeedFlag))
+		}
+
+		if *chunkSizeFlag > 0 {
+			opts = append(opts, pgverify.WithChunkSize(*chunkSizeFlag))
+		}
+
+		if *latestPartitionsFlag > 0 {
+			opts = append(opts, pgverify.WithLatestPartitions(*latestPartitionsFlag))
+		}
+
+		if *verifyPartitionParentsFlag {
+			opts = append(opts, pgverify.WithPartitionParents())
+		}
+
+		if *skipEmptyTablesFlag {
+			opts = append(opts, pgverify.WithSkipEmptyTables())
+		}
+
+		if *bookendAsFullFlag {
+			opts = append(opts, pgverify.WithBookendAsFull())
+		}
+
+		if *consistentSnapshotFlag {
+			opts = append(opts, pgverify.WithConsistentSnapshot())
+		}
+
+		if *batchedConsistentRunFlag {
+			opts = append(opts, pgverify.WithBatchedConsistentRun())
+		}
+
+		if *redactHashesFlag {
+			opts = append(opts, pgverify.WithRedactHashes())
+		}
+
+		if *trimTextFlag {
+			opts = append(opts, pgverify.WithTrimText())
+		}
+
+		if *normalizeNewlinesFlag {
+			opts = append(opts, pgverify.WithNormalizeNewlines())
+		}
+
+		if *normalizeNaiveTimestampsFlag {
+			opts = append(opts, pgverify.WithNormalizeNaiveTimestamps())
+		}
+
+		if len(*distinctColumnsFlag) > 0 {
+			opts = append(opts, pgverify.WithDistinctColumns(*distinctColumnsFlag...))
+		}
+
+		if len(*largeObjectColumnsFlag) > 0 {
+			opts = append(opts, pgverify.WithLargeObjectColumns(*largeObjectColumnsFlag...))
+		}
+
+		if len(*systemColumnsFlag) > 0 {
+			opts = append(opts, pgverify.WithSystemColumns(*systemColumnsFlag...))
+		}
+
+		if len(*caseInsensitiveColumnsFlag) > 0 {
+			opts = append(opts, pgverify.WithCaseInsensitiveColumns(*caseInsensitiveColumnsFlag...))
+		}
+
+		if *strictTypesFlag {
+			opts = append(opts, pgverify.WithStrictTypes())
+		}
+
+		if *allowNoPrimaryKeyFlag {
+			opts = append(opts, pgverify.WithAllowNoPrimaryKey())
+		}
+
+		if *onlyFailuresFlag {
+			opts = append(opts, pgverify.WithOnlyShowMismatches())
+		}
+
+		if *groupBySchemaFlag {
+			opts = append(opts, pgverify.WithGroupBySchema())
+		}
+
+		if *throughputFlag {
+			opts = append(opts, pgverify.WithThroughput())
+		}
+
+		if *reportHashedColumnsFlag {
+			opts = append(opts, pgverify.WithHashedColumnsReport())
+		}
+
 		if len(*aliasesFlag) > 0 {
 			opts = append(opts, pgverify.WithAliases(*aliasesFlag))
 		}
 
+		if *modifiedSinceFlag != "" {
+			since, err := parseModifiedSince(*modifiedSinceFlag, time.Now())
+			if err != nil {
+				return err
+			}
+
+			opts = append(opts, pgverify.WithModifiedSince(since))
+		}
+
+		outputFiles := make(map[string]string)
+
+		for _, outputFile := range *outputFilesFlag {
+			format, path, ok := strings.Cut(outputFile, "=")
+			if !ok {
+				return fmt.Errorf("invalid output file %s, should be FORMAT=PATH", outputFile)
+			}
+
+			outputFiles[format] = path
+		}
+
+		if err := validateOutputFormats(*formatsFlag, outputFiles); err != nil {
+			return err
+		}
+
+		if *watchFlag > 0 {
+			return watch(cmd, targets, opts, outputFiles)
+		}
+
 		report, err := pgverify.Verify(cmd.Context(), targets, opts...)
-		report.WriteAsTable(cmd.OutOrStdout())
+		if !report.AllConnected() {
+			if len(report.Connections()) > 0 {
+				fmt.Fprintln(cmd.ErrOrStderr(), report.ConnectionSummary())
+			}
 
-		return err
+			return err
+		}
+
+		return multierr.Append(err, writeReports(cmd, report, outputFiles))
 	},
 }
+
+// watch re-runs the verification until interrupted, writing the full report
+// for the first run and the changes in failing tables for each later run.
+func watch(cmd *cobra.Command, targets []*pgx.ConnConfig, opts []pgverify.Option, outputFiles map[string]string) error {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
+
+	var (
+		previous *pgverify.Results
+		writeErr error
+	)
+
+	err := pgverify.NewConfig(opts...).Watch(ctx, targets, *watchFlag, func(report *pgverify.Results, err error) {
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s verification failed: %s\n", time.Now().Format(time.RFC3339), err)
+		}
+
+		if !report.AllConnected() {
+			return
+		}
+
+		if previous == nil {
+			writeErr = writeReports(cmd, report, outputFiles)
+		} else {
+			newlyFailing, newlyPassing := pgverify.DiffFailingTables(previous, report)
+			writeDelta(cmd.OutOrStdout(), newlyFailing, newlyPassing)
+		}
+
+		previous = report
+
+		if writeErr != nil {
+			stop()
+		}
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+
+	return err
+}
+
+// writeDelta writes the tables that started or stopped failing since the
+// previous verification run.
+func writeDelta(writer io.Writer, newlyFailing, newlyPassing []string) {
+	timestamp := time.Now().Format(time.RFC3339)
+
+	if len(newlyFailing) == 0 && len(newlyPassing) == 0 {
+		fmt.Fprintf(writer, "%s no changes\n", timestamp)
+
+		return
+	}
+
+	for _, table := range newlyFailing {
+		fmt.Fprintf(writer, "%s now failing: %s\n", timestamp, table)
+	}
+
+	for _, table := range newlyPassing {
+		fmt.Fprintf(writer, "%s now passing: %s\n", timestamp, table)
+	}
+}
+
+// validateOutputFormats returns an error if any of the output formats, or the
+// formats of the output files, is not supported, so that a typo is reported
+// before connecting to the targets rather than after verifying them.
+func validateOutputFormats(formats []string, outputFiles map[string]string) error {
+	supported := make(map[string]bool)
+	for _, format := range pgverify.OutputFormats() {
+		supported[format] = true
+	}
+
+	for _, format := range formats {
+		if !supported[format] {
+			return fmt.Errorf("invalid output format: %s", format)
+		}
+	}
+
+	for format := range outputFiles {
+		if !supported[format] {
+			return fmt.Errorf("invalid output file format: %s", format)
+		}
+	}
+
+	return nil
+}
+
+// writeReports writes the report in each of the configured formats, carrying
+// on past formats that fail so that the others are still written.
+func writeReports(cmd *cobra.Command, report *pgverify.Results, outputFiles map[string]string) error {
+	var err error
+
+	for _, format := range *formatsFlag {
+		err = multierr.Append(err, writeReport(cmd, report, format, outputFiles[format]))
+	}
+
+	return err
+}
+
+// readTargetURIs returns the target URIs given as arguments, replacing a "-"
+// argument with the URIs read from stdin, one per line. Blank lines are
+// ignored.
+func readTargetURIs(args []string, stdin io.Reader) ([]string, error) {
+	var targetURIs []string
+
+	for _, arg := range args {
+		if arg != "-" {
+			targetURIs = append(targetURIs, arg)
+
+			continue
+		}
+
+		scanner := bufio.NewScanner(stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				targetURIs = append(targetURIs, line)
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read target URIs from stdin: %w", err)
+		}
+	}
+
+	return targetURIs, nil
+}
+
+// parseTargets parses the connection configs of the target URIs given as
+// arguments, or read from stdin.
+func parseTargets(args []string, stdin io.Reader) ([]*pgx.ConnConfig, error) {
+	targetURIs, err := readTargetURIs(args, stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []*pgx.ConnConfig
+	for _, target := range targetURIs {
+		connConfig, err := pgx.ParseConfig(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target URI %s: %w", target, err)
+		}
+		targets = append(targets, connConfig)
+	}
+
+	return targets, nil
+}
+
+// parseRowFilter parses a row filter given as SCHEMA.TABLE:PREDICATE. A
+// leading WHERE keyword in the predicate is ignored.
+func parseRowFilter(value string) (schema, table, predicate string, err error) {
+	qualifiedTable, predicate, ok := strings.Cut(value, ":")
+	if ok {
+		schema, table, ok = strings.Cut(qualifiedTable, ".")
+	}
+
+	predicate = strings.TrimSpace(predicate)
+	if len(predicate) > len("WHERE ") && strings.EqualFold(predicate[:len("WHERE ")], "WHERE ") {
+		predicate = strings.TrimSpace(predicate[len("WHERE "):])
+	}
+
+	if !ok || schema == "" || table == "" || predicate == "" {
+		return "", "", "", fmt.Errorf("invalid row filter %s, should be SCHEMA.TABLE:PREDICATE", value)
+	}
+
+	return schema, table, predicate, nil
+}
+
+// parseModifiedSince parses the value as either an RFC 3339 time, or as a
+// duration before now.
+func parseModifiedSince(value string, now time.Time) (time.Time, error) {
+	if since, err := time.Parse(time.RFC3339, value); err == nil {
+		return since, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid modified since %s, should be an RFC 3339 time or a duration", value)
+	}
+
+	return now.Add(-duration), nil
+}
+
+// writeReport writes the report in the given format to the file at path, or
+// to stdout if the path is empty.
+func writeReport(cmd *cobra.Command, report *pgverify.Results, format, path string) (err error) {
+	if path == "" {
+		return report.WriteAsFormat(format, cmd.OutOrStdout())
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create output file %s: %w", path, err)
+	}
+
+	// The report may not be written out until the file is closed.
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			err = multierr.Append(err, fmt.Errorf("unable to close output file %s: %w", path, closeErr))
+		}
+	}()
+
+	return report.WriteAsFormat(format, file)
+}
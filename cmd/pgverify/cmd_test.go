@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cjfinnell/pgverify"
+)
+
+func TestParseModifiedSince(t *testing.T) {
+	now := time.Date(2022, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	since, err := parseModifiedSince("2022-06-01T00:00:00Z", now)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC), since)
+
+	since, err = parseModifiedSince("24h", now)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC), since)
+
+	_, err = parseModifiedSince("yesterday", now)
+	require.Error(t, err)
+}
+
+func TestReadTargetURIs(t *testing.T) {
+	stdin := strings.NewReader("postgres://a/db\n\n  postgres://b/db  \n")
+
+	targetURIs, err := readTargetURIs([]string{"postgres://first/db", "-"}, stdin)
+	require.NoError(t, err)
+	require.Equal(t, []string{"postgres://first/db", "postgres://a/db", "postgres://b/db"}, targetURIs)
+}
+
+func TestWriteTargetStatuses(t *testing.T) {
+	var buf strings.Builder
+
+	writeTargetStatuses(&buf, []pgverify.TargetStatus{
+		{Target: "a", Tables: 12},
+		{Target: "b", Err: errors.New("failed to connect: connection refused")},
+	})
+
+	require.Equal(t, "a: ok, 12 tables\nb: failed: failed to connect: connection refused\n", buf.String())
+}
+
+func TestParseRowFilter(t *testing.T) {
+	schema, table, predicate, err := parseRowFilter("public.events:created_at > '2022-06-01'")
+	require.NoError(t, err)
+	require.Equal(t, []string{"public", "events", "created_at > '2022-06-01'"}, []string{schema, table, predicate})
+
+	_, _, predicate, err = parseRowFilter("public.events: WHERE id > 10")
+	require.NoError(t, err)
+	require.Equal(t, "id > 10", predicate)
+
+	for _, invalid := range []string{"events:id > 10", "public.events", "public.events:", ".events:id > 10"} {
+		_, _, _, err = parseRowFilter(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestValidateOutputFormats(t *testing.T) {
+	require.NoError(t, validateOutputFormats([]string{pgverify.OutputFormatTable, pgverify.OutputFormatJSON}, map[string]string{pgverify.OutputFormatJSON: "report.json"}))
+	require.ErrorContains(t, validateOutputFormats([]string{"jsno"}, nil), "invalid output format: jsno")
+	require.ErrorContains(t, validateOutputFormats([]string{pgverify.OutputFormatTable}, map[string]string{"xml": "report.xml"}), "invalid output file format: xml")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/cjfinnell/pgverify"
+)
+
+// Ping flags.
+var (
+	pingAliasesFlag, pingIncludeSchemasFlag, pingExcludeSchemasFlag *[]string
+	pingLogLevelFlag                                                *string
+)
+
+func init() {
+	pingAliasesFlag = pingCmd.Flags().StringSlice("aliases", []string{}, "alias names for the supplied targets, in order (comma separated, defaults to user@host:port/database)")
+	pingIncludeSchemasFlag = pingCmd.Flags().StringSlice("include-schemas", []string{}, "schemas to count tables in (comma separated, defaults to all)")
+	pingExcludeSchemasFlag = pingCmd.Flags().StringSlice("exclude-schemas", []string{}, "schemas to skip counting tables in, ignored if '--include-schemas' used (comma separated)")
+	pingLogLevelFlag = pingCmd.Flags().String("level", "warn", "logging level")
+
+	rootCmd.AddCommand(pingCmd)
+}
+
+var pingCmd = &cobra.Command{
+	Use:   "ping [flags] target-uri...",
+	Short: "Check connectivity to the targets without verifying them",
+	Long: `Check connectivity to the targets without verifying them.
+
+Each target is connected to and queried, and the number of tables visible for
+verification is reported, to confirm access and privileges before a run.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		targets, err := parseTargets(args, cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+
+		logger := log.New()
+		logger.SetFormatter(&log.TextFormatter{})
+		levelInt, err := log.ParseLevel(*pingLogLevelFlag)
+		if err != nil {
+			levelInt = log.WarnLevel
+		}
+		logger.SetLevel(levelInt)
+
+		opts := []pgverify.Option{
+			pgverify.IncludeSchemas(*pingIncludeSchemasFlag...),
+			pgverify.ExcludeSchemas(*pingExcludeSchemasFlag...),
+			pgverify.WithLogger(logger),
+		}
+
+		if len(*pingAliasesFlag) > 0 {
+			opts = append(opts, pgverify.WithAliases(*pingAliasesFlag))
+		}
+
+		statuses, err := pgverify.NewConfig(opts...).Ping(cmd.Context(), targets)
+		writeTargetStatuses(cmd.OutOrStdout(), statuses)
+
+		return err
+	},
+}
+
+// writeTargetStatuses writes a line for each target, with the number of
+// tables visible if it could be reached, or the error otherwise.
+func writeTargetStatuses(writer io.Writer, statuses []pgverify.TargetStatus) {
+	for _, status := range statuses {
+		if !status.OK() {
+			fmt.Fprintf(writer, "%s: failed: %s\n", status.Target, status.Err)
+
+			continue
+		}
+
+		fmt.Fprintf(writer, "%s: ok, %d tables\n", status.Target, status.Tables)
+	}
+}
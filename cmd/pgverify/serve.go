@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/cjfinnell/pgverify"
+)
+
+const (
+	// The maximum size of a verify request body.
+	maxRequestBytes = 1 << 20
+	// The environment variable the bearer token is read from by default.
+	serveTokenEnv = "PGVERIFY_SERVE_TOKEN"
+)
+
+// Serve flags.
+var (
+	listenFlag, tokenFlag, serveLogLevelFlag *string
+)
+
+func init() {
+	listenFlag = serveCmd.Flags().String("listen", ":8080", "address to listen on")
+	tokenFlag = serveCmd.Flags().String("token", "", "bearer token required on requests (defaults to $"+serveTokenEnv+", no authentication if empty)")
+	serveLogLevelFlag = serveCmd.Flags().String("level", "info", "logging level")
+
+	rootCmd.AddCommand(serveCmd)
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve [flags]",
+	Short: "Run an HTTP server exposing verification on demand",
+	Long: `Run an HTTP server exposing verification on demand.
+
+POST a JSON document of targets and options to /verify to run a verification,
+and receive the results as JSON in response.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := log.New()
+		logger.SetFormatter(&log.TextFormatter{})
+		levelInt, err := log.ParseLevel(*serveLogLevelFlag)
+		if err != nil {
+			levelInt = log.InfoLevel
+		}
+		logger.SetLevel(levelInt)
+
+		// The token is not the flag's default, so that it is not shown in the
+		// help output.
+		token := *tokenFlag
+		if !cmd.Flags().Changed("token") {
+			token = os.Getenv(serveTokenEnv)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/verify", verifyHandler{token: token, logger: logger})
+
+		server := &http.Server{
+			Addr:              *listenFlag,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		go func() {
+			<-ctx.Done()
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				logger.WithError(err).Error("Failed to shut down server")
+			}
+		}()
+
+		logger.Infof("Listening on %s", *listenFlag)
+
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+
+		return nil
+	},
+}
+
+// verifyRequest is the JSON request body accepted by the /verify endpoint.
+// Options left empty use the defaults.
+type verifyRequest struct {
+	Targets            []string `json:"targets"`
+	Aliases            []string `json:"aliases"`
+	Tests              []string `json:"tests"`
+	IncludeSchemas     []string `json:"include_schemas"`
+	ExcludeSchemas     []string `json:"exclude_schemas"`
+	IncludeTables      []string `json:"include_tables"`
+	ExcludeTables      []string `json:"exclude_tables"`
+	IncludeColumns     []string `json:"include_columns"`
+	ExcludeColumns     []string `json:"exclude_columns"`
+	BookendLimit       int      `json:"bookend_limit"`
+	SparseMod          int      `json:"sparse_mod"`
+	TimestampPrecision string   `json:"timestamp_precision"`
+	OnlyFailures       bool     `json:"only_failures"`
+}
+
+// options returns the verification Options configured by the request.
+func (r verifyRequest) options() []pgverify.Option {
+	opts := []pgverify.Option{
+		pgverify.IncludeSchemas(r.IncludeSchemas...),
+		pgverify.ExcludeSchemas(r.ExcludeSchemas...),
+		pgverify.IncludeTables(r.IncludeTables...),
+		pgverify.ExcludeTables(r.ExcludeTables...),
+		pgverify.IncludeColumns(r.IncludeColumns...),
+		pgverify.ExcludeColumns(r.ExcludeColumns...),
+		pgverify.WithAliases(r.Aliases),
+	}
+
+	if len(r.Tests) > 0 {
+		opts = append(opts, pgverify.WithTests(r.Tests...))
+	}
+
+	if r.BookendLimit != 0 {
+		opts = append(opts, pgverify.WithBookendLimit(r.BookendLimit))
+	}
+
+	if r.SparseMod != 0 {
+		opts = append(opts, pgverify.WithSparseMod(r.SparseMod))
+	}
+
+	if r.TimestampPrecision != "" {
+		opts = append(opts, pgverify.WithTimestampPrecision(r.TimestampPrecision))
+	}
+
+	if r.OnlyFailures {
+		opts = append(opts, pgverify.WithOnlyShowMismatches())
+	}
+
+	return opts
+}
+
+// verifyHandler runs a verification for each request, responding with the
+// results as JSON.
+type verifyHandler struct {
+	// The bearer token required on requests, if not empty.
+	token  string
+	logger log.FieldLogger
+}
+
+func (h verifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+
+		return
+	}
+
+	if !h.authorized(r) {
+		writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+
+		return
+	}
+
+	var request verifyRequest
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+
+		return
+	}
+
+	if len(request.Targets) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("no targets given"))
+
+		return
+	}
+
+	var targets []*pgx.ConnConfig
+
+	for _, target := range request.Targets {
+		connConfig, err := pgx.ParseConfig(target)
+		if err != nil {
+			// The URI is omitted as it may contain credentials.
+			writeError(w, http.StatusBadRequest, errors.New("invalid target URI"))
+
+			return
+		}
+
+		targets = append(targets, connConfig)
+	}
+
+	config := pgverify.NewConfig(append(request.options(), pgverify.WithLogger(h.logger))...)
+	if err := config.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	report, err := config.Verify(r.Context(), targets)
+	if !report.AllConnected() {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("%s: %w", report.ConnectionSummary(), err))
+
+		return
+	}
+
+	if err != nil {
+		h.logger.WithError(err).Info("Verification found differences")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := report.WriteAsJSON(w); err != nil {
+		h.logger.WithError(err).Error("Failed to write response")
+	}
+}
+
+// authorized returns whether the request carries the configured bearer token,
+// or true if no token is configured.
+func (h verifyHandler) authorized(r *http.Request) bool {
+	if h.token == "" {
+		return true
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return false
+	}
+
+	token := strings.TrimPrefix(authorization, "Bearer ")
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// writeError responds with the error as a JSON document.
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
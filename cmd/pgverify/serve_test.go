@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyHandler(t *testing.T) {
+	handler := verifyHandler{token: "secret", logger: log.New()}
+
+	for _, tc := range []struct {
+		name string
+
+		method         string
+		authorization  string
+		body           string
+		expectedStatus int
+	}{
+		{name: "wrong method", method: http.MethodGet, authorization: "Bearer secret", expectedStatus: http.StatusMethodNotAllowed},
+		{name: "missing token", method: http.MethodPost, body: `{}`, expectedStatus: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodPost, authorization: "Bearer wrong", body: `{}`, expectedStatus: http.StatusUnauthorized},
+		{name: "invalid body", method: http.MethodPost, authorization: "Bearer secret", body: `{"bogus": 1}`, expectedStatus: http.StatusBadRequest},
+		{name: "no targets", method: http.MethodPost, authorization: "Bearer secret", body: `{}`, expectedStatus: http.StatusBadRequest},
+		{
+			name:           "invalid test mode",
+			method:         http.MethodPost,
+			authorization:  "Bearer secret",
+			body:           `{"targets": ["postgres://localhost/db"], "tests": ["bogus"]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(tc.method, "/verify", strings.NewReader(tc.body))
+			if tc.authorization != "" {
+				request.Header.Set("Authorization", tc.authorization)
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			require.Equal(t, tc.expectedStatus, recorder.Code)
+			require.Contains(t, recorder.Body.String(), `"error"`)
+		})
+	}
+}
@@ -1,15 +1,88 @@
 package pgverify
 
 import (
+	"crypto/md5" //nolint:gosec // used for fingerprinting, not security
+	"encoding/hex"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
+var (
+	// Matches PostgreSQL casts (::type) and CockroachDB type annotations
+	// (:::type), including multi-word, parameterized, and array types.
+	defaultExprCastRegex = regexp.MustCompile(`:::?[a-z_][a-z0-9_]*( [a-z_][a-z0-9_]*)*(\([0-9, ]*\))?(\[\])*`)
+	// Matches a schema qualified sequence name in a nextval call.
+	defaultExprSequenceRegex = regexp.MustCompile(`nextval\('(?:[a-z0-9_]+\.)?([a-z0-9_]+)'\)`)
+	// Matches the schema qualifying the table referenced by a foreign key.
+	constraintReferencesRegex = regexp.MustCompile(`references (?:[a-z0-9_]+\.)?`)
+	// Matches the parentheses and whitespace that engines add inconsistently
+	// when rendering constraint expressions.
+	constraintFormattingRegex = regexp.MustCompile(`[()\s]+`)
+)
+
+// defaultTypeAliases maps alternative spellings of data types, as reported by
+// different engines or catalog sources, to a canonical name so equivalent
+// column types compare equal.
+var defaultTypeAliases = map[string]string{
+	"int":  "integer",
+	"int4": "integer",
+	"int8": "bigint",
+	"int2": "smallint",
+}
+
+// canonicalDataType lowercases the data type and resolves it through the
+// configured type aliases, falling back to the default aliases.
+func canonicalDataType(config Config, dataType string) string {
+	dataType = strings.ToLower(strings.TrimSpace(dataType))
+
+	if canonical, ok := config.TypeAliases[dataType]; ok {
+		return canonical
+	}
+
+	if canonical, ok := defaultTypeAliases[dataType]; ok {
+		return canonical
+	}
+
+	return dataType
+}
+
+// systemColumnTypes maps the names of the system columns that can be hashed
+// with WithSystemColumns to their data types. Each is present on PostgreSQL
+// or CockroachDB, but not necessarily both.
+var systemColumnTypes = map[string]string{
+	"ctid":                         "tid",
+	"xmin":                         "xid",
+	"xmax":                         "xid",
+	"cmin":                         "cid",
+	"cmax":                         "cid",
+	"tableoid":                     "oid",
+	"crdb_internal_mvcc_timestamp": "numeric",
+}
+
+// systemColumns returns the configured system columns to hash, which are not
+// listed by the catalog queries.
+func (c Config) systemColumns() []column {
+	columns := make([]column, len(c.SystemColumns))
+	for i, name := range c.SystemColumns {
+		columns[i] = column{name: name, dataType: systemColumnTypes[name]}
+	}
+
+	return columns
+}
+
 // column represents a column in a table.
 type column struct {
 	name        string
 	dataType    string
 	constraints []string
+	defaultExpr string
+	// Whether the column allows NULL values.
+	isNullable bool
+	// The position of the column in the table, starting at 1.
+	ordinal int64
 }
 
 // IsPrimaryKey attempts to parse the constraint string to determine if the
@@ -24,16 +97,280 @@ func (c column) IsPrimaryKey() bool {
 	return false
 }
 
+// IsText returns whether the column is a text-like type.
+func (c column) IsText() bool {
+	switch strings.ToLower(c.dataType) {
+	case "text", "character varying", "character", "citext":
+		return true
+	default:
+		return false
+	}
+}
+
+// IsIncomparable returns whether the column's type is known to lack a text
+// representation that is consistent between supported databases.
+func (c column) IsIncomparable() bool {
+	switch strings.ToLower(c.dataType) {
+	case "tsvector", "tsquery",
+		"point", "line", "lseg", "box", "path", "polygon", "circle",
+		"int4range", "int8range", "numrange", "tsrange", "tstzrange", "daterange":
+		return true
+	default:
+		return false
+	}
+}
+
 // CastToText generates PSQL expression to cast the column to the TEXT type in
 // a way that is consistent between supported databases.
-func (c column) CastToText(precision string) string {
+func (c column) CastToText(config Config) string {
+	name := config.quoteIdent(c.name)
+
+	// The OIDs referencing large objects are assigned by each database, so
+	// the contents of the large object are hashed instead.
+	if containsString(config.LargeObjectColumns, c.name) {
+		return fmt.Sprintf("md5(lo_get(%s))", name)
+	}
+
+	if cast, ok := config.TypeCasts[strings.ToLower(c.dataType)]; ok {
+		return fmt.Sprintf(cast, name)
+	}
+
 	switch strings.ToLower(c.dataType) {
 	case "timestamp with time zone":
 		// Truncating the epoch means that timestamps will be compared "to the second"; timestamps with ms/ns differences will be considered equal.
-		return fmt.Sprintf("(extract(epoch from date_trunc('%s', %s))::DECIMAL * 1000000)::BIGINT::TEXT", precision, c.name)
+		return epochExpression(config, name) + "::TEXT"
+	case "timestamp without time zone":
+		// The epoch of a timestamp without time zone is taken as if it were in
+		// UTC by both engines.
+		if config.NormalizeNaiveTimestamps {
+			return epochExpression(config, name) + "::TEXT"
+		}
 	case "jsonb", "json":
-		return fmt.Sprintf("length(%s::TEXT)::TEXT", c.name)
-	default:
-		return c.name + "::TEXT"
+		return fmt.Sprintf("length(%s::TEXT)::TEXT", name)
+	}
+
+	expression := name + "::TEXT"
+
+	if c.IsText() {
+		if config.NormalizeNewlines {
+			expression = fmt.Sprintf(`replace(%s, E'\r\n', E'\n')`, expression)
+		}
+
+		if config.TrimText {
+			expression = fmt.Sprintf(`rtrim(%s, E' \t\r\n')`, expression)
+		}
+	}
+
+	if c.isCaseInsensitive(config) {
+		expression = fmt.Sprintf("lower(%s)", expression)
+	}
+
+	return expression
+}
+
+// isCaseInsensitive returns whether the column is configured to be compared
+// case-insensitively, or is of the citext type.
+func (c column) isCaseInsensitive(config Config) bool {
+	if strings.ToLower(c.dataType) == "citext" {
+		return true
+	}
+
+	for _, name := range config.CaseInsensitiveColumns {
+		if name == c.name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// timestampPrecision returns the configured timestamp precision, or
+// milliseconds, the default, if none is configured.
+func (c Config) timestampPrecision() string {
+	if c.TimestampPrecision == "" {
+		return TimestampPrecisionMilliseconds
+	}
+
+	return c.TimestampPrecision
+}
+
+// epochExpression generates a PSQL expression converting the timestamp column
+// to microseconds since the epoch, truncated to the configured precision, in a
+// way that is consistent between supported databases.
+func epochExpression(config Config, columnName string) string {
+	return fmt.Sprintf("(extract(epoch from date_trunc('%s', %s))::DECIMAL * 1000000)::BIGINT", config.timestampPrecision(), columnName)
+}
+
+// ddlFingerprint generates an MD5 hash of a normalized signature of the
+// columns' names, data types, nullability, and constraints, independent of
+// column order.
+func ddlFingerprint(columns []column) string {
+	signatures := make([]string, 0, len(columns))
+
+	for _, col := range columns {
+		var constraints []string
+
+		for _, constraint := range col.constraints {
+			if constraint != "" {
+				constraints = append(constraints, constraint)
+			}
+		}
+
+		if !col.isNullable {
+			constraints = append(constraints, "NOT NULL")
+		}
+
+		sort.Strings(constraints)
+
+		signatures = append(signatures, fmt.Sprintf("%s %s [%s]", col.name, strings.ToLower(col.dataType), strings.Join(constraints, ", ")))
+	}
+
+	sort.Strings(signatures)
+
+	hash := md5.Sum([]byte(strings.Join(signatures, "\n"))) //nolint:gosec // used for fingerprinting, not security
+
+	return hex.EncodeToString(hash[:])
+}
+
+// columnNullability returns whether each of the columns allows NULL values, as
+// a keyed output.
+func columnNullability(columns []column) string {
+	nullability := make(map[string]string, len(columns))
+
+	for _, col := range columns {
+		nullability[strconv.Quote(col.name)] = "NOT NULL"
+		if col.isNullable {
+			nullability[strconv.Quote(col.name)] = "NULL"
+		}
+	}
+
+	return formatKeyedOutput(nullability)
+}
+
+// commentsFingerprint generates an MD5 hash of the table comment and the
+// comments on the given columns, independent of column order. Comments on
+// other columns are ignored.
+func commentsFingerprint(tableComment string, columns []column, columnComments map[string]string) string {
+	var comments []string
+
+	for _, col := range columns {
+		if comment, ok := columnComments[col.name]; ok {
+			comments = append(comments, col.name+"="+comment)
+		}
+	}
+
+	sort.Strings(comments)
+
+	hash := md5.Sum([]byte(tableComment + "\n" + strings.Join(comments, "\n"))) //nolint:gosec // used for fingerprinting, not security
+
+	return hex.EncodeToString(hash[:])
+}
+
+// normalizeConstraintDef normalizes a CHECK or FOREIGN KEY constraint
+// definition so that equivalent constraints rendered differently by different
+// engines compare equal. Redundant parentheses cannot be distinguished from
+// significant ones, so all are removed.
+func normalizeConstraintDef(definition string) string {
+	definition = strings.TrimSpace(definition)
+	if strings.HasSuffix(strings.ToLower(definition), " not valid") {
+		definition = definition[:len(definition)-len(" not valid")]
+	}
+
+	return normalizeOutsideLiterals(definition, func(segment string) string {
+		segment = strings.ToLower(segment)
+		segment = defaultExprCastRegex.ReplaceAllString(segment, "")
+		segment = constraintReferencesRegex.ReplaceAllString(segment, "references ")
+
+		return constraintFormattingRegex.ReplaceAllString(segment, "")
+	})
+}
+
+// constraintsFingerprint generates an MD5 hash of the normalized constraint
+// definitions, independent of their order.
+func constraintsFingerprint(definitions []string) string {
+	normalized := make([]string, len(definitions))
+	for i, definition := range definitions {
+		normalized[i] = normalizeConstraintDef(definition)
 	}
+
+	sort.Strings(normalized)
+
+	hash := md5.Sum([]byte(strings.Join(normalized, "\n"))) //nolint:gosec // used for fingerprinting, not security
+
+	return hex.EncodeToString(hash[:])
+}
+
+// normalizeDefaultExpr normalizes a column default expression so that
+// equivalent defaults rendered differently by different engines compare equal.
+func normalizeDefaultExpr(expr string) string {
+	expr = normalizeOutsideLiterals(strings.TrimSpace(expr), func(segment string) string {
+		segment = strings.ToLower(segment)
+		segment = defaultExprCastRegex.ReplaceAllString(segment, "")
+
+		for _, alias := range []string{"current_timestamp()", "current_timestamp", "transaction_timestamp()"} {
+			segment = strings.ReplaceAll(segment, alias, "now()")
+		}
+
+		return strings.Join(strings.Fields(segment), "")
+	})
+
+	return defaultExprSequenceRegex.ReplaceAllString(expr, "nextval('$1')")
+}
+
+// normalizeOutsideLiterals applies the normalization to the parts of the SQL
+// expression outside of its single quoted string literals, which are kept
+// verbatim, so that differences in their case or whitespace are not hidden.
+func normalizeOutsideLiterals(expr string, normalize func(string) string) string {
+	var builder strings.Builder
+
+	for {
+		start := strings.IndexByte(expr, '\'')
+		if start < 0 {
+			builder.WriteString(normalize(expr))
+
+			return builder.String()
+		}
+
+		// The literal ends at the first quote that is not an escaped quote,
+		// written as two quotes, or at the end of an unterminated literal.
+		end := start + 1
+
+		for end < len(expr) {
+			if expr[end] == '\'' {
+				if end+1 < len(expr) && expr[end+1] == '\'' {
+					end += 2
+
+					continue
+				}
+
+				break
+			}
+
+			end++
+		}
+
+		if end < len(expr) {
+			end++
+		}
+
+		builder.WriteString(normalize(expr[:start]))
+		builder.WriteString(expr[start:end])
+		expr = expr[end:]
+	}
+}
+
+// columnDefaults generates a sorted listing of the normalized default
+// expressions of the columns that have one.
+func columnDefaults(columns []column) string {
+	var defaults []string
+
+	for _, col := range columns {
+		if col.defaultExpr != "" {
+			defaults = append(defaults, col.name+"="+normalizeDefaultExpr(col.defaultExpr))
+		}
+	}
+
+	sort.Strings(defaults)
+
+	return strings.Join(defaults, "; ")
 }
@@ -0,0 +1,254 @@
+//nolint:testpackage // unit test for internals, *_test pattern not appropriate
+package pgverify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCastToText(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+
+		config Config
+		column column
+
+		expected string
+	}{
+		{
+			name:     "text",
+			config:   Config{},
+			column:   column{name: "content", dataType: "text"},
+			expected: `"content"::TEXT`,
+		},
+		{
+			name:     "trimmed text",
+			config:   Config{TrimText: true},
+			column:   column{name: "content", dataType: "character varying"},
+			expected: `rtrim("content"::TEXT, E' \t\r\n')`,
+		},
+		{
+			name:     "normalized newlines",
+			config:   Config{NormalizeNewlines: true},
+			column:   column{name: "content", dataType: "text"},
+			expected: `replace("content"::TEXT, E'\r\n', E'\n')`,
+		},
+		{
+			name:     "trimmed text with normalized newlines",
+			config:   Config{TrimText: true, NormalizeNewlines: true},
+			column:   column{name: "content", dataType: "text"},
+			expected: `rtrim(replace("content"::TEXT, E'\r\n', E'\n'), E' \t\r\n')`,
+		},
+		{
+			name:     "type cast override",
+			config:   Config{TypeCasts: map[string]string{"point": "ST_AsText(%s)"}},
+			column:   column{name: "location", dataType: "point"},
+			expected: `ST_AsText("location")`,
+		},
+		{
+			name:     "case insensitive column",
+			config:   Config{CaseInsensitiveColumns: []string{"email"}, TrimText: true},
+			column:   column{name: "email", dataType: "character varying"},
+			expected: `lower(rtrim("email"::TEXT, E' \t\r\n'))`,
+		},
+		{
+			name:     "citext",
+			config:   Config{},
+			column:   column{name: "username", dataType: "citext"},
+			expected: `lower("username"::TEXT)`,
+		},
+		{
+			name:     "case insensitive columns only match by name",
+			config:   Config{CaseInsensitiveColumns: []string{"email"}},
+			column:   column{name: "username", dataType: "text"},
+			expected: `"username"::TEXT`,
+		},
+		{
+			name:     "large object column",
+			config:   Config{LargeObjectColumns: []string{"attachment"}},
+			column:   column{name: "attachment", dataType: "oid"},
+			expected: `md5(lo_get("attachment"))`,
+		},
+		{
+			name:     "naive timestamp",
+			column:   column{name: "created", dataType: "timestamp without time zone"},
+			expected: `"created"::TEXT`,
+		},
+		{
+			name:     "normalized naive timestamp",
+			config:   Config{NormalizeNaiveTimestamps: true, TimestampPrecision: TimestampPrecisionMilliseconds},
+			column:   column{name: "created", dataType: "timestamp without time zone"},
+			expected: `(extract(epoch from date_trunc('milliseconds', "created"))::DECIMAL * 1000000)::BIGINT::TEXT`,
+		},
+		{
+			name:     "system column",
+			config:   Config{SystemColumns: []string{"xmin"}},
+			column:   Config{SystemColumns: []string{"xmin"}}.systemColumns()[0],
+			expected: `"xmin"::TEXT`,
+		},
+		{
+			name:     "text options ignored for non-text types",
+			config:   Config{TrimText: true, NormalizeNewlines: true},
+			column:   column{name: "id", dataType: "integer"},
+			expected: `"id"::TEXT`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.column.CastToText(tc.config))
+		})
+	}
+}
+
+func TestEpochExpression(t *testing.T) {
+	// Whatever the precision, timestamps are converted to microseconds since
+	// the epoch, so that time window bounds can be compared in microseconds.
+	for _, precision := range TimestampPrecisions() {
+		t.Run(precision, func(t *testing.T) {
+			config := Config{TimestampPrecision: precision}
+			require.NoError(t, config.Validate())
+			require.Equal(t,
+				"(extract(epoch from date_trunc('"+precision+`', "ts"))::DECIMAL * 1000000)::BIGINT`,
+				epochExpression(config, `"ts"`))
+		})
+	}
+
+	require.NoError(t, Config{}.Validate())
+	require.Equal(t, epochExpression(Config{TimestampPrecision: TimestampPrecisionMilliseconds}, `"ts"`), epochExpression(Config{}, `"ts"`))
+}
+
+func TestDDLFingerprint(t *testing.T) {
+	columns := []column{
+		{name: "id", dataType: "integer", constraints: []string{"PRIMARY KEY", ""}},
+		{name: "content", dataType: "text", constraints: []string{""}},
+	}
+	reordered := []column{
+		{name: "content", dataType: "TEXT"},
+		{name: "id", dataType: "integer", constraints: []string{"PRIMARY KEY"}},
+	}
+	retyped := []column{
+		{name: "id", dataType: "integer", constraints: []string{"PRIMARY KEY"}},
+		{name: "content", dataType: "character varying"},
+	}
+
+	nullable := []column{
+		{name: "id", dataType: "integer", constraints: []string{"PRIMARY KEY"}},
+		{name: "content", dataType: "text", isNullable: true},
+	}
+
+	require.Equal(t, ddlFingerprint(columns), ddlFingerprint(reordered))
+	require.NotEqual(t, ddlFingerprint(columns), ddlFingerprint(retyped))
+	require.NotEqual(t, ddlFingerprint(columns), ddlFingerprint(nullable))
+}
+
+func TestColumnNullability(t *testing.T) {
+	columns := []column{
+		{name: "status", isNullable: true},
+		{name: "id"},
+	}
+
+	require.Equal(t, `"id"=NOT NULL, "status"=NULL`, columnNullability(columns))
+	require.Equal(t, []string{`"status"`}, divergingKeys([]string{
+		columnNullability(columns),
+		columnNullability([]column{{name: "status"}, {name: "id"}}),
+	}))
+}
+
+func TestCommentsFingerprint(t *testing.T) {
+	columns := []column{{name: "id"}, {name: "content"}}
+	reordered := []column{{name: "content"}, {name: "id"}}
+	comments := map[string]string{"id": "identifier", "content": "body text", "ignored": "not hashed"}
+
+	require.Equal(t, commentsFingerprint("table", columns, comments), commentsFingerprint("table", reordered, comments))
+	require.Equal(t, commentsFingerprint("table", columns, comments), commentsFingerprint("table", columns, map[string]string{"id": "identifier", "content": "body text"}))
+	require.NotEqual(t, commentsFingerprint("table", columns, comments), commentsFingerprint("other", columns, comments))
+	require.NotEqual(t, commentsFingerprint("table", columns, comments), commentsFingerprint("table", columns, map[string]string{"id": "identifier"}))
+}
+
+func TestNormalizeConstraintDef(t *testing.T) {
+	for _, tc := range []struct {
+		postgres    string
+		cockroachdb string
+	}{
+		{postgres: "CHECK ((price > 0))", cockroachdb: "CHECK (price > 0:::INT8)"},
+		{postgres: "CHECK ((status = ANY (ARRAY['new'::text, 'done'::text])))", cockroachdb: "CHECK (status = ANY (ARRAY['new':::STRING, 'done':::STRING]))"},
+		{postgres: "FOREIGN KEY (owner_id) REFERENCES owners(id)", cockroachdb: "FOREIGN KEY (owner_id) REFERENCES public.owners(id)"},
+		{postgres: "CHECK ((price > 0)) NOT VALID", cockroachdb: "CHECK (price > 0:::INT8)"},
+	} {
+		t.Run(tc.postgres, func(t *testing.T) {
+			require.Equal(t, normalizeConstraintDef(tc.postgres), normalizeConstraintDef(tc.cockroachdb))
+		})
+	}
+
+	require.NotEqual(t, normalizeConstraintDef("CHECK ((price > 0))"), normalizeConstraintDef("CHECK ((price >= 0))"))
+	require.NotEqual(t, normalizeConstraintDef("CHECK ((status = 'A B'::text))"), normalizeConstraintDef("CHECK (status = 'ab':::STRING)"))
+	require.Equal(t,
+		constraintsFingerprint([]string{"CHECK ((a > 0))", "CHECK ((b > 0))"}),
+		constraintsFingerprint([]string{"CHECK (b > 0)", "CHECK (a > 0)"}))
+	require.NotEqual(t,
+		constraintsFingerprint([]string{"CHECK ((a > 0))", "CHECK ((b > 0))"}),
+		constraintsFingerprint([]string{"CHECK ((a > 0))"}))
+}
+
+func TestCanonicalDataType(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+
+		config   Config
+		dataType string
+		expected string
+	}{
+		{name: "unaliased", dataType: "TEXT", expected: "text"},
+		{name: "int4", dataType: "int4", expected: "integer"},
+		{name: "int8", dataType: "INT8", expected: "bigint"},
+		{name: "canonical", dataType: "bigint", expected: "bigint"},
+		{
+			name:     "configured alias",
+			config:   Config{TypeAliases: map[string]string{"string": "text"}},
+			dataType: "STRING",
+			expected: "text",
+		},
+		{
+			name:     "overridden default alias",
+			config:   Config{TypeAliases: map[string]string{"int": "bigint"}},
+			dataType: "int",
+			expected: "bigint",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, canonicalDataType(tc.config, tc.dataType))
+		})
+	}
+}
+
+func TestNormalizeDefaultExpr(t *testing.T) {
+	for _, tc := range []struct {
+		postgres    string
+		cockroachdb string
+	}{
+		{postgres: "0", cockroachdb: "0:::INT8"},
+		{postgres: "'foo'::text", cockroachdb: "'foo':::STRING"},
+		{postgres: "now()", cockroachdb: "now():::TIMESTAMPTZ"},
+		{postgres: "CURRENT_TIMESTAMP", cockroachdb: "current_timestamp():::TIMESTAMPTZ"},
+		{postgres: "nextval('seq'::regclass)", cockroachdb: "nextval('public.seq'::REGCLASS)"},
+		{postgres: "'pending'::character varying", cockroachdb: "'pending':::STRING"},
+	} {
+		t.Run(tc.postgres, func(t *testing.T) {
+			require.Equal(t, normalizeDefaultExpr(tc.postgres), normalizeDefaultExpr(tc.cockroachdb))
+		})
+	}
+
+	require.NotEqual(t, normalizeDefaultExpr("0"), normalizeDefaultExpr("1:::INT8"))
+	require.NotEqual(t, normalizeDefaultExpr("'Foo Bar'::text"), normalizeDefaultExpr("'foobar':::STRING"))
+	require.NotEqual(t, normalizeDefaultExpr("'it''s'::text"), normalizeDefaultExpr("'IT''S'::text"))
+}
+
+func TestColumnDefaults(t *testing.T) {
+	columns := []column{
+		{name: "status", defaultExpr: "'new'::text"},
+		{name: "id"},
+		{name: "created", defaultExpr: "now()"},
+	}
+
+	require.Equal(t, "created=now(); status='new'", columnDefaults(columns))
+}
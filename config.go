@@ -2,6 +2,11 @@ package pgverify
 
 import (
 	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -26,7 +31,89 @@ const (
 	// A rowcount test simply compares table row counts between targets.
 	TestModeRowCount = "rowcount"
 
+	// A DDL test compares a fingerprint of each table's column names, data types,
+	// nullability, and constraints, without querying any table data.
+	TestModeDDL = "ddl"
+
+	// A nullability test compares whether each column of each table allows
+	// NULL values, reporting which columns differ, without querying any table
+	// data.
+	TestModeNullability = "nullability"
+
+	// A defaults test compares the normalized default expressions of each
+	// table's columns, without querying any table data.
+	TestModeDefaults = "defaults"
+
+	// A comments test compares the comments on each table and its columns,
+	// without querying any table data.
+	TestModeComments = "comments"
+
+	// A constraints test compares the normalized CHECK and FOREIGN KEY
+	// constraint definitions of each table, without querying any table data.
+	TestModeConstraints = "constraints"
+
+	// A histogram test compares the number of rows in each bucket of an
+	// expression configured per table with WithHistogramColumn, such as a
+	// status column or a truncated timestamp. Tables without a configured
+	// expression are not compared.
+	TestModeHistogram = "histogram"
+
+	// A columns test hashes each column of a table separately, alongside the
+	// primary key, reporting which columns differ. The queries for a table
+	// run concurrently over up to ColumnParallelism connections per target.
+	TestModeColumns = "columns"
+
+	// A distinct test compares the number of distinct values of each column,
+	// or of the columns selected with WithDistinctColumns, reporting which
+	// columns differ. It is a cheap signal that a column's set of values has
+	// diverged, e.g. a missing category, without hashing every row.
+	TestModeDistinct = "distinct"
+
+	// An existence test only checks that each table is present on every
+	// target, without querying the tables. It is the fastest check that the
+	// same set of tables is deployed, e.g. before hashing table data.
+	TestModeExistence = "existence"
+
+	// A selfcheck test hashes a small fixed dataset on each target before
+	// verifying any tables, confirming that the engines agree on the hashing
+	// primitives that every other test relies on.
+	TestModeSelfCheck = "selfcheck"
+
+	// Precision levels timestamps are truncated to before comparison, as
+	// units accepted by date_trunc on both PostgreSQL and CockroachDB.
+	TimestampPrecisionSeconds      = "seconds"
 	TimestampPrecisionMilliseconds = "milliseconds"
+	TimestampPrecisionMicroseconds = "microseconds"
+
+	// Environment variables that override the default test modes (comma
+	// separated), bookend limit, and sparse mod. Options, including CLI flags,
+	// take precedence over the environment.
+	EnvTestModes    = "PGVERIFY_TESTS"
+	EnvBookendLimit = "PGVERIFY_BOOKEND_LIMIT"
+	EnvSparseMod    = "PGVERIFY_SPARSE_MOD"
+
+	// The information_schema views are the default source for table and column
+	// metadata, as they are standardized between engines.
+	CatalogSourceInformationSchema = "information_schema"
+	// The pg_catalog tables can be used as an alternative source for table and
+	// column metadata, e.g. when the information_schema views are filtered by
+	// role on managed offerings.
+	CatalogSourcePgCatalog = "pg_catalog"
+
+	// By default, columns are concatenated in alphabetical order of their
+	// casted expressions when hashing rows, which is consistent between
+	// engines regardless of how the tables were created.
+	ColumnOrderAlphabetical = "alphabetical"
+	// Columns can instead be concatenated in their ordinal position, e.g. to
+	// match hashes computed externally from the physical column order.
+	ColumnOrderOrdinal = "ordinal"
+
+	// The number of row hashes aggregated together at a time by default.
+	DefaultAggregateGroupSize = 10000
+
+	// The application_name set on connections to the targets by default, so
+	// that pgverify sessions can be identified in pg_stat_activity.
+	DefaultApplicationName = "pgverify"
 )
 
 // Config represents the configuration for running a verification.
@@ -39,26 +126,305 @@ type Config struct {
 	ExcludeSchemas []string
 	IncludeColumns []string
 	ExcludeColumns []string
+	// ExcludeColumnTypes is a list of data types for which columns are
+	// skipped in every table, regardless of the column filters.
+	ExcludeColumnTypes []string
+	// ExcludeSystemSchemas skips the system and temporary schemas of
+	// PostgreSQL and CockroachDB, in addition to ExcludeSchemas.
+	ExcludeSystemSchemas bool
+	// SchemaPatterns are glob patterns, using * and ?, of which schemas must
+	// match at least one, in addition to the other schema filters.
+	SchemaPatterns []string
 
 	// TestModes is a list of test modes to run, executed in order.
 	TestModes []string
+	// TableTestModes overrides TestModes for specific tables, stored with the
+	// schema:
+	//   TableTestModes[schema.table] = [mode1, ...]
+	TableTestModes map[string][]string
 	// BookendLimit is the number of rows to include when running a bookend test.
 	BookendLimit int
 	// SparseMod is used in the sparse test mode to deterministically select a
 	// subset of rows, approximately 1/mod of the total.
 	SparseMod int
+	// RowCountTolerance is the maximum difference between row counts in the
+	// rowcount test mode for them to still be considered matching.
+	RowCountTolerance int
 
 	// Aliases is a list of aliases to use for the target databases in reporting
-	// output. Is ignored if the number of aliases is not equal to the number of
-	// supplied targets.
+	// and logging output, matched to the targets by index. Targets without an
+	// alias, or with an empty one, are named user@host:port/database.
 	Aliases []string
 
 	// TimestampPrecision is the precision level to use when comparing timestamp values.
+	// Empty means milliseconds.
 	TimestampPrecision string
 
+	// CatalogSource is the source of the table and column metadata queries,
+	// either information_schema or pg_catalog.
+	CatalogSource string
+
+	// ColumnOrder is the order columns are concatenated in when hashing rows,
+	// either alphabetical or ordinal.
+	ColumnOrder string
+
+	// TrimText and NormalizeNewlines relax the comparison of text-like columns
+	// by trimming trailing whitespace and converting CRLF line endings to LF
+	// respectively before hashing. Both change what is considered "equal" and
+	// are disabled by default.
+	TrimText          bool
+	NormalizeNewlines bool
+	// NormalizeNaiveTimestamps hashes timestamp without time zone columns as
+	// epochs, treating them as UTC, like timestamp with time zone columns,
+	// rather than by their text representation.
+	NormalizeNaiveTimestamps bool
+	// CaseInsensitiveColumns are the names of columns that are lowercased
+	// before hashing, so values differing only by case are considered equal.
+	// Columns of the citext type are always lowercased.
+	CaseInsensitiveColumns []string
+
+	// TypeAliases maps lowercased data type names to the canonical name they
+	// are treated as, in addition to the built in integer aliases. Column data
+	// types are resolved through the aliases when read, so TypeCasts should be
+	// keyed by the canonical name.
+	TypeAliases map[string]string
+	// LargeObjectColumns are the names of oid columns referencing large
+	// objects, which are compared by the contents of the large object rather
+	// than by OID.
+	LargeObjectColumns []string
+	// SystemColumns are the names of system columns, such as xmin and ctid,
+	// hashed in every table alongside its other columns, as a debugging aid.
+	SystemColumns []string
+
+	// TypeCasts overrides how columns of a given data type are cast to text,
+	// keyed by the lowercased data type. Each value is a format string with a
+	// single %s verb, which is replaced by the column name.
+	TypeCasts map[string]string
+	// RowHashExpression overrides how each row is hashed. It is a format
+	// string with a single %s verb, which is replaced by the comma separated
+	// columns cast to text, in hashing order. Empty means MD5(CONCAT(%s)).
+	RowHashExpression string
+	// RequireEngine fails the verification before running any tests if the
+	// engine of any target, as reported by version(), is not this engine,
+	// optionally with a version prefix, e.g. "PostgreSQL 14". Any engine is
+	// allowed if empty.
+	RequireEngine string
+	// StrictTypes causes verification to fail when a column has a type that
+	// cannot be reliably compared between engines and no type cast override
+	// is configured for it. Otherwise, such columns are skipped with a warning.
+	StrictTypes bool
+	// AllowNoPrimaryKey verifies tables without a primary key with an
+	// order-independent hash of their rows in the full test, rather than
+	// failing them. The bookend and sparse tests are skipped for such tables.
+	AllowNoPrimaryKey bool
+
+	// StatementTimeout is the server-side statement_timeout set on each target
+	// connection, after which the server cancels a query. Zero means no timeout
+	// is set.
+	StatementTimeout time.Duration
+	// LockTimeout is the server-side lock_timeout set on each target
+	// connection, after which the server cancels a query waiting for a lock.
+	// Zero means no timeout is set.
+	LockTimeout time.Duration
+
+	// ConsistentSnapshot runs all of the queries on each target in a single
+	// REPEATABLE READ transaction, so that every test on the target sees the
+	// same point in time, even while the target is being written to.
+	ConsistentSnapshot bool
+	// BatchedConsistentRun sends all of the test queries on each target in a
+	// single batch, within the consistent snapshot, in place of batches of
+	// QueryBatchSize.
+	BatchedConsistentRun bool
+
+	// AsOfSystemTime runs all of the queries on each CockroachDB target in a
+	// single transaction reading the data as of this system time, e.g. a
+	// timestamp or a negative interval such as "-10s". Ignored on PostgreSQL
+	// targets.
+	AsOfSystemTime string
+
+	// ApplicationName is the application_name set on connections to the
+	// targets, unless already set by the target's connection config. Empty
+	// means none is set.
+	ApplicationName string
+
+	// MaxTables is the maximum number of tables to verify on a target, as a
+	// safety limit. Zero means no limit.
+	MaxTables int
+
+	// QueryBatchSize is the number of test queries sent to a target in a single
+	// batch. Values less than 2 disable batching.
+	QueryBatchSize int
+
+	// ColumnParallelism is the number of connections opened to each target
+	// to run the per-column queries of the columns test concurrently. Values
+	// below 2 run them one at a time on the target's connection.
+	ColumnParallelism int
+
+	// OnlyShowMismatches omits tables where all test outputs match from the
+	// reporting output.
+	OnlyShowMismatches bool
+	// GroupBySchema outputs a separate table for each schema in the table
+	// report, rather than a single table.
+	GroupBySchema bool
+
+	// RowFilters are SQL predicates applied on every target when querying a
+	// table, stored with the schema:
+	//   RowFilters[schema.table] = predicate
+	RowFilters map[string]string
+	// TargetRowFilters are SQL predicates applied only to the named target when
+	// querying a table, stored with the schema:
+	//   TargetRowFilters[targetName][schema.table] = predicate
+	TargetRowFilters map[string]map[string]string
+
+	// ExcludedPrimaryKeys are the primary keys of rows excluded from the
+	// comparison, as SQL literals, stored with the schema:
+	//   ExcludedPrimaryKeys[schema.table] = [key1, ...]
+	ExcludedPrimaryKeys map[string][]string
+
+	// Throughput reports the rate at which each table was hashed on each
+	// target, using the row counts from the rowcount test mode.
+	Throughput bool
+
+	// ReportHashedColumns adds a table of the columns hashed in each table on
+	// each target to the table report. They are always included in the JSON
+	// report.
+	ReportHashedColumns bool
+
+	// TargetSchemas maps the schema names used to compare results between
+	// targets to the physical schema names on a specific target, stored with
+	// the schema:
+	//   TargetSchemas[targetName][schema] = physicalSchema
+	TargetSchemas map[string]map[string]string
+
+	// ShardedTables are tables split across multiple physical tables on a
+	// specific target, verified as the union of their shards under the
+	// logical name, stored with the schema:
+	//   ShardedTables[targetName][schema.table] = [shard1, ...]
+	ShardedTables map[string]map[string][]string
+	// The shards of the sharded tables on the target being verified, stored
+	// with the physical schema, and the logical table name of each shard.
+	shardedTables      map[string][]string
+	shardLogicalTables map[string]string
+
+	// ModifiedSince limits verification to tables that table statistics
+	// suggest have been modified on any target since the given time, if not
+	// zero. All tables are verified if statistics are unavailable.
+	ModifiedSince time.Time
+	// The tables found to be modified since ModifiedSince, or nil if all
+	// tables should be verified.
+	modifiedTables map[string]bool
+
+	// ExplainThreshold is the number of rows, estimated by EXPLAIN on any
+	// target, above which a warning is raised before running the full test on
+	// a table, if greater than zero. With SkipOverExplainThreshold, the full
+	// test is skipped for such tables on every target.
+	ExplainThreshold         int64
+	SkipOverExplainThreshold bool
+	// The tables estimated to exceed ExplainThreshold on any target, with
+	// the largest estimate for each.
+	overExplainThresholdTables map[string]int64
+
+	// ShardIndex and ShardCount restrict the full test to the rows in shard
+	// ShardIndex of ShardCount, bucketed by primary key, if ShardCount is
+	// greater than one. Running every shard on separate workers together
+	// verifies every row.
+	ShardIndex int
+	ShardCount int
+
+	// AggregateSeparator is the separator row hashes are concatenated with
+	// before being hashed together. Empty by default, as the hashes are of a
+	// fixed width.
+	AggregateSeparator string
+	// AggregateGroupSize is the number of row hashes aggregated together at
+	// a time in the full and sparse tests, bounding the memory used to hash
+	// large tables. Zero means DefaultAggregateGroupSize.
+	AggregateGroupSize int
+
+	// ChunkSize, if positive, runs the full test on tables with a primary key
+	// in chunks of this many rows, each hashed by a separate bounded query,
+	// and compares the combined hash of the chunks.
+	ChunkSize int
+
+	// FailOnNoTables fails the verification of a target without any tables
+	// to verify after filtering, which otherwise only raises a warning.
+	FailOnNoTables bool
+
+	// SkipEmptyTables skips verifying tables that have no rows on every
+	// target. Tables empty on only some targets are still verified.
+	SkipEmptyTables bool
+	// The tables found to be empty on every target, when SkipEmptyTables is
+	// set.
+	emptyTables map[string]bool
+
+	// BookendAsFull runs the full test in place of the bookend test on tables
+	// estimated to have fewer than twice BookendLimit rows on every target,
+	// where the bookend test would hash the whole table anyway. Otherwise, a
+	// warning is raised for such tables.
+	BookendAsFull bool
+	// The tables estimated to be too small for the bookend test, with their
+	// estimated row counts.
+	smallBookendTables map[string]int64
+
+	// LatestPartitions restricts verification of partitioned tables to their
+	// newest LatestPartitions partitions, ordered by range partition bound, if
+	// greater than zero. The partitioned parent tables, which would scan every
+	// partition, are skipped unless VerifyPartitionParents is set.
+	LatestPartitions       int
+	VerifyPartitionParents bool
+	// The partitions, and partitioned parent tables, to skip when
+	// LatestPartitions is set.
+	skippedPartitions map[string]bool
+
+	// SampleSeed selects which subset of rows is checked by sampling test
+	// modes, such as sparse. The same seed always selects the same rows, on
+	// every target and across runs.
+	SampleSeed int64
+
+	// SampleTablesPercent restricts verification to approximately the given
+	// percentage of tables, if greater than zero. The tables are selected by
+	// SampleTablesSeed, so the same tables are selected on every target and
+	// across runs.
+	SampleTablesPercent float64
+	SampleTablesSeed    int64
+
+	// TimeWindows restrict the rows verified in a table to those with a
+	// timestamp column value within a time window, stored with the schema:
+	//   TimeWindows[schema.table] = window
+	TimeWindows map[string]TimeWindow
+
+	// HistogramColumns are the SQL expressions that rows are bucketed by in
+	// the histogram test mode, stored with the schema:
+	//   HistogramColumns[schema.table] = expression
+	HistogramColumns map[string]string
+
+	// DistinctColumns are the names of the columns compared in the distinct
+	// test mode. All hashed columns are compared if empty.
+	DistinctColumns []string
+
+	// RedactHashes replaces test outputs derived from table data, such as
+	// hashes, with a placeholder of their prefix and length in logs, reports,
+	// and errors. Outputs are still compared in full.
+	RedactHashes bool
+
+	// Tracer creates spans around connecting to targets, enumerating tables,
+	// and running test queries. Tracing is disabled if nil.
+	Tracer Tracer
+
+	// TableCallback is called with the outcome of each test query run against
+	// a table, concurrently from each target. Disabled if nil.
+	TableCallback func(TableVerification)
+
 	Logger log.FieldLogger
 }
 
+// TimeWindow is a half-open range of time, including Since but excluding
+// Until, matched against the values of a timestamp column.
+type TimeWindow struct {
+	Column string    `json:"column"`
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until"`
+}
+
 // Option interface used for setting optional config properties.
 type Option interface {
 	apply(*Config)
@@ -70,8 +436,8 @@ func (o optionFunc) apply(c *Config) {
 	o(c)
 }
 
-// NewConfig returns a new Config with default values overridden
-// by the supplied Options.
+// NewConfig returns a new Config with default values overridden by any
+// environment variables, and then by the supplied Options.
 func NewConfig(opts ...Option) Config {
 	c := Config{}
 	defaultOpts := []Option{
@@ -80,7 +446,11 @@ func NewConfig(opts ...Option) Config {
 		WithBookendLimit(TestModeBookendDefaultLimit),
 		WithSparseMod(TestModeSparseDefaultMod),
 		WithTimestampPrecision(TimestampPrecisionMilliseconds),
+		WithCatalogSource(CatalogSourceInformationSchema),
+		WithColumnOrder(ColumnOrderAlphabetical),
+		WithApplicationName(DefaultApplicationName),
 	}
+	defaultOpts = append(defaultOpts, envOptions()...)
 
 	for _, opt := range append(defaultOpts, opts...) {
 		opt.apply(&c)
@@ -89,22 +459,234 @@ func NewConfig(opts ...Option) Config {
 	return c
 }
 
+// envOptions returns the Options overriding the defaults with values from the
+// environment. Invalid values are ignored with a warning.
+func envOptions() []Option {
+	var opts []Option
+
+	if testModes, ok := os.LookupEnv(EnvTestModes); ok && testModes != "" {
+		modes := strings.Split(testModes, ",")
+		for i, mode := range modes {
+			modes[i] = strings.TrimSpace(mode)
+		}
+
+		opts = append(opts, WithTests(modes...))
+	}
+
+	for name, opt := range map[string]func(int) optionFunc{
+		EnvBookendLimit: WithBookendLimit,
+		EnvSparseMod:    WithSparseMod,
+	} {
+		value, ok := os.LookupEnv(name)
+		if !ok || value == "" {
+			continue
+		}
+
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			log.StandardLogger().WithError(err).Warnf("Ignoring invalid %s value %q", name, value)
+
+			continue
+		}
+
+		opts = append(opts, opt(intValue))
+	}
+
+	return opts
+}
+
+// ErrInvalidTestMode is returned when validating a configuration containing an
+// unknown test mode.
+type ErrInvalidTestMode struct {
+	Mode string
+}
+
+func (e ErrInvalidTestMode) Error() string {
+	return fmt.Sprintf("invalid test mode: %s", e.Mode)
+}
+
 // Validate checks that the configuration contains valid values.
 func (c Config) Validate() error {
-	for _, mode := range c.TestModes {
+	for _, mode := range c.allTestModes() {
 		switch mode {
 		case TestModeBookend:
-		case TestModeFull:
-		case TestModeRowCount:
+			if c.BookendLimit <= 0 {
+				return fmt.Errorf("invalid bookend limit: %d, must be positive", c.BookendLimit)
+			}
 		case TestModeSparse:
+			// Zero would cause a division by zero in the generated query.
+			if c.SparseMod <= 0 {
+				return fmt.Errorf("invalid sparse mod: %d, must be positive", c.SparseMod)
+			}
 		default:
-			return fmt.Errorf("invalid strategy: %s", c.TestModes)
+			if _, ok := lookupTestMode(mode); !ok && !unregisteredTestModes[mode] {
+				return ErrInvalidTestMode{Mode: mode}
+			}
+		}
+	}
+
+	if c.ColumnParallelism < 0 {
+		return fmt.Errorf("invalid column parallelism: %d, must not be negative", c.ColumnParallelism)
+	}
+
+	if c.SampleTablesPercent < 0 || c.SampleTablesPercent > 100 {
+		return fmt.Errorf("invalid sample tables percent: %v, must be between 0 and 100", c.SampleTablesPercent)
+	}
+
+	if c.LatestPartitions < 0 {
+		return fmt.Errorf("invalid latest partitions: %d, must not be negative", c.LatestPartitions)
+	}
+
+	if c.AggregateGroupSize < 0 {
+		return fmt.Errorf("invalid aggregate group size: %d, must not be negative", c.AggregateGroupSize)
+	}
+
+	for _, name := range c.SystemColumns {
+		if _, ok := systemColumnTypes[name]; !ok {
+			return fmt.Errorf("invalid system column: %s, must be one of %s", name, strings.Join(sortedKeys(systemColumnTypes), ", "))
+		}
+	}
+
+	if err := c.validateRowHashExpression(); err != nil {
+		return err
+	}
+
+	for _, dataType := range sortedKeys(c.TypeCasts) {
+		expression := c.TypeCasts[dataType]
+		if strings.Count(expression, "%s") != 1 || strings.Contains(fmt.Sprintf(expression, "column"), "%!") {
+			return fmt.Errorf("invalid type cast for %s: %q, must be a format string with a single %%s verb", dataType, expression)
+		}
+	}
+
+	for targetName, tables := range c.ShardedTables {
+		for table, physicalTables := range tables {
+			if len(physicalTables) == 0 {
+				return fmt.Errorf("invalid sharded table %s on target %s: no physical tables", table, targetName)
+			}
+		}
+	}
+
+	if c.ChunkSize < 0 {
+		return fmt.Errorf("invalid chunk size: %d, must not be negative", c.ChunkSize)
+	}
+
+	if c.ShardCount < 0 || c.ShardIndex < 0 || (c.ShardCount > 0 && c.ShardIndex >= c.ShardCount) {
+		return fmt.Errorf("invalid shard: %d of %d, must be between 0 and the number of shards", c.ShardIndex, c.ShardCount)
+	}
+
+	if c.usesTestMode(TestModeHistogram) && len(c.HistogramColumns) == 0 {
+		return fmt.Errorf("the %s test mode requires at least one histogram column", TestModeHistogram)
+	}
+
+	if c.Throughput && !c.hasTestMode(TestModeRowCount) {
+		return fmt.Errorf("reporting throughput requires the %s test mode", TestModeRowCount)
+	}
+
+	for table, window := range c.TimeWindows {
+		if !window.Until.After(window.Since) {
+			return fmt.Errorf("invalid time window for %s: %s is not after %s", table, window.Until, window.Since)
 		}
 	}
 
+	if c.TimestampPrecision != "" && !containsString(TimestampPrecisions(), c.TimestampPrecision) {
+		return fmt.Errorf("invalid timestamp precision: %q, must be one of %s", c.TimestampPrecision, strings.Join(TimestampPrecisions(), ", "))
+	}
+
+	switch c.CatalogSource {
+	case "", CatalogSourceInformationSchema:
+	case CatalogSourcePgCatalog:
+	default:
+		return fmt.Errorf("invalid catalog source: %s", c.CatalogSource)
+	}
+
+	switch c.ColumnOrder {
+	case "", ColumnOrderAlphabetical:
+	case ColumnOrderOrdinal:
+	default:
+		return fmt.Errorf("invalid column order: %s", c.ColumnOrder)
+	}
+
 	return nil
 }
 
+// allTestModes returns the test modes configured to run, either for all
+// tables or overridden for specific tables, without duplicates.
+func (c Config) allTestModes() []string {
+	seen := make(map[string]bool)
+
+	var testModes []string
+
+	add := func(modes []string) {
+		for _, mode := range modes {
+			if !seen[mode] {
+				seen[mode] = true
+
+				testModes = append(testModes, mode)
+			}
+		}
+	}
+
+	add(c.TestModes)
+
+	for _, table := range sortedKeys(c.TableTestModes) {
+		add(c.TableTestModes[table])
+	}
+
+	return testModes
+}
+
+// tableTestModes returns the test modes that are run on any table, which
+// excludes the selfcheck test run once per target.
+func (c Config) tableTestModes() []string {
+	return withoutSelfCheck(c.allTestModes())
+}
+
+// testModesForTable returns the test modes to run on the table, which are
+// those overridden for the table, if any, or otherwise those configured for
+// all tables.
+func (c Config) testModesForTable(schemaName, tableName string) []string {
+	if testModes, ok := c.TableTestModes[qualifiedTableName(schemaName, tableName)]; ok {
+		return withoutSelfCheck(testModes)
+	}
+
+	return withoutSelfCheck(c.TestModes)
+}
+
+// withoutSelfCheck returns the test modes other than selfcheck.
+func withoutSelfCheck(modes []string) []string {
+	var testModes []string
+
+	for _, mode := range modes {
+		if mode != TestModeSelfCheck {
+			testModes = append(testModes, mode)
+		}
+	}
+
+	return testModes
+}
+
+// usesTestMode returns whether the test mode is configured to run on any
+// table.
+func (c Config) usesTestMode(testMode string) bool {
+	return containsString(c.allTestModes(), testMode)
+}
+
+// hasTestMode returns whether the test mode is configured to run.
+func (c Config) hasTestMode(testMode string) bool {
+	return containsString(c.TestModes, testMode)
+}
+
+// containsString returns whether the value is in the list of values.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
 // WithLogger sets the logger configuration.
 func WithLogger(logger log.FieldLogger) optionFunc {
 	return func(c *Config) {
@@ -154,6 +736,14 @@ func IncludeColumns(columns ...string) optionFunc {
 	}
 }
 
+// WithExcludeColumnTypes sets the data types of columns to skip verification
+// of, e.g. to avoid hashing large bytea columns.
+func WithExcludeColumnTypes(dataTypes ...string) optionFunc {
+	return func(c *Config) {
+		c.ExcludeColumnTypes = dataTypes
+	}
+}
+
 // WithTests defines the tests to run.
 func WithTests(testModes ...string) optionFunc {
 	return func(c *Config) {
@@ -177,14 +767,20 @@ func WithSparseMod(mod int) optionFunc {
 	}
 }
 
-// WithAliases sets the aliases for the target databases. Is ignored if not equal
-// to the number of targets.
+// WithAliases sets the aliases for the target databases, matched to targets by
+// index. Targets without a corresponding non-empty alias are named by their
+// user@host:port/database.
 func WithAliases(aliases []string) optionFunc {
 	return func(c *Config) {
 		c.Aliases = aliases
 	}
 }
 
+// TimestampPrecisions lists the supported timestamp precision levels.
+func TimestampPrecisions() []string {
+	return []string{TimestampPrecisionSeconds, TimestampPrecisionMilliseconds, TimestampPrecisionMicroseconds}
+}
+
 // WithTimestampPrecision sets the precision level to use when comparing
 // timestamp values. This can be useful for addressing precision differences
 // between engines, i.e. millisecond vs. microsecond.
@@ -193,3 +789,632 @@ func WithTimestampPrecision(precision string) optionFunc {
 		c.TimestampPrecision = precision
 	}
 }
+
+// WithTrimText trims trailing whitespace from text-like columns before hashing,
+// so that values differing only by trailing whitespace are considered equal.
+func WithTrimText() optionFunc {
+	return func(c *Config) {
+		c.TrimText = true
+	}
+}
+
+// WithNormalizeNewlines converts CRLF line endings to LF in text-like columns
+// before hashing, so that values differing only by line endings are considered
+// equal.
+func WithNormalizeNewlines() optionFunc {
+	return func(c *Config) {
+		c.NormalizeNewlines = true
+	}
+}
+
+// WithTargetRowFilter sets a SQL predicate that filters the rows of a table on
+// a single target, for example when the target is a logical replication
+// subscriber to a publication with a row filter. The target name is the alias
+// if configured, otherwise user@host:port/database. The predicate is not
+// sanitized.
+func WithTargetRowFilter(targetName, schema, table, whereClause string) optionFunc {
+	return func(c *Config) {
+		if c.TargetRowFilters == nil {
+			c.TargetRowFilters = make(map[string]map[string]string)
+		}
+
+		if _, ok := c.TargetRowFilters[targetName]; !ok {
+			c.TargetRowFilters[targetName] = make(map[string]string)
+		}
+
+		c.TargetRowFilters[targetName][qualifiedTableName(schema, table)] = whereClause
+	}
+}
+
+// WithTypeCast overrides how columns of the given data type are cast to text
+// before hashing. The expression is a format string with a single %s verb,
+// which is replaced by the column name, e.g. "ST_AsText(%s)". This also allows
+// columns with types that are otherwise skipped as incomparable to be hashed.
+func WithTypeCast(dataType, expression string) optionFunc {
+	return func(c *Config) {
+		if c.TypeCasts == nil {
+			c.TypeCasts = make(map[string]string)
+		}
+
+		c.TypeCasts[strings.ToLower(dataType)] = expression
+	}
+}
+
+// WithStrictTypes causes verification to fail when a column has a type that
+// cannot be reliably compared between engines, e.g. geometric, full text
+// search, and range types, unless a type cast override is configured for it.
+// By default such columns are skipped with a warning.
+func WithStrictTypes() optionFunc {
+	return func(c *Config) {
+		c.StrictTypes = true
+	}
+}
+
+// WithOnlyShowMismatches omits tables where all test outputs match from the
+// reporting output, so that only mismatches and errors are shown.
+func WithOnlyShowMismatches() optionFunc {
+	return func(c *Config) {
+		c.OnlyShowMismatches = true
+	}
+}
+
+// WithStatementTimeout sets the statement_timeout on each target connection, so
+// that the server cancels queries which run longer than the given duration.
+func WithStatementTimeout(timeout time.Duration) optionFunc {
+	return func(c *Config) {
+		c.StatementTimeout = timeout
+	}
+}
+
+// WithLockTimeout sets the lock_timeout on each target connection, so that
+// queries blocked behind locks, such as those taken by concurrent DDL, fail
+// with a "(lock timeout)" output rather than waiting indefinitely.
+func WithLockTimeout(timeout time.Duration) optionFunc {
+	return func(c *Config) {
+		c.LockTimeout = timeout
+	}
+}
+
+// WithCatalogSource sets the source of the table and column metadata queries,
+// either information_schema (the default) or pg_catalog.
+func WithCatalogSource(source string) optionFunc {
+	return func(c *Config) {
+		c.CatalogSource = source
+	}
+}
+
+// WithGroupBySchema outputs a separate table for each schema in the table
+// report, each under a schema heading, which makes large reports easier to
+// navigate.
+func WithGroupBySchema() optionFunc {
+	return func(c *Config) {
+		c.GroupBySchema = true
+	}
+}
+
+// WithQueryBatchSize sends test queries to each target in batches of the given
+// size, reducing the overhead of network round trips on high latency
+// connections. A failed query also fails the queries after it in its batch.
+func WithQueryBatchSize(size int) optionFunc {
+	return func(c *Config) {
+		c.QueryBatchSize = size
+	}
+}
+
+// WithRowCountTolerance sets the maximum difference between row counts in the
+// rowcount test mode for them to still be considered matching, e.g. to allow
+// for replication lag. Defaults to 0, requiring exact matches.
+func WithRowCountTolerance(tolerance int) optionFunc {
+	return func(c *Config) {
+		c.RowCountTolerance = tolerance
+	}
+}
+
+// WithMaxTables sets the maximum number of tables to verify on a target.
+// Verification is aborted if more tables are found, guarding against
+// accidentally running against far more of a database than intended.
+func WithMaxTables(limit int) optionFunc {
+	return func(c *Config) {
+		c.MaxTables = limit
+	}
+}
+
+// WithTypeAlias treats the given data type as equivalent to the canonical data
+// type, e.g. to reconcile differently named but equivalent types between
+// engines. The built in aliases can be overridden this way.
+func WithTypeAlias(alias, canonical string) optionFunc {
+	return func(c *Config) {
+		if c.TypeAliases == nil {
+			c.TypeAliases = make(map[string]string)
+		}
+
+		c.TypeAliases[strings.ToLower(alias)] = strings.ToLower(canonical)
+	}
+}
+
+// WithTimeWindow restricts verification of the table to rows where the
+// timestamp column is at or after since and before until, e.g. to cheaply
+// verify the latest partition of an append-only table. The column is compared
+// at the configured timestamp precision, consistent with how it is hashed.
+func WithTimeWindow(schema, table, column string, since, until time.Time) optionFunc {
+	return func(c *Config) {
+		if c.TimeWindows == nil {
+			c.TimeWindows = make(map[string]TimeWindow)
+		}
+
+		c.TimeWindows[qualifiedTableName(schema, table)] = TimeWindow{Column: column, Since: since, Until: until}
+	}
+}
+
+// WithThroughput enables reporting the rate at which each table is hashed on
+// each target, e.g. to estimate the duration of a full verification. It
+// requires the rowcount test mode, which provides the number of rows.
+func WithThroughput() optionFunc {
+	return func(c *Config) {
+		c.Throughput = true
+	}
+}
+
+// WithColumnOrder sets the order columns are concatenated in when hashing
+// rows, either alphabetical or ordinal.
+func WithColumnOrder(order string) optionFunc {
+	return func(c *Config) {
+		c.ColumnOrder = order
+	}
+}
+
+// WithTracer sets the Tracer used to create spans around the stages of the
+// verification, as children of any span carried by the context.
+func WithTracer(tracer Tracer) optionFunc {
+	return func(c *Config) {
+		c.Tracer = tracer
+	}
+}
+
+// WithTargetSchema maps a schema to a differently named physical schema on the
+// named target, so the tables in it are compared with those in the schema of
+// the same name on the other targets. Schema filters and table-specific
+// options refer to the schema by its compared name, not the physical name.
+func WithTargetSchema(targetName, schema, physicalSchema string) optionFunc {
+	return func(c *Config) {
+		if c.TargetSchemas == nil {
+			c.TargetSchemas = make(map[string]map[string]string)
+		}
+
+		if _, ok := c.TargetSchemas[targetName]; !ok {
+			c.TargetSchemas[targetName] = make(map[string]string)
+		}
+
+		c.TargetSchemas[targetName][schema] = physicalSchema
+	}
+}
+
+// WithModifiedSince limits verification to tables that have been modified
+// since the given time, e.g. for incremental nightly runs. Modifications are
+// detected using the pg_stat_user_tables statistics, which may not reflect
+// very recent modifications and are unavailable on CockroachDB, in which case
+// all tables are verified.
+func WithModifiedSince(since time.Time) optionFunc {
+	return func(c *Config) {
+		c.ModifiedSince = since
+	}
+}
+
+// WithSampleSeed sets the seed used to select the rows checked by sampling
+// test modes, such as sparse. Each seed selects a different but reproducible
+// subset of rows, while the default of zero keeps the original selection.
+func WithSampleSeed(seed int64) optionFunc {
+	return func(c *Config) {
+		c.SampleSeed = seed
+	}
+}
+
+// WithHistogramColumn configures the SQL expression that the rows of a table
+// are bucketed by in the histogram test mode, e.g. a status column or
+// "date_trunc('day', created_at)". The expression is cast to text, and should
+// have a low number of distinct values since the count of every bucket is
+// reported.
+func WithHistogramColumn(schema, table, expression string) optionFunc {
+	return func(c *Config) {
+		if c.HistogramColumns == nil {
+			c.HistogramColumns = make(map[string]string)
+		}
+
+		c.HistogramColumns[qualifiedTableName(schema, table)] = expression
+	}
+}
+
+// WithAllowNoPrimaryKey verifies tables without a primary key, which
+// otherwise fail verification, by hashing their rows in the full test with an
+// order-independent aggregate. The bookend and sparse tests, which select
+// rows by primary key, are skipped for such tables. This is intended for small
+// lookup tables, as rows cannot be aligned to report which ones differ.
+func WithAllowNoPrimaryKey() optionFunc {
+	return func(c *Config) {
+		c.AllowNoPrimaryKey = true
+	}
+}
+
+// WithColumnParallelism runs the per-column queries of the columns test mode
+// concurrently over the given number of connections to each target, opening
+// additional connections as needed. This can speed up verifying wide tables,
+// at the cost of additional load on the targets.
+func WithColumnParallelism(connections int) optionFunc {
+	return func(c *Config) {
+		c.ColumnParallelism = connections
+	}
+}
+
+// WithCaseInsensitiveColumns lowercases the given columns before hashing, so
+// that values differing only by case are considered equal. Columns of the
+// citext type are always compared case-insensitively, as its support differs
+// between engines.
+func WithCaseInsensitiveColumns(columns ...string) optionFunc {
+	return func(c *Config) {
+		c.CaseInsensitiveColumns = append(c.CaseInsensitiveColumns, columns...)
+	}
+}
+
+// WithExcludeSystemSchemas skips the system and temporary schemas of
+// PostgreSQL and CockroachDB, such as pg_catalog, crdb_internal, and the
+// numbered pg_temp_N schemas, in addition to any schemas excluded with
+// ExcludeSchemas.
+func WithExcludeSystemSchemas() optionFunc {
+	return func(c *Config) {
+		c.ExcludeSystemSchemas = true
+	}
+}
+
+// WithDistinctColumns limits the columns compared in the distinct test mode to
+// the given column names, which are otherwise all of the hashed columns.
+func WithDistinctColumns(columns ...string) optionFunc {
+	return func(c *Config) {
+		c.DistinctColumns = append(c.DistinctColumns, columns...)
+	}
+}
+
+// WithSkipEmptyTables skips verifying tables without any rows on every target,
+// such as unused staging tables, which would otherwise trivially match. A
+// table that is empty on some targets but not others is still verified, as
+// that is a real mismatch.
+func WithSkipEmptyTables() optionFunc {
+	return func(c *Config) {
+		c.SkipEmptyTables = true
+	}
+}
+
+// WithExplainThreshold explains a scan of each table on which the full test
+// runs before running any tests, raising a warning for tables estimated to
+// have more than the given number of rows on any target, which may be better
+// verified with the sparse or bookend tests. Estimates are unavailable on
+// CockroachDB.
+func WithExplainThreshold(rows int64) optionFunc {
+	return func(c *Config) {
+		c.ExplainThreshold = rows
+	}
+}
+
+// WithSkipOverExplainThreshold skips the full test on tables estimated to
+// exceed the explain threshold, rather than only warning about them.
+func WithSkipOverExplainThreshold() optionFunc {
+	return func(c *Config) {
+		c.SkipOverExplainThreshold = true
+	}
+}
+
+// WithShard restricts the full test to shard k of n, the rows whose primary
+// key hashes to k modulo n, so that a full verification can be split across n
+// workers each running one shard. Every row is verified by exactly one shard,
+// so the verification passes if every shard passes.
+func WithShard(k, n int) optionFunc {
+	return func(c *Config) {
+		c.ShardIndex = k
+		c.ShardCount = n
+	}
+}
+
+// WithFailOnNoTables fails the verification if no tables are found to verify
+// on any target, such as when the schema and table filters match nothing,
+// rather than passing with only a warning.
+func WithFailOnNoTables() optionFunc {
+	return func(c *Config) {
+		c.FailOnNoTables = true
+	}
+}
+
+// WithTableTestModes overrides the test modes run on specific tables, keyed by
+// "schema.table", e.g. to run the full test on a few critical tables while
+// only running the rowcount test on the rest.
+func WithTableTestModes(tableTestModes map[string][]string) optionFunc {
+	return func(c *Config) {
+		if c.TableTestModes == nil {
+			c.TableTestModes = make(map[string][]string)
+		}
+
+		for table, testModes := range tableTestModes {
+			c.TableTestModes[table] = testModes
+		}
+	}
+}
+
+// WithLargeObjectColumns compares the given oid columns, which reference large
+// objects, by the contents of the large objects rather than by their OIDs,
+// which differ between databases even when the contents are identical. Large
+// objects are unsupported on CockroachDB.
+func WithLargeObjectColumns(columns ...string) optionFunc {
+	return func(c *Config) {
+		c.LargeObjectColumns = append(c.LargeObjectColumns, columns...)
+	}
+}
+
+// WithRedactHashes keeps test outputs derived from table data, such as hashes,
+// out of logs and reports, showing a placeholder of their prefix and length
+// instead, for environments where any data-derived value is sensitive.
+// Outputs are still compared in full.
+func WithRedactHashes() optionFunc {
+	return func(c *Config) {
+		c.RedactHashes = true
+	}
+}
+
+// WithExcludePrimaryKeys excludes the rows with the given primary keys from the
+// comparison of a table, such as rows that intentionally differ between
+// environments. Each key is a SQL literal, e.g. "42" or "'abc'", or for
+// composite primary keys a tuple of literals for the key columns in
+// alphabetical order, e.g. "(42, 'abc')". The keys are not sanitized.
+func WithExcludePrimaryKeys(schema, table string, keys []string) optionFunc {
+	return func(c *Config) {
+		if c.ExcludedPrimaryKeys == nil {
+			c.ExcludedPrimaryKeys = make(map[string][]string)
+		}
+
+		qualified := qualifiedTableName(schema, table)
+		c.ExcludedPrimaryKeys[qualified] = append(c.ExcludedPrimaryKeys[qualified], keys...)
+	}
+}
+
+// WithLatestPartitions restricts verification of partitioned tables to their
+// newest n partitions, ordered by range partition bound, e.g. to skip the
+// historical partitions of a time-series table. The partitioned parent tables
+// are skipped too, unless WithPartitionParents is also set.
+func WithLatestPartitions(n int) optionFunc {
+	return func(c *Config) {
+		c.LatestPartitions = n
+	}
+}
+
+// WithPartitionParents verifies the partitioned parent tables alongside their
+// latest partitions when WithLatestPartitions is set. Verifying a parent table
+// scans every one of its partitions.
+func WithPartitionParents() optionFunc {
+	return func(c *Config) {
+		c.VerifyPartitionParents = true
+	}
+}
+
+// WithRowFilter sets a SQL predicate that filters the rows of a table on every
+// target, e.g. to only verify recent rows. It is combined with any target row
+// filter for the table. The predicate is not sanitized.
+func WithRowFilter(schema, table, whereClause string) optionFunc {
+	return func(c *Config) {
+		if c.RowFilters == nil {
+			c.RowFilters = make(map[string]string)
+		}
+
+		c.RowFilters[qualifiedTableName(schema, table)] = whereClause
+	}
+}
+
+// WithConsistentSnapshot runs all of the queries on each target in a single
+// read only REPEATABLE READ transaction, so that, e.g., the rowcount and full
+// tests of a table cannot see different rows on a live database. The
+// transaction is held open for the whole verification of the target, which
+// may hold back vacuuming on PostgreSQL and garbage collection on CockroachDB.
+func WithConsistentSnapshot() optionFunc {
+	return func(c *Config) {
+		c.ConsistentSnapshot = true
+	}
+}
+
+// WithSampleTables restricts verification to a random sample of approximately
+// the given percentage of tables, e.g. for a quick smoke check of a large
+// schema. The sample is selected deterministically by the seed, so the same
+// tables are verified on every target and, for the same seed, across runs.
+func WithSampleTables(percent float64, seed int64) optionFunc {
+	return func(c *Config) {
+		c.SampleTablesPercent = percent
+		c.SampleTablesSeed = seed
+	}
+}
+
+// sampledTable returns whether the table is selected for verification by the
+// table sample, if configured.
+func (c Config) sampledTable(schemaName, tableName string) bool {
+	if c.SampleTablesPercent <= 0 {
+		return true
+	}
+
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%d:%s", c.SampleTablesSeed, qualifiedTableName(schemaName, tableName))
+
+	return float64(hash.Sum64()%10000) < c.SampleTablesPercent*100
+}
+
+// WithBookendAsFull runs the full test in place of the bookend test on tables
+// estimated, from table statistics, to have fewer than twice the bookend limit
+// of rows on every target, which would otherwise be hashed in full twice. The
+// output is still reported as the bookend test.
+func WithBookendAsFull() optionFunc {
+	return func(c *Config) {
+		c.BookendAsFull = true
+	}
+}
+
+// WithApplicationName sets the application_name of connections to the
+// targets, which identifies pgverify sessions in pg_stat_activity, overriding
+// the default of "pgverify". An application_name given in a target's
+// connection config takes precedence.
+func WithApplicationName(name string) optionFunc {
+	return func(c *Config) {
+		c.ApplicationName = name
+	}
+}
+
+// WithChunkSize runs the full test in chunks of n rows in primary key order,
+// each hashed by a separate query, so that tables too large to hash in a
+// single query within timeouts can still be verified. The combined hash of the
+// chunks is compared across targets, and differs from the hash of the full
+// test run in a single query.
+func WithChunkSize(n int) optionFunc {
+	return func(c *Config) {
+		c.ChunkSize = n
+	}
+}
+
+// WithNormalizeNaiveTimestamps hashes timestamp without time zone columns as
+// microseconds since the epoch, treating them as UTC and truncating them to
+// the configured timestamp precision, as is done for timestamp with time zone
+// columns. Their text representation can otherwise differ between engines.
+func WithNormalizeNaiveTimestamps() optionFunc {
+	return func(c *Config) {
+		c.NormalizeNaiveTimestamps = true
+	}
+}
+
+// WithSchemaPattern only verifies schemas whose names match the glob pattern,
+// where * matches any sequence of characters and ? matches any single
+// character, e.g. tenant_* for per-tenant schemas. It can be given multiple
+// times to match any of the patterns, and is combined with the other schema
+// filters.
+func WithSchemaPattern(glob string) optionFunc {
+	return func(c *Config) {
+		c.SchemaPatterns = append(c.SchemaPatterns, glob)
+	}
+}
+
+// WithHashedColumnsReport adds a table of the columns hashed in each table on
+// each target, after the column filters are applied and incomparable columns
+// are skipped, to the table report, e.g. for auditing which columns were
+// verified. They are always included in the JSON report.
+func WithHashedColumnsReport() optionFunc {
+	return func(c *Config) {
+		c.ReportHashedColumns = true
+	}
+}
+
+// WithAggregateSeparator sets the separator row hashes are concatenated with
+// before being hashed together in the full, bookend, and sparse tests. The
+// default is no separator, which is unambiguous as MD5 hashes are of a fixed
+// width. Changing the separator changes the test outputs, so all targets must
+// be verified with the same separator.
+func WithAggregateSeparator(separator string) optionFunc {
+	return func(c *Config) {
+		c.AggregateSeparator = separator
+	}
+}
+
+// WithAggregateGroupSize sets the number of row hashes aggregated together at a
+// time in the full and sparse tests. Row hashes are aggregated in groups, and
+// the group hashes aggregated in turn, so that hashing a large table does not
+// hold the hashes of all its rows in memory at once. Changing the group size
+// changes the test outputs, so all targets must be verified with the same
+// group size.
+func WithAggregateGroupSize(n int) optionFunc {
+	return func(c *Config) {
+		c.AggregateGroupSize = n
+	}
+}
+
+// WithSystemColumns hashes the given system columns, such as xmin and ctid, in
+// every table alongside its other columns. System columns are not listed in
+// the catalog queries, so are added by name. They describe the physical
+// storage of rows, which almost always differs between independent databases,
+// so this is strictly a debugging aid, e.g. for comparing a physical replica.
+func WithSystemColumns(columns ...string) optionFunc {
+	return func(c *Config) {
+		c.SystemColumns = append(c.SystemColumns, columns...)
+	}
+}
+
+// WithRowHashExpression overrides how each row is hashed in the full, bookend,
+// sparse, and columns tests, e.g. to match checksums computed by an external
+// system. The template is a format string with a single %s verb, which is
+// replaced by the comma separated columns cast to text, in hashing order, and
+// must produce a single text value, e.g. "encode(sha256(CONCAT(%s)::BYTEA),
+// 'hex')". The default is "MD5(CONCAT(%s))". Tables without a primary key are
+// always hashed with MD5, as their hashes are summed as integers.
+func WithRowHashExpression(template string) optionFunc {
+	return func(c *Config) {
+		c.RowHashExpression = template
+	}
+}
+
+// WithTableCallback sets a function called with the outcome of each test query
+// run against a table, including the columns hashed, the generated query, and
+// its duration, for building reporting, alerting, or history on top of the
+// verification. It is called concurrently from each target, so must be safe
+// for concurrent use, and should return quickly, as it blocks the target.
+func WithTableCallback(callback func(TableVerification)) optionFunc {
+	return func(c *Config) {
+		c.TableCallback = callback
+	}
+}
+
+// WithShardedTable verifies a table split across multiple physical tables in
+// the same schema on a single target, e.g. events_0 to events_15, as the union
+// of its shards under the logical table name, so that it can be compared with
+// an unsharded table on other targets. The shards must have the same columns,
+// in the same order, and are hashed together in primary key order. The target
+// name is the alias if configured, otherwise user@host:port/database.
+func WithShardedTable(targetName, schema, logicalName string, physicalTables []string) optionFunc {
+	return func(c *Config) {
+		if c.ShardedTables == nil {
+			c.ShardedTables = make(map[string]map[string][]string)
+		}
+
+		if _, ok := c.ShardedTables[targetName]; !ok {
+			c.ShardedTables[targetName] = make(map[string][]string)
+		}
+
+		c.ShardedTables[targetName][qualifiedTableName(schema, logicalName)] = physicalTables
+	}
+}
+
+// WithRequireEngine fails the verification before running any tests if any
+// target is not the given engine, as reported by version() and matched
+// ignoring case, e.g. "PostgreSQL" or "CockroachDB". A version prefix can be
+// included to also require a version, e.g. "PostgreSQL 14" matches PostgreSQL
+// 14.5 but not 15.1. This guards against comparing against the wrong kind of
+// database by mistake, as differences between engines are otherwise tolerated.
+func WithRequireEngine(engine string) optionFunc {
+	return func(c *Config) {
+		c.RequireEngine = engine
+	}
+}
+
+// WithBatchedConsistentRun runs all of the test queries on each target in a
+// single read only REPEATABLE READ transaction, as WithConsistentSnapshot, and
+// sends them in a single batch, as WithQueryBatchSize with the number of test
+// queries on the target, for both a consistent view of each target and the
+// fewest round trips. As in any batch, a failed query also fails the queries
+// after it.
+func WithBatchedConsistentRun() optionFunc {
+	return func(c *Config) {
+		c.ConsistentSnapshot = true
+		c.BatchedConsistentRun = true
+	}
+}
+
+// WithAsOfSystemTime runs all of the queries on each CockroachDB target in a
+// single transaction begun AS OF SYSTEM TIME the given time, as a timestamp,
+// a negative interval relative to the start of the transaction, such as
+// "-10s", or any other value accepted by CockroachDB. Comparing targets as of
+// the same timestamp eliminates mismatches due to replication lag; relative
+// intervals are resolved separately on each target. PostgreSQL has no
+// equivalent, so the latest data is verified on PostgreSQL targets, with a
+// warning.
+func WithAsOfSystemTime(systemTime string) optionFunc {
+	return func(c *Config) {
+		c.AsOfSystemTime = systemTime
+	}
+}
@@ -0,0 +1,112 @@
+//nolint:testpackage // unit test for internals, *_test pattern not appropriate
+package pgverify
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConfigEnv(t *testing.T) {
+	t.Setenv(EnvTestModes, "rowcount, sparse")
+	t.Setenv(EnvSparseMod, "50")
+	t.Setenv(EnvBookendLimit, "invalid")
+
+	c := NewConfig()
+	require.Equal(t, []string{TestModeRowCount, TestModeSparse}, c.TestModes)
+	require.Equal(t, 50, c.SparseMod)
+	require.Equal(t, TestModeBookendDefaultLimit, c.BookendLimit)
+
+	c = NewConfig(WithTests(TestModeFull), WithSparseMod(5))
+	require.Equal(t, []string{TestModeFull}, c.TestModes)
+	require.Equal(t, 5, c.SparseMod)
+}
+
+func TestValidateInvalidTestMode(t *testing.T) {
+	err := NewConfig(WithTests(TestModeFull, "bogus")).Validate()
+
+	var invalidTestMode ErrInvalidTestMode
+	require.True(t, errors.As(err, &invalidTestMode))
+	require.Equal(t, "bogus", invalidTestMode.Mode)
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Now()
+
+	for _, tc := range []struct {
+		name string
+
+		opts  []Option
+		valid bool
+	}{
+		{name: "defaults", valid: true},
+		{name: "zero sparse mod", opts: []Option{WithTests(TestModeSparse), WithSparseMod(0)}, valid: false},
+		{name: "negative sparse mod", opts: []Option{WithTests(TestModeSparse), WithSparseMod(-1)}, valid: false},
+		{name: "zero sparse mod without sparse", opts: []Option{WithTests(TestModeFull), WithSparseMod(0)}, valid: true},
+		{name: "zero bookend limit", opts: []Option{WithTests(TestModeBookend), WithBookendLimit(0)}, valid: false},
+		{name: "zero bookend limit without bookend", opts: []Option{WithTests(TestModeRowCount), WithBookendLimit(0)}, valid: true},
+		{name: "empty time window", opts: []Option{WithTimeWindow("public", "events", "created_at", now, now)}, valid: false},
+		{name: "time window", opts: []Option{WithTimeWindow("public", "events", "created_at", now.Add(-time.Hour), now)}, valid: true},
+		{name: "table test modes", opts: []Option{WithTests(TestModeRowCount), WithTableTestModes(map[string][]string{"public.orders": {TestModeFull}})}, valid: true},
+		{name: "invalid table test mode", opts: []Option{WithTableTestModes(map[string][]string{"public.orders": {"bogus"}})}, valid: false},
+		{name: "table sparse mode with zero sparse mod", opts: []Option{WithSparseMod(0), WithTableTestModes(map[string][]string{"public.orders": {TestModeSparse}})}, valid: false},
+		{name: "microsecond timestamp precision", opts: []Option{WithTimestampPrecision(TimestampPrecisionMicroseconds)}, valid: true},
+		{name: "abbreviated timestamp precision", opts: []Option{WithTimestampPrecision("ms")}, valid: false},
+		{name: "empty timestamp precision", opts: []Option{WithTimestampPrecision("")}, valid: true},
+		{name: "shard", opts: []Option{WithShard(3, 4)}, valid: true},
+		{name: "shard out of range", opts: []Option{WithShard(4, 4)}, valid: false},
+		{name: "system columns", opts: []Option{WithSystemColumns("xmin", "ctid")}, valid: true},
+		{name: "invalid system column", opts: []Option{WithSystemColumns("xmin", "id")}, valid: false},
+		{name: "type cast", opts: []Option{WithTypeCast("point", "ST_AsText(%s)")}, valid: true},
+		{name: "type cast without verb", opts: []Option{WithTypeCast("point", "ST_AsText(geom)")}, valid: false},
+		{name: "type cast with extra verb", opts: []Option{WithTypeCast("point", "%s::%d")}, valid: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := NewConfig(tc.opts...).Validate()
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestTestModesForTable(t *testing.T) {
+	config := NewConfig(
+		WithTests(TestModeSelfCheck, TestModeRowCount),
+		WithTableTestModes(map[string][]string{"public.orders": {TestModeFull, TestModeRowCount}}),
+	)
+
+	require.Equal(t, []string{TestModeRowCount}, config.testModesForTable("public", "users"))
+	require.Equal(t, []string{TestModeFull, TestModeRowCount}, config.testModesForTable("public", "orders"))
+	require.Equal(t, []string{TestModeRowCount, TestModeFull}, config.tableTestModes())
+}
+
+func TestValidateTimestampPrecision(t *testing.T) {
+	err := NewConfig(WithTimestampPrecision("ms")).Validate()
+	require.EqualError(t, err, `invalid timestamp precision: "ms", must be one of seconds, milliseconds, microseconds`)
+}
+
+func TestSampledTable(t *testing.T) {
+	config := NewConfig(WithSampleTables(10, 42))
+	require.NoError(t, config.Validate())
+
+	sampled := 0
+
+	for i := 0; i < 1000; i++ {
+		table := fmt.Sprintf("table_%d", i)
+		if config.sampledTable("public", table) {
+			sampled++
+		}
+
+		require.Equal(t, config.sampledTable("public", table), config.sampledTable("public", table))
+	}
+
+	require.InDelta(t, 100, sampled, 30)
+	require.True(t, NewConfig().sampledTable("public", "table_0"))
+	require.Error(t, NewConfig(WithSampleTables(150, 0)).Validate())
+}
@@ -0,0 +1,83 @@
+package pgverify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConnectionStatus is the outcome of connecting to a target.
+type ConnectionStatus struct {
+	Target    string `json:"target"`
+	Connected bool   `json:"connected"`
+	// The error connecting to the target, if not connected.
+	Error string `json:"error,omitempty"`
+}
+
+// addConnection records the outcome of connecting to a target.
+func (r *Results) addConnection(targetName string, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	status := ConnectionStatus{Target: targetName, Connected: err == nil}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	r.connections[targetName] = status
+}
+
+// Connections returns the outcome of connecting to each target that a
+// connection was attempted to, in target order.
+func (r *Results) Connections() []ConnectionStatus {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	connections := []ConnectionStatus{}
+
+	for _, targetName := range r.targetNames {
+		if status, ok := r.connections[targetName]; ok {
+			connections = append(connections, status)
+		}
+	}
+
+	return connections
+}
+
+// AllConnected returns whether every target was successfully connected to.
+func (r *Results) AllConnected() bool {
+	connections := r.Connections()
+	if len(connections) != len(r.targetNames) {
+		return false
+	}
+
+	for _, status := range connections {
+		if !status.Connected {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ConnectionSummary describes how many targets were connected to, and which
+// failed, e.g. "3 of 5 targets connected; 2 failed: a, b".
+func (r *Results) ConnectionSummary() string {
+	var connected int
+
+	var failed []string
+
+	for _, status := range r.Connections() {
+		if status.Connected {
+			connected++
+		} else {
+			failed = append(failed, status.Target)
+		}
+	}
+
+	summary := fmt.Sprintf("%d of %d targets connected", connected, len(r.targetNames))
+	if len(failed) > 0 {
+		summary += fmt.Sprintf("; %d failed: %s", len(failed), strings.Join(failed, ", "))
+	}
+
+	return summary
+}
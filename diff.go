@@ -0,0 +1,92 @@
+package pgverify
+
+import "sort"
+
+// ResultsDiff is the difference in match status between two verification
+// runs, for each test mode on each table, identified like
+// "schema.table/mode". Each list is sorted.
+type ResultsDiff struct {
+	// NewlyFailing are tests that passed in the first results, but fail in
+	// the other.
+	NewlyFailing []string `json:"newly_failing"`
+	// NewlyPassing are tests that failed in the first results, but pass in
+	// the other.
+	NewlyPassing []string `json:"newly_passing"`
+	// Added are tests only found in the other results.
+	Added []string `json:"added"`
+	// Removed are tests only found in the first results.
+	Removed []string `json:"removed"`
+}
+
+// Empty returns whether there are no differences.
+func (d ResultsDiff) Empty() bool {
+	return len(d.NewlyFailing) == 0 && len(d.NewlyPassing) == 0 && len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// Diff compares the match status of each test mode on each table with the
+// other results, e.g. from a later run, returning the tests whose status
+// changed. Only whether each test passes is compared, not the test outputs or
+// which targets produced them.
+func (r *Results) Diff(other *Results) ResultsDiff {
+	statuses, otherStatuses := r.testStatuses(), other.testStatuses()
+
+	var diff ResultsDiff
+
+	for test, passing := range otherStatuses {
+		previous, ok := statuses[test]
+
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, test)
+		case previous && !passing:
+			diff.NewlyFailing = append(diff.NewlyFailing, test)
+		case !previous && passing:
+			diff.NewlyPassing = append(diff.NewlyPassing, test)
+		}
+	}
+
+	for test := range statuses {
+		if _, ok := otherStatuses[test]; !ok {
+			diff.Removed = append(diff.Removed, test)
+		}
+	}
+
+	sort.Strings(diff.NewlyFailing)
+	sort.Strings(diff.NewlyPassing)
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+
+	return diff
+}
+
+// Equal returns whether the other results have the same match status for
+// each test mode on each table.
+func (r *Results) Equal(other *Results) bool {
+	return r.Diff(other).Empty()
+}
+
+// testStatuses returns whether each test mode on each table passes, keyed like
+// "schema.table/mode".
+func (r *Results) testStatuses() map[string]bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	statuses := make(map[string]bool)
+
+	for schema, tables := range r.content {
+		for table, modes := range tables {
+			for mode := range modes {
+				statuses[qualifiedTableName(schema, table)+"/"+mode] = r.testPasses(schema, table, mode)
+			}
+		}
+	}
+
+	return statuses
+}
+
+// testPasses returns whether the test mode passes on the table, without
+// locking. A test fails if its outputs differ or are errors, or if the table
+// is missing on any target.
+func (r *Results) testPasses(schema, table, mode string) bool {
+	return len(r.missingTargets(schema, table)) == 0 && len(r.checkModeOutputs(schema, table, mode, r.content[schema][table][mode])) == 0
+}
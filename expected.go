@@ -0,0 +1,91 @@
+package pgverify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+// VerifyExpected runs the test modes in the expected outputs, keyed by schema,
+// table, and test mode, against those tables on a single target, and returns
+// an error describing each output that differs from the expected one. This
+// pins the content of tables to known-good values, e.g. in a test suite
+// to detect unintended data changes over time.
+func (c Config) VerifyExpected(ctx context.Context, target *pgx.ConnConfig, expected SingleResult) error {
+	var schemaNames, tableNames, testModes []string
+
+	for _, schemaName := range sortedKeys(expected) {
+		schemaNames = append(schemaNames, schemaName)
+
+		for _, tableName := range sortedKeys(expected[schemaName]) {
+			tableNames = append(tableNames, tableName)
+
+			for mode := range expected[schemaName][tableName] {
+				if !containsString(testModes, mode) {
+					testModes = append(testModes, mode)
+				}
+			}
+		}
+	}
+
+	// Only the expected tables and test modes are verified.
+	c.IncludeSchemas = schemaNames
+	c.IncludeTables = tableNames
+	c.TestModes = testModes
+	c.TableTestModes = nil
+
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	targetName := c.targetNames([]*pgx.ConnConfig{target})[0]
+	logger := c.Logger.WithField("target", targetName)
+
+	conn, err := c.connectTarget(ctx, target, targetName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to target %s", targetName)
+	}
+	defer conn.Close(ctx)
+
+	result, err := c.computeTargetResult(ctx, logger, targetName, conn)
+	if err != nil {
+		return err
+	}
+
+	if err := multierr.Combine(diffExpected(expected, result.hashes)...); err != nil {
+		return err
+	}
+
+	logger.Info("Verification against expected outputs successful")
+
+	return nil
+}
+
+// diffExpected returns an error for each expected output that is missing or
+// differs from the actual output, ordered by schema, table, and test mode.
+func diffExpected(expected, actual SingleResult) []error {
+	var errs []error
+
+	for _, schemaName := range sortedKeys(expected) {
+		for _, tableName := range sortedKeys(expected[schemaName]) {
+			outputs, ok := actual[schemaName][tableName]
+			if !ok {
+				errs = append(errs, fmt.Errorf("table %s.%s not found", schemaName, tableName))
+
+				continue
+			}
+
+			for _, mode := range sortedKeys(expected[schemaName][tableName]) {
+				want := expected[schemaName][tableName][mode]
+				if got := outputs[mode]; got != want {
+					errs = append(errs, fmt.Errorf("%s.%s test %s: expected %s, got %s", schemaName, tableName, mode, want, got))
+				}
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,29 @@
+//nolint:testpackage // unit test for internals, *_test pattern not appropriate
+package pgverify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffExpected(t *testing.T) {
+	expected := SingleResult{
+		"public": {
+			"orders":  {TestModeRowCount: "10", TestModeFull: "abc"},
+			"missing": {TestModeRowCount: "0"},
+		},
+	}
+	actual := SingleResult{
+		"public": {
+			"orders": {TestModeRowCount: "10", TestModeFull: "def"},
+			"other":  {TestModeRowCount: "5"},
+		},
+	}
+
+	require.Equal(t, []string{
+		"table public.missing not found",
+		"public.orders test full: expected abc, got def",
+	}, errorStrings(diffExpected(expected, actual)))
+	require.Empty(t, diffExpected(SingleResult{"public": {"orders": {TestModeRowCount: "10"}}}, actual))
+}
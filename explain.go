@@ -0,0 +1,148 @@
+package pgverify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+// Output recorded for full tests skipped because the estimated number of rows
+// exceeds the explain threshold.
+const overExplainThresholdOutput = "(over explain threshold)"
+
+// explainPlan is a node of a query plan output by EXPLAIN (FORMAT JSON).
+type explainPlan struct {
+	Rows  float64       `json:"Plan Rows"`
+	Plans []explainPlan `json:"Plans"`
+}
+
+// maxRows returns the largest estimated number of rows output by any node of
+// the plan. For an aggregate hash query, this is the scan of the table rather
+// than the single aggregated row.
+func (p explainPlan) maxRows() float64 {
+	rows := p.Rows
+	for _, plan := range p.Plans {
+		if planRows := plan.maxRows(); planRows > rows {
+			rows = planRows
+		}
+	}
+
+	return rows
+}
+
+// parseExplainRows returns the largest estimated number of rows in the output
+// of EXPLAIN (FORMAT JSON).
+func parseExplainRows(output []byte) (int64, error) {
+	var explained []struct {
+		Plan explainPlan `json:"Plan"`
+	}
+
+	if err := json.Unmarshal(output, &explained); err != nil {
+		return 0, errors.Wrap(err, "failed to parse query plan")
+	}
+
+	if len(explained) == 0 {
+		return 0, errors.New("failed to parse query plan: no plans")
+	}
+
+	return int64(explained[0].Plan.maxRows()), nil
+}
+
+// explainEstimatedRows asks the planner how many rows the query is estimated to
+// read, without running it. This is unsupported on CockroachDB, which does not
+// output plans as JSON.
+func explainEstimatedRows(ctx context.Context, conn *pgx.Conn, query string) (int64, error) {
+	var output []byte
+	if err := conn.QueryRow(ctx, "EXPLAIN (FORMAT JSON) "+query).Scan(&output); err != nil {
+		return 0, wrapQueryError(err, query)
+	}
+
+	return parseExplainRows(output)
+}
+
+// buildExplainScanQuery constructs the query explained to estimate the rows
+// read by the full test on the table, which scans the rows matching the
+// predicates.
+func buildExplainScanQuery(config Config, schemaName, tableName string, predicates []string) string {
+	return formatQuery(fmt.Sprintf(`SELECT * FROM %s%s`, config.quoteTable(schemaName, tableName), buildWhereClause(predicates)))
+}
+
+// fetchOverExplainThresholdTables returns the tables, as "schema.table", on
+// which the full test runs and which are estimated to have more rows than the
+// explain threshold on any target, along with the largest estimate for each.
+// The same tables are returned for every target, so that all targets run, or
+// skip, the same tests on them. Tables that cannot be explained on a target,
+// e.g. on CockroachDB, are judged by the estimates on the other targets.
+func (c Config) fetchOverExplainThresholdTables(ctx context.Context, conns []*pgx.Conn, targetNames []string) map[string]int64 {
+	overTables := make(map[string]int64)
+
+	for i, conn := range conns {
+		logger := c.Logger.WithField("target", targetNames[i])
+		targetConfig := c.withTargetShardedTables(targetNames[i])
+
+		schemaTables, err := targetConfig.fetchTargetTableNames(ctx, logger, targetNames[i], conn)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to enumerate tables, not checking the explain threshold")
+
+			continue
+		}
+
+		for schemaName, tables := range schemaTables {
+			for tableName := range tables {
+				if !containsString(c.testModesForTable(schemaName, tableName), TestModeFull) {
+					continue
+				}
+
+				query := buildExplainScanQuery(targetConfig, c.physicalSchema(targetNames[i], schemaName), tableName, c.tablePredicates(targetNames[i], schemaName, tableName))
+
+				rows, err := explainEstimatedRows(ctx, conn, query)
+				if err != nil {
+					logger.WithError(err).WithField("schema", schemaName).WithField("table", tableName).Debug("Failed to estimate rows")
+
+					continue
+				}
+
+				name := qualifiedTableName(schemaName, tableName)
+				if rows > c.ExplainThreshold && rows > overTables[name] {
+					overTables[name] = rows
+				}
+			}
+		}
+	}
+
+	return overTables
+}
+
+// checkExplainThreshold warns about the full tests of the tables estimated to
+// have more rows than the configured threshold, and returns the tests to run.
+// If configured to skip them, those tests are omitted and their output
+// recorded as over the threshold instead.
+func (c Config) checkExplainThreshold(tests []tableTest, result *targetResult) []tableTest {
+	var checked []tableTest
+
+	for _, test := range tests {
+		rows, ok := c.overExplainThresholdTables[qualifiedTableName(test.schemaName, test.tableName)]
+		if test.testMode != TestModeFull || !ok {
+			checked = append(checked, test)
+
+			continue
+		}
+
+		warning := fmt.Sprintf("table %s.%s is estimated to have %d rows, exceeding the explain threshold of %d; consider the sparse or bookend tests", test.schemaName, test.tableName, rows, c.ExplainThreshold)
+		test.logger.Warn(warning)
+		result.warnings = append(result.warnings, warning)
+
+		if c.SkipOverExplainThreshold {
+			result.hashes[test.schemaName][test.tableName][test.testMode] = overExplainThresholdOutput
+
+			continue
+		}
+
+		checked = append(checked, test)
+	}
+
+	return checked
+}
@@ -0,0 +1,41 @@
+//nolint:testpackage // unit test for internals, *_test pattern not appropriate
+package pgverify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExplainRows(t *testing.T) {
+	rows, err := parseExplainRows([]byte(`[{"Plan": {"Node Type": "Aggregate", "Plan Rows": 1, "Plans": [
+		{"Node Type": "Sort", "Plan Rows": 250000, "Plans": [{"Node Type": "Seq Scan", "Plan Rows": 250000.5}]}
+	]}}]`))
+	require.NoError(t, err)
+	require.Equal(t, int64(250000), rows)
+
+	_, err = parseExplainRows([]byte(`[]`))
+	require.Error(t, err)
+
+	_, err = parseExplainRows([]byte(`not json`))
+	require.Error(t, err)
+}
+
+func TestCheckExplainThreshold(t *testing.T) {
+	c := NewConfig(WithExplainThreshold(1000), WithSkipOverExplainThreshold())
+	c.overExplainThresholdTables = map[string]int64{"public.big": 5000}
+
+	result := &targetResult{hashes: SingleResult{
+		"public": {"big": {}, "small": {}},
+	}}
+	tests := []tableTest{
+		{schemaName: "public", tableName: "big", testMode: TestModeFull, logger: c.Logger.WithField("table", "big")},
+		{schemaName: "public", tableName: "big", testMode: TestModeRowCount, logger: c.Logger.WithField("table", "big")},
+		{schemaName: "public", tableName: "small", testMode: TestModeFull, logger: c.Logger.WithField("table", "small")},
+	}
+
+	checked := c.checkExplainThreshold(tests, result)
+	require.Equal(t, tests[1:], checked)
+	require.Equal(t, overExplainThresholdOutput, result.hashes["public"]["big"][TestModeFull])
+	require.Len(t, result.warnings, 1)
+}
@@ -0,0 +1,184 @@
+package pgverify
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/multierr"
+)
+
+// The name of the temporary table that files are loaded into.
+const fileTableName = "pgverify_file"
+
+// VerifyWithFile verifies that a CSV file, such as an export of a table, has
+// the same contents as the table on the live target. The file must have a
+// header row naming the columns of the table that it contains, which must
+// include every column selected for verification.
+//
+// The file is loaded into a temporary table on the target, so the rows are
+// cast to text by the database exactly as they are for the table, and the
+// full test is run on both. Nothing is written outside of the transaction,
+// which is rolled back once the hashes are computed, but the target must
+// support temporary tables.
+func (c Config) VerifyWithFile(ctx context.Context, target *pgx.ConnConfig, csvPath, schemaName, tableName string) (*Results, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	header, err := readCSVHeader(csvPath)
+	if err != nil {
+		return nil, err
+	}
+
+	targetName := c.targetNames([]*pgx.ConnConfig{target})[0]
+	c = c.withTargetShardedTables(targetName)
+	logger := c.Logger.WithField("target", targetName).WithField("schema", schemaName).WithField("table", tableName)
+
+	conn, err := c.connectTarget(ctx, target, targetName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to target %s", targetName)
+	}
+	defer conn.Close(ctx)
+
+	columns, err := c.fileColumns(ctx, logger, conn, schemaName, tableName, header)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+	//nolint:errcheck // rolling back discards the temporary table, and fails harmlessly if the connection is broken
+	defer tx.Rollback(ctx)
+
+	if err := c.loadCSVFile(ctx, tx, csvPath, schemaName, tableName, header); err != nil {
+		return nil, err
+	}
+
+	predicates := c.tablePredicates(targetName, schemaName, tableName)
+
+	tableOutput, err := runTestOnTable(ctx, tx.Conn(), fullTestMode{}, buildFullHashQuery(c, schemaName, tableName, columns, predicates))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to hash table %s", qualifiedTableName(schemaName, tableName))
+	}
+
+	fileOutput, err := runTestOnTable(ctx, tx.Conn(), fullTestMode{}, buildFullHashQuery(c, "pg_temp", fileTableName, columns, predicates))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to hash file %s", csvPath)
+	}
+
+	c.TestModes = []string{TestModeFull}
+	results := c.newResults([]string{targetName, csvPath})
+	results.AddResult(targetName, SingleResult{schemaName: {tableName: {TestModeFull: tableOutput}}})
+	results.AddResult(csvPath, SingleResult{schemaName: {tableName: {TestModeFull: fileOutput}}})
+
+	if reportErrors := results.CheckForErrors(); len(reportErrors) > 0 {
+		return results, multierr.Combine(reportErrors...)
+	}
+
+	logger.Info("Verification successful")
+
+	return results, nil
+}
+
+// readCSVHeader returns the column names in the header row of the CSV file.
+func readCSVHeader(csvPath string) ([]string, error) {
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open file")
+	}
+	defer file.Close()
+
+	header, err := csv.NewReader(file).Read()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read header row of %s", csvPath)
+	}
+
+	return header, nil
+}
+
+// fileColumns returns the columns of the table to verify against a file with
+// the given header, returning an error if the file lacks any of them.
+func (c Config) fileColumns(ctx context.Context, logger *logrus.Entry, conn *pgx.Conn, schemaName, tableName string, header []string) ([]column, error) {
+	allTableColumns, err := c.fetchTableColumns(ctx, logger, conn, schemaName, c.metadataTableName(schemaName, tableName))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query column names, data types")
+	}
+
+	if len(allTableColumns) == 0 {
+		return nil, fmt.Errorf("table %s not found", qualifiedTableName(schemaName, tableName))
+	}
+
+	inFile := make(map[string]bool)
+	for _, name := range header {
+		inFile[name] = true
+	}
+
+	var (
+		columns    []column
+		primaryKey bool
+	)
+
+	for _, name := range sortedKeys(allTableColumns) {
+		col := allTableColumns[name]
+		if !c.validColumnTarget(col) || !c.comparableColumn(col) {
+			continue
+		}
+
+		if !inFile[col.name] {
+			return nil, fmt.Errorf("file is missing column %s", col.name)
+		}
+
+		primaryKey = primaryKey || col.IsPrimaryKey()
+		columns = append(columns, col)
+	}
+
+	if !primaryKey {
+		return nil, fmt.Errorf("table %s has no primary key", qualifiedTableName(schemaName, tableName))
+	}
+
+	return columns, nil
+}
+
+// buildFileTableQuery returns the query creating the temporary table that a
+// file is loaded into, with the columns of the given table, or of its first
+// shard if it is sharded.
+func buildFileTableQuery(c Config, schemaName, tableName string) string {
+	likeTable := c.quoteIdent(schemaName) + "." + c.quoteIdent(c.metadataTableName(schemaName, tableName))
+
+	return fmt.Sprintf(`CREATE TEMPORARY TABLE %s (LIKE %s) ON COMMIT DROP`, fileTableName, likeTable)
+}
+
+// loadCSVFile copies the CSV file into a temporary table with the same
+// columns as the given table, which is dropped when the transaction ends.
+func (c Config) loadCSVFile(ctx context.Context, tx pgx.Tx, csvPath, schemaName, tableName string, header []string) error {
+	query := buildFileTableQuery(c, schemaName, tableName)
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return errors.Wrap(wrapQueryError(err, query), "failed to create temporary table")
+	}
+
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to open file")
+	}
+	defer file.Close()
+
+	quoted := make([]string, len(header))
+	for i, name := range header {
+		quoted[i] = c.quoteIdent(name)
+	}
+
+	query = fmt.Sprintf("COPY %s (%s) FROM STDIN WITH (FORMAT csv, HEADER true)", fileTableName, strings.Join(quoted, ", "))
+	if _, err := tx.Conn().PgConn().CopyFrom(ctx, file, query); err != nil {
+		return errors.Wrapf(wrapQueryError(err, query), "failed to load %s", csvPath)
+	}
+
+	return nil
+}
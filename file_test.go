@@ -0,0 +1,22 @@
+//nolint:testpackage // unit test for internals, *_test pattern not appropriate
+package pgverify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCSVHeader(t *testing.T) {
+	csvPath := filepath.Join(t.TempDir(), "export.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte("id,\"content, quoted\",when\n1,foo,2022-01-01\n"), 0o600))
+
+	header, err := readCSVHeader(csvPath)
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "content, quoted", "when"}, header)
+
+	_, err = readCSVHeader(filepath.Join(t.TempDir(), "missing.csv"))
+	require.Error(t, err)
+}
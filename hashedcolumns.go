@@ -0,0 +1,86 @@
+package pgverify
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// TableColumns are the columns of a table that were hashed on a target, after
+// the column filters were applied and incomparable columns were skipped.
+type TableColumns struct {
+	Target  string   `json:"target"`
+	Schema  string   `json:"schema"`
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+}
+
+// AddHashedColumns records the names of the columns hashed in each table of a
+// specific target, keyed by schema and then table.
+func (r *Results) AddHashedColumns(targetName string, columns map[string]map[string][]string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.hashedColumns[targetName]; !ok {
+		r.hashedColumns[targetName] = make(map[string]map[string][]string)
+	}
+
+	for schema, tables := range columns {
+		if _, ok := r.hashedColumns[targetName][schema]; !ok {
+			r.hashedColumns[targetName][schema] = make(map[string][]string)
+		}
+
+		for table, names := range tables {
+			sorted := append([]string{}, names...)
+			sort.Strings(sorted)
+			r.hashedColumns[targetName][schema][table] = sorted
+		}
+	}
+}
+
+// HashedColumns returns the columns hashed in each table on each target, sorted
+// by schema, table, and target, to answer whether a column was verified.
+func (r *Results) HashedColumns() []TableColumns {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	hashedColumns := []TableColumns{}
+
+	for target, schemas := range r.hashedColumns {
+		for schema, tables := range schemas {
+			for table, columns := range tables {
+				hashedColumns = append(hashedColumns, TableColumns{
+					Target:  target,
+					Schema:  schema,
+					Table:   table,
+					Columns: append([]string{}, columns...),
+				})
+			}
+		}
+	}
+
+	sort.Slice(hashedColumns, func(i, j int) bool {
+		if hashedColumns[i].Schema != hashedColumns[j].Schema {
+			return hashedColumns[i].Schema < hashedColumns[j].Schema
+		}
+
+		if hashedColumns[i].Table != hashedColumns[j].Table {
+			return hashedColumns[i].Table < hashedColumns[j].Table
+		}
+
+		return hashedColumns[i].Target < hashedColumns[j].Target
+	})
+
+	return hashedColumns
+}
+
+// writeHashedColumnsTable writes a table of the columns hashed in each table
+// on each target.
+func writeHashedColumnsTable(writer io.Writer, hashedColumns []TableColumns) {
+	rows := make([][]string, len(hashedColumns))
+	for i, tableColumns := range hashedColumns {
+		rows[i] = []string{tableColumns.Schema, tableColumns.Table, strings.Join(tableColumns.Columns, ", "), tableColumns.Target}
+	}
+
+	writeTable(writer, []string{"schema", "table", "hashed columns", "target"}, rows, []int{0, 1})
+}
@@ -0,0 +1,86 @@
+package pgverify
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+// Output recorded for the histogram test mode on tables without a configured
+// bucket expression.
+const noHistogramOutput = "(no bucket expression)"
+
+// histogramTestMode compares the number of rows in each bucket of a
+// configured expression.
+type histogramTestMode struct {
+	expression string
+}
+
+func (m histogramTestMode) BuildQuery(config Config, schemaName, tableName string, _ []Column, predicates []string) string {
+	return buildHistogramQuery(config, schemaName, tableName, m.expression, predicates)
+}
+
+// ParseResult reads the bucket counts returned by the histogram query,
+// formatting them as a comma separated list of quoted bucket=count entries
+// sorted by bucket.
+func (histogramTestMode) ParseResult(row pgx.Row) (string, error) {
+	output, err := scanTestOutput(row)
+	if err != nil || output == emptyTableOutput {
+		return output, err
+	}
+
+	counts, err := parseHistogramQueryOutput(output)
+	if err != nil {
+		return "", err
+	}
+
+	return formatKeyedOutput(counts), nil
+}
+
+// parseHistogramQueryOutput parses the length-prefixed 'bucket=count;' entries
+// returned by the histogram query, where a length of -1 marks a NULL bucket.
+func parseHistogramQueryOutput(output string) (map[string]string, error) {
+	counts := make(map[string]string)
+
+	for output != "" {
+		separator := strings.IndexByte(output, ':')
+		if separator < 0 {
+			return nil, errors.Errorf("invalid histogram output: missing bucket length in %q", output)
+		}
+
+		length, err := strconv.Atoi(output[:separator])
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid histogram output: bucket length")
+		}
+
+		output = output[separator+1:]
+
+		bucket := nullKey
+		if length >= 0 {
+			end := 0
+			for i := 0; i < length; i++ {
+				if end >= len(output) {
+					return nil, errors.New("invalid histogram output: truncated bucket")
+				}
+
+				_, size := utf8.DecodeRuneInString(output[end:])
+				end += size
+			}
+
+			bucket, output = strconv.Quote(output[:end]), output[end:]
+		}
+
+		terminator := strings.IndexByte(output, ';')
+		if !strings.HasPrefix(output, "=") || terminator < 0 {
+			return nil, errors.Errorf("invalid histogram output: missing count for bucket %s", bucket)
+		}
+
+		counts[bucket] = output[1:terminator]
+		output = output[terminator+1:]
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,51 @@
+//nolint:testpackage // unit test for internals, *_test pattern not appropriate
+package pgverify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildHistogramQuery(t *testing.T) {
+	require.Equal(t,
+		formatQuery(`
+		SELECT string_agg(CONCAT(COALESCE(length(bucket), -1), ':', bucket, '=', n, ';'), '')
+		FROM (
+			SELECT (status)::TEXT AS bucket, count(*) AS n
+			FROM "public"."orders" WHERE (id > 10)
+			GROUP BY 1
+		) AS buckets`),
+		buildHistogramQuery(Config{}, "public", "orders", "status", []string{"id > 10"}))
+}
+
+func TestParseHistogramQueryOutput(t *testing.T) {
+	counts, err := parseHistogramQueryOutput("4:new;=2;-1:=1;4:done=10;2:né=3;")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{`"new;"`: "2", "NULL": "1", `"done"`: "10", `"né"`: "3"}, counts)
+
+	output := formatKeyedOutput(counts)
+	require.Equal(t, `"done"=10, "new;"=2, "né"=3, NULL=1`, output)
+
+	parsed, err := parseKeyedOutput(output)
+	require.NoError(t, err)
+	require.Equal(t, counts, parsed)
+
+	_, err = parseHistogramQueryOutput("9:short=1;")
+	require.Error(t, err)
+}
+
+func TestDivergingKeys(t *testing.T) {
+	require.Equal(t,
+		[]string{`"done"`, `"new"`},
+		divergingKeys([]string{`"done"=10, "open"=2`, `"done"=9, "new"=1, "open"=2`, defaultErrorOutput}))
+	require.Empty(t, divergingKeys([]string{`"done"=10`, defaultErrorOutput}))
+
+	results := NewResults([]string{"a", "b"}, []string{TestModeHistogram})
+	results.AddResult("a", SingleResult{"public": {"orders": {TestModeHistogram: `"done"=10, "open"=2`}}})
+	results.AddResult("b", SingleResult{"public": {"orders": {TestModeHistogram: `"done"=10, "open"=3`}}})
+
+	errs := results.CheckForErrors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0].Error(), `diverging buckets: "open"`)
+}
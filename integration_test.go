@@ -1,6 +1,7 @@
 package pgverify_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"errors"
@@ -252,11 +253,31 @@ func TestVerifyData(t *testing.T) {
 		valueClauses = append(valueClauses, valueClause)
 	}
 
+	// Wide table exceeding the function argument limit for a single CONCAT
+	wideColumns := make([]string, 200)
+	wideColumnsWithTypes := make([]string, len(wideColumns))
+
+	for i := range wideColumns {
+		wideColumns[i] = fmt.Sprintf("wide_col_%03d", i)
+		wideColumnsWithTypes[i] = wideColumns[i] + " TEXT"
+	}
+
+	createWideTableQuery := fmt.Sprintf("CREATE TABLE widetable (id INT PRIMARY KEY, %s);", strings.Join(wideColumnsWithTypes, ", "))
+	wideValueClauses := make([]string, 0, rowCount)
+
+	for rowID := 0; rowID < rowCount; rowID++ {
+		wideValueClauses = append(wideValueClauses, fmt.Sprintf("(%d%s)", rowID, strings.Repeat(fmt.Sprintf(", 'row %d'", rowID), len(wideColumns))))
+	}
+
+	insertWideDataQuery := fmt.Sprintf("INSERT INTO widetable (id, %s) VALUES %s", strings.Join(wideColumns, ", "), strings.Join(wideValueClauses, ", "))
+
 	// Act
 	var targets []*pgx.ConnConfig
 
 	var aliases []string
 
+	var conns []*pgx.Conn
+
 	for _, db := range dbs {
 		aliases = append(aliases, db.image)
 		// Create db and connect
@@ -291,7 +312,16 @@ func TestVerifyData(t *testing.T) {
 			assert.NoError(t, err, "Failed to insert data to table on %v with query %s", tableName, db.image, insertDataQuery)
 		}
 
+		_, err = conn.Exec(ctx, "CREATE TABLE emptytable (id INT PRIMARY KEY, content TEXT);")
+		assert.NoError(t, err, "Failed to create empty table on %v", db.image)
+
+		_, err = conn.Exec(ctx, createWideTableQuery)
+		assert.NoError(t, err, "Failed to create wide table on %v", db.image)
+		_, err = conn.Exec(ctx, insertWideDataQuery)
+		assert.NoError(t, err, "Failed to insert data to wide table on %v", db.image)
+
 		targets = append(targets, config)
+		conns = append(conns, conn)
 	}
 
 	logger := logrus.New()
@@ -306,6 +336,7 @@ func TestVerifyData(t *testing.T) {
 				pgverify.TestModeSparse,
 				pgverify.TestModeFull,
 				pgverify.TestModeRowCount,
+				pgverify.TestModeSelfCheck,
 			),
 			pgverify.WithLogger(logger),
 			pgverify.ExcludeSchemas("pg_catalog", "pg_extension", "information_schema", "crdb_internal"),
@@ -316,4 +347,118 @@ func TestVerifyData(t *testing.T) {
 		assert.NoError(t, err)
 		results.WriteAsTable(os.Stdout)
 	}
+
+	// Check that the same tables exist on every target
+	existenceResults, err := pgverify.Verify(
+		ctx,
+		targets,
+		pgverify.WithTests(pgverify.TestModeExistence),
+		pgverify.WithLogger(logger),
+		pgverify.ExcludeSchemas("pg_catalog", "pg_extension", "information_schema", "crdb_internal"),
+		pgverify.WithAliases(aliases),
+	)
+	assert.NoError(t, err)
+	existenceResults.WriteAsTable(os.Stdout)
+
+	// Aggregate row hashes in small groups, as done for large tables
+	groupedResults, err := pgverify.Verify(
+		ctx,
+		targets,
+		pgverify.WithTests(pgverify.TestModeFull, pgverify.TestModeSparse),
+		pgverify.WithLogger(logger),
+		pgverify.ExcludeSchemas("pg_catalog", "pg_extension", "information_schema", "crdb_internal"),
+		pgverify.ExcludeColumns("ignored", "rowid"),
+		pgverify.WithAliases(aliases),
+		pgverify.WithAggregateGroupSize(2),
+	)
+	assert.NoError(t, err)
+	groupedResults.WriteAsTable(os.Stdout)
+
+	// Hash naive timestamps as epochs
+	naiveResults, err := pgverify.Verify(
+		ctx,
+		targets,
+		pgverify.WithTests(pgverify.TestModeFull),
+		pgverify.WithLogger(logger),
+		pgverify.ExcludeSchemas("pg_catalog", "pg_extension", "information_schema", "crdb_internal"),
+		pgverify.ExcludeColumns("ignored", "rowid"),
+		pgverify.WithAliases(aliases),
+		pgverify.WithNormalizeNaiveTimestamps(),
+	)
+	assert.NoError(t, err)
+	naiveResults.WriteAsTable(os.Stdout)
+
+	// Check connectivity without verifying
+	statuses, err := pgverify.NewConfig(
+		pgverify.WithLogger(logger),
+		pgverify.ExcludeSchemas("pg_catalog", "pg_extension", "information_schema", "crdb_internal"),
+	).Ping(ctx, targets)
+	assert.NoError(t, err)
+	for _, status := range statuses {
+		assert.True(t, status.OK())
+		assert.Positive(t, status.Tables)
+	}
+
+	// Verify using existing connections
+	connResults, err := pgverify.NewConfig(
+		pgverify.WithTests(pgverify.TestModeFull, pgverify.TestModeRowCount),
+		pgverify.WithLogger(logger),
+		pgverify.ExcludeSchemas("pg_catalog", "pg_extension", "information_schema", "crdb_internal"),
+		pgverify.ExcludeColumns("ignored", "rowid"),
+		pgverify.WithQueryBatchSize(3),
+		pgverify.WithConsistentSnapshot(),
+	).VerifyConns(ctx, conns, aliases)
+	assert.NoError(t, err)
+	connResults.WriteAsTable(os.Stdout)
+
+	// Verify with all test queries of each target in a single batch
+	batchedResults, err := pgverify.NewConfig(
+		pgverify.WithTests(pgverify.TestModeFull, pgverify.TestModeBookend, pgverify.TestModeRowCount),
+		pgverify.WithLogger(logger),
+		pgverify.ExcludeSchemas("pg_catalog", "pg_extension", "information_schema", "crdb_internal"),
+		pgverify.ExcludeColumns("ignored", "rowid"),
+		pgverify.WithBatchedConsistentRun(),
+	).VerifyConns(ctx, conns, aliases)
+	assert.NoError(t, err)
+	batchedResults.WriteAsTable(os.Stdout)
+
+	// Snapshot the first target to a manifest and verify another against it
+	manifestConfig := pgverify.NewConfig(
+		pgverify.WithTests(pgverify.TestModeFull, pgverify.TestModeRowCount),
+		pgverify.WithLogger(logger),
+		pgverify.ExcludeSchemas("pg_catalog", "pg_extension", "information_schema", "crdb_internal"),
+		pgverify.ExcludeColumns("ignored", "rowid"),
+	)
+	manifest, err := manifestConfig.ComputeManifest(ctx, targets[0])
+	require.NoError(t, err)
+
+	var manifestBuffer bytes.Buffer
+	require.NoError(t, manifest.Write(&manifestBuffer))
+	manifest, err = pgverify.ReadManifest(&manifestBuffer)
+	require.NoError(t, err)
+
+	results, err := manifestConfig.VerifyAgainstManifest(ctx, targets[len(targets)-1], manifest)
+	assert.NoError(t, err)
+	results.WriteAsTable(os.Stdout)
+
+	// Pin the content of a table to expected outputs
+	err = manifestConfig.VerifyExpected(ctx, targets[0], pgverify.SingleResult{
+		"public": {"testtable1": {pgverify.TestModeRowCount: strconv.Itoa(rowCount)}},
+	})
+	assert.NoError(t, err)
+
+	err = manifestConfig.VerifyExpected(ctx, targets[0], pgverify.SingleResult{
+		"public": {"testtable1": {pgverify.TestModeRowCount: "-1"}},
+	})
+	assert.ErrorContains(t, err, "public.testtable1 test rowcount: expected -1")
+
+	// Filters matching no tables fail rather than passing trivially
+	_, err = pgverify.Verify(
+		ctx,
+		targets[:2],
+		pgverify.WithLogger(logger),
+		pgverify.IncludeSchemas("no_such_schema"),
+		pgverify.WithFailOnNoTables(),
+	)
+	assert.ErrorContains(t, err, "found no tables to verify")
 }
@@ -0,0 +1,136 @@
+package pgverify
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The name of the test suite in JUnit XML reports.
+const junitSuiteName = "pgverify"
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Details string `xml:",chardata"`
+}
+
+// WriteAsJUnit writes the results as a JUnit XML report to the given
+// io.Writer, with a test case for each test mode on each table, named like
+// "schema.table/full", and for the self-check on each target. Failures carry
+// the errors found along with each output and the targets that produced it.
+func (r Results) WriteAsJUnit(writer io.Writer) error {
+	suite := junitTestSuite{Name: junitSuiteName}
+
+	r.mutex.RLock()
+
+	for _, targetName := range sortedKeys(r.selfChecks) {
+		testCase := junitTestCase{Name: TestModeSelfCheck + "/" + targetName, ClassName: TestModeSelfCheck}
+
+		if output := r.selfChecks[targetName]; output != selfCheckExpected() {
+			testCase.Failure = &junitFailure{
+				Message: fmt.Sprintf("target %s failed the %s test", targetName, TestModeSelfCheck),
+				Details: fmt.Sprintf("expected %s, got %s", selfCheckExpected(), output),
+			}
+		}
+
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	for _, schema := range sortedKeys(r.content) {
+		for _, table := range sortedKeys(r.content[schema]) {
+			if r.onlyMismatches && !r.tableHasErrors(schema, table) {
+				continue
+			}
+
+			var missingErrors []error
+			for _, targetName := range r.missingTargets(schema, table) {
+				missingErrors = append(missingErrors, fmt.Errorf("table %s.%s missing on target %s", schema, table, targetName))
+			}
+
+			for _, mode := range sortedKeys(r.content[schema][table]) {
+				outputs := r.content[schema][table][mode]
+				testCase := junitTestCase{
+					Name:      qualifiedTableName(schema, table) + "/" + mode,
+					ClassName: qualifiedTableName(schema, table),
+				}
+
+				errs := append(append([]error{}, missingErrors...), r.checkModeOutputs(schema, table, mode, outputs)...)
+				if len(errs) > 0 {
+					testCase.Failure = r.junitFailure(mode, outputs, errs)
+				}
+
+				suite.TestCases = append(suite.TestCases, testCase)
+			}
+		}
+	}
+
+	r.mutex.RUnlock()
+
+	suite.Tests = len(suite.TestCases)
+
+	for _, testCase := range suite.TestCases {
+		if testCase.Failure != nil {
+			suite.Failures++
+		}
+	}
+
+	report := junitTestSuites{
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(writer, xml.Header); err != nil {
+		return errors.Wrap(err, "failed to write results")
+	}
+
+	encoder := xml.NewEncoder(writer)
+	encoder.Indent("", "  ")
+
+	if err := encoder.Encode(report); err != nil {
+		return errors.Wrap(err, "failed to encode results")
+	}
+
+	_, err := io.WriteString(writer, "\n")
+
+	return errors.Wrap(err, "failed to write results")
+}
+
+// junitFailure describes the errors found for a test mode on a table, along
+// with each of its outputs and the targets that produced it.
+func (r Results) junitFailure(mode string, outputs map[string][]string, errs []error) *junitFailure {
+	var details []string
+
+	for _, err := range errs {
+		details = append(details, err.Error())
+	}
+
+	for _, output := range sortedKeys(outputs) {
+		details = append(details, fmt.Sprintf("%s: %s", r.reportOutput(mode, output), strings.Join(outputs[output], ", ")))
+	}
+
+	return &junitFailure{Message: errs[0].Error(), Details: strings.Join(details, "\n")}
+}
@@ -0,0 +1,115 @@
+package pgverify
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The key used in keyed outputs for a NULL key, such as a NULL histogram
+// bucket, which is left unquoted to distinguish it from the string "NULL".
+const nullKey = "NULL"
+
+// formatKeyedOutput formats a test output made up of a value for each of a set
+// of keys, such as the count of each histogram bucket, as a comma separated
+// list of key=value entries sorted by key. Keys must be quoted, other than the
+// NULL key.
+func formatKeyedOutput(values map[string]string) string {
+	entries := make([]string, 0, len(values))
+	for _, key := range sortedKeys(values) {
+		entries = append(entries, key+"="+values[key])
+	}
+
+	return strings.Join(entries, ", ")
+}
+
+// parseKeyedOutput parses a test output formatted by formatKeyedOutput into
+// the value of each key.
+func parseKeyedOutput(output string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	if output == emptyTableOutput {
+		return values, nil
+	}
+
+	for output != "" {
+		var key string
+
+		if strings.HasPrefix(output, nullKey+"=") {
+			key = nullKey
+		} else {
+			quoted, err := strconv.QuotedPrefix(output)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid output key")
+			}
+
+			key = quoted
+		}
+
+		output = strings.TrimPrefix(output[len(key):], "=")
+
+		value := output
+		if end := strings.Index(output, ", "); end >= 0 {
+			value, output = output[:end], output[end+len(", "):]
+		} else {
+			output = ""
+		}
+
+		values[key] = value
+	}
+
+	return values, nil
+}
+
+// divergingKeys returns the keys whose values differ between the keyed
+// outputs, ignoring outputs that cannot be parsed such as errors.
+func divergingKeys(outputs []string) []string {
+	var parsed []map[string]string
+
+	keys := make(map[string]bool)
+
+	for _, output := range outputs {
+		values, err := parseKeyedOutput(output)
+		if err != nil {
+			continue
+		}
+
+		parsed = append(parsed, values)
+
+		for key := range values {
+			keys[key] = true
+		}
+	}
+
+	if len(parsed) < 2 {
+		return nil
+	}
+
+	var diverging []string
+
+	for _, key := range sortedKeys(keys) {
+		for _, values := range parsed[1:] {
+			if values[key] != parsed[0][key] {
+				diverging = append(diverging, key)
+
+				break
+			}
+		}
+	}
+
+	return diverging
+}
+
+// describeDivergingKeys formats the diverging keys of the keyed outputs, e.g.
+// "buckets", for inclusion in an error, or returns an empty string if there
+// are none.
+func describeDivergingKeys(outputs []string, keys string) string {
+	diverging := divergingKeys(outputs)
+	if len(diverging) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("; diverging %s: %s", keys, strings.Join(diverging, ", "))
+}
@@ -7,6 +7,22 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// Events logged as the event field of structured log lines, alongside the
+// schema, table, mode, and target, so that log lines can be counted and
+// alerted on.
+const (
+	logEventHashComputed = "hash_computed"
+	logEventHashFailed   = "hash_failed"
+	logEventHashMismatch = "hash_mismatch"
+)
+
+// Statuses logged as the status field of structured log lines.
+const (
+	logStatusOK       = "ok"
+	logStatusError    = "error"
+	logStatusMismatch = "mismatch"
+)
+
 var _ pgx.Logger = (*pgxLogger)(nil)
 
 type pgxLogger struct {
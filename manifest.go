@@ -0,0 +1,307 @@
+package pgverify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+const manifestTargetSuffix = " (manifest)"
+
+// Manifest is a serializable snapshot of the test outputs computed against a
+// single target. It can be stored and later used to verify a target without the
+// original database being available.
+type Manifest struct {
+	// Target is the name of the target the manifest was computed from.
+	Target string `json:"target"`
+	// CreatedAt is the time the manifest was computed.
+	CreatedAt time.Time `json:"created_at"`
+
+	// The configuration values that affect test outputs, recorded so that a
+	// later verification runs the same tests in the same way.
+	TestModes          []string `json:"test_modes"`
+	BookendLimit       int      `json:"bookend_limit"`
+	SparseMod          int      `json:"sparse_mod"`
+	TimestampPrecision string   `json:"timestamp_precision"`
+	ColumnOrder        string   `json:"column_order,omitempty"`
+	SampleSeed         int64    `json:"sample_seed,omitempty"`
+	// TableTestModes[schema.table] = [mode1, ...]
+	TableTestModes           map[string][]string `json:"table_test_modes,omitempty"`
+	AggregateSeparator       string              `json:"aggregate_separator,omitempty"`
+	AggregateGroupSize       int                 `json:"aggregate_group_size,omitempty"`
+	RowHashExpression        string              `json:"row_hash_expression,omitempty"`
+	ChunkSize                int                 `json:"chunk_size,omitempty"`
+	TrimText                 bool                `json:"trim_text,omitempty"`
+	NormalizeNewlines        bool                `json:"normalize_newlines,omitempty"`
+	NormalizeNaiveTimestamps bool                `json:"normalize_naive_timestamps,omitempty"`
+	TypeCasts                map[string]string   `json:"type_casts,omitempty"`
+	TypeAliases              map[string]string   `json:"type_aliases,omitempty"`
+	CaseInsensitiveColumns   []string            `json:"case_insensitive_columns,omitempty"`
+	LargeObjectColumns       []string            `json:"large_object_columns,omitempty"`
+	SystemColumns            []string            `json:"system_columns,omitempty"`
+	AllowNoPrimaryKey        bool                `json:"allow_no_primary_key,omitempty"`
+	BookendAsFull            bool                `json:"bookend_as_full,omitempty"`
+	SkipEmptyTables          bool                `json:"skip_empty_tables,omitempty"`
+	ShardIndex               int                 `json:"shard_index,omitempty"`
+	ShardCount               int                 `json:"shard_count,omitempty"`
+	// ExcludedPrimaryKeys[schema.table] = [key1, ...]
+	ExcludedPrimaryKeys map[string][]string `json:"excluded_primary_keys,omitempty"`
+	// HistogramColumns[schema.table] = column
+	HistogramColumns map[string]string `json:"histogram_columns,omitempty"`
+	DistinctColumns  []string          `json:"distinct_columns,omitempty"`
+	// TimeWindows[schema.table] = window
+	TimeWindows map[string]TimeWindow `json:"time_windows,omitempty"`
+	// RowFilters[schema.table] = predicate
+	RowFilters map[string]string `json:"row_filters,omitempty"`
+	// TargetRowFilters[schema.table] = predicate, on the target the manifest
+	// was computed from.
+	TargetRowFilters map[string]string `json:"target_row_filters,omitempty"`
+	// ShardedTables[schema.table] = [shard1, ...], on the target the manifest
+	// was computed from.
+	ShardedTables map[string][]string `json:"sharded_tables,omitempty"`
+
+	// The filters selecting the tables and columns verified, recorded so that
+	// a later verification checks the same tables and columns.
+	IncludeTables        []string `json:"include_tables,omitempty"`
+	ExcludeTables        []string `json:"exclude_tables,omitempty"`
+	IncludeSchemas       []string `json:"include_schemas,omitempty"`
+	ExcludeSchemas       []string `json:"exclude_schemas,omitempty"`
+	ExcludeSystemSchemas bool     `json:"exclude_system_schemas,omitempty"`
+	SchemaPatterns       []string `json:"schema_patterns,omitempty"`
+	IncludeColumns       []string `json:"include_columns,omitempty"`
+	ExcludeColumns       []string `json:"exclude_columns,omitempty"`
+	ExcludeColumnTypes   []string `json:"exclude_column_types,omitempty"`
+	LatestPartitions     int      `json:"latest_partitions,omitempty"`
+	// VerifyPartitionParents only applies with LatestPartitions.
+	VerifyPartitionParents bool    `json:"verify_partition_parents,omitempty"`
+	SampleTablesPercent    float64 `json:"sample_tables_percent,omitempty"`
+	SampleTablesSeed       int64   `json:"sample_tables_seed,omitempty"`
+
+	// Results contains the test outputs, keyed by schema, table, and test mode.
+	Results SingleResult `json:"results"`
+}
+
+// ReadManifest decodes a JSON encoded Manifest from the given io.Reader.
+func ReadManifest(reader io.Reader) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+		return nil, errors.Wrap(err, "failed to decode manifest")
+	}
+
+	return &manifest, nil
+}
+
+// Write encodes the Manifest as JSON to the given io.Writer.
+func (m *Manifest) Write(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	return errors.Wrap(encoder.Encode(m), "failed to encode manifest")
+}
+
+// ComputeManifest runs all configured verification tests against a single
+// target, returning the outputs as a Manifest.
+func (c Config) ComputeManifest(ctx context.Context, target *pgx.ConnConfig) (*Manifest, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	targetName := c.targetNames([]*pgx.ConnConfig{target})[0]
+	logger := c.Logger.WithField("target", targetName)
+
+	conn, err := c.connectTarget(ctx, target, targetName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to target %s", targetName)
+	}
+	defer conn.Close(ctx)
+
+	if c.ExplainThreshold > 0 {
+		c.overExplainThresholdTables = c.fetchOverExplainThresholdTables(ctx, []*pgx.Conn{conn}, []string{targetName})
+	}
+
+	result, err := c.computeTargetResult(ctx, logger, targetName, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Manifest computed")
+
+	return c.newManifest(targetName, result.hashes), nil
+}
+
+// newManifest returns a Manifest of the test outputs computed from the target,
+// recording the configuration values that affect them.
+func (c Config) newManifest(targetName string, hashes SingleResult) *Manifest {
+	return &Manifest{
+		Target:                   targetName,
+		CreatedAt:                time.Now().UTC(),
+		TestModes:                c.TestModes,
+		BookendLimit:             c.BookendLimit,
+		SparseMod:                c.SparseMod,
+		TimestampPrecision:       c.TimestampPrecision,
+		ColumnOrder:              c.ColumnOrder,
+		SampleSeed:               c.SampleSeed,
+		TableTestModes:           c.TableTestModes,
+		AggregateSeparator:       c.AggregateSeparator,
+		AggregateGroupSize:       c.AggregateGroupSize,
+		RowHashExpression:        c.RowHashExpression,
+		ChunkSize:                c.ChunkSize,
+		TrimText:                 c.TrimText,
+		NormalizeNewlines:        c.NormalizeNewlines,
+		NormalizeNaiveTimestamps: c.NormalizeNaiveTimestamps,
+		TypeCasts:                c.TypeCasts,
+		TypeAliases:              c.TypeAliases,
+		CaseInsensitiveColumns:   c.CaseInsensitiveColumns,
+		LargeObjectColumns:       c.LargeObjectColumns,
+		SystemColumns:            c.SystemColumns,
+		AllowNoPrimaryKey:        c.AllowNoPrimaryKey,
+		BookendAsFull:            c.BookendAsFull,
+		SkipEmptyTables:          c.SkipEmptyTables,
+		ShardIndex:               c.ShardIndex,
+		ShardCount:               c.ShardCount,
+		ExcludedPrimaryKeys:      c.ExcludedPrimaryKeys,
+		HistogramColumns:         c.HistogramColumns,
+		DistinctColumns:          c.DistinctColumns,
+		TimeWindows:              c.TimeWindows,
+		RowFilters:               c.RowFilters,
+		TargetRowFilters:         c.TargetRowFilters[targetName],
+		ShardedTables:            c.ShardedTables[targetName],
+		IncludeTables:            c.IncludeTables,
+		ExcludeTables:            c.ExcludeTables,
+		IncludeSchemas:           c.IncludeSchemas,
+		ExcludeSchemas:           c.ExcludeSchemas,
+		ExcludeSystemSchemas:     c.ExcludeSystemSchemas,
+		SchemaPatterns:           c.SchemaPatterns,
+		IncludeColumns:           c.IncludeColumns,
+		ExcludeColumns:           c.ExcludeColumns,
+		ExcludeColumnTypes:       c.ExcludeColumnTypes,
+		LatestPartitions:         c.LatestPartitions,
+		VerifyPartitionParents:   c.VerifyPartitionParents,
+		SampleTablesPercent:      c.SampleTablesPercent,
+		SampleTablesSeed:         c.SampleTablesSeed,
+		Results:                  hashes,
+	}
+}
+
+// configure returns the config with the configuration values recorded in the
+// manifest, for verifying the named target against it.
+func (m *Manifest) configure(c Config, targetName string) Config {
+	c.TestModes = m.TestModes
+	c.BookendLimit = m.BookendLimit
+	c.SparseMod = m.SparseMod
+	c.TimestampPrecision = m.TimestampPrecision
+	c.ColumnOrder = m.ColumnOrder
+	c.SampleSeed = m.SampleSeed
+	c.TableTestModes = m.TableTestModes
+	c.AggregateSeparator = m.AggregateSeparator
+	c.AggregateGroupSize = m.AggregateGroupSize
+	c.RowHashExpression = m.RowHashExpression
+	c.ChunkSize = m.ChunkSize
+	c.TrimText = m.TrimText
+	c.NormalizeNewlines = m.NormalizeNewlines
+	c.NormalizeNaiveTimestamps = m.NormalizeNaiveTimestamps
+	c.TypeCasts = m.TypeCasts
+	c.TypeAliases = m.TypeAliases
+	c.CaseInsensitiveColumns = m.CaseInsensitiveColumns
+	c.LargeObjectColumns = m.LargeObjectColumns
+	c.SystemColumns = m.SystemColumns
+	c.AllowNoPrimaryKey = m.AllowNoPrimaryKey
+	c.BookendAsFull = m.BookendAsFull
+	c.SkipEmptyTables = m.SkipEmptyTables
+	c.ShardIndex = m.ShardIndex
+	c.ShardCount = m.ShardCount
+	c.ExcludedPrimaryKeys = m.ExcludedPrimaryKeys
+	c.HistogramColumns = m.HistogramColumns
+	c.DistinctColumns = m.DistinctColumns
+	c.TimeWindows = m.TimeWindows
+	c.RowFilters = m.RowFilters
+	c.IncludeTables = m.IncludeTables
+	c.ExcludeTables = m.ExcludeTables
+	c.IncludeSchemas = m.IncludeSchemas
+	c.ExcludeSchemas = m.ExcludeSchemas
+	c.ExcludeSystemSchemas = m.ExcludeSystemSchemas
+	c.SchemaPatterns = m.SchemaPatterns
+	c.IncludeColumns = m.IncludeColumns
+	c.ExcludeColumns = m.ExcludeColumns
+	c.ExcludeColumnTypes = m.ExcludeColumnTypes
+	c.LatestPartitions = m.LatestPartitions
+	c.VerifyPartitionParents = m.VerifyPartitionParents
+	c.SampleTablesPercent = m.SampleTablesPercent
+	c.SampleTablesSeed = m.SampleTablesSeed
+
+	// The row filters and sharded tables of the manifest's target are
+	// assumed to apply the same way to the verified target, unless configured
+	// otherwise.
+	if _, ok := c.TargetRowFilters[targetName]; !ok && len(m.TargetRowFilters) > 0 {
+		targetRowFilters := map[string]map[string]string{targetName: m.TargetRowFilters}
+		for name, filters := range c.TargetRowFilters {
+			targetRowFilters[name] = filters
+		}
+
+		c.TargetRowFilters = targetRowFilters
+	}
+
+	if _, ok := c.ShardedTables[targetName]; !ok && len(m.ShardedTables) > 0 {
+		shardedTables := map[string]map[string][]string{targetName: m.ShardedTables}
+		for name, tables := range c.ShardedTables {
+			shardedTables[name] = tables
+		}
+
+		c.ShardedTables = shardedTables
+	}
+
+	return c
+}
+
+// VerifyAgainstManifest runs the verification tests recorded in the manifest
+// against a single target and compares the outputs to those in the manifest.
+// The test configuration and the table and column filters stored in the
+// manifest override the Config values.
+func (c Config) VerifyAgainstManifest(ctx context.Context, target *pgx.ConnConfig, manifest *Manifest) (*Results, error) {
+	var finalResults *Results
+
+	targetName := c.targetNames([]*pgx.ConnConfig{target})[0]
+	c = manifest.configure(c, targetName)
+
+	if err := c.Validate(); err != nil {
+		return finalResults, err
+	}
+
+	logger := c.Logger.WithField("target", targetName)
+
+	conn, err := c.connectTarget(ctx, target, targetName)
+	if err != nil {
+		return finalResults, errors.Wrapf(err, "failed to connect to target %s", targetName)
+	}
+	defer conn.Close(ctx)
+
+	if c.ExplainThreshold > 0 {
+		c.overExplainThresholdTables = c.fetchOverExplainThresholdTables(ctx, []*pgx.Conn{conn}, []string{targetName})
+	}
+
+	result, err := c.computeTargetResult(ctx, logger, targetName, conn)
+	if err != nil {
+		return finalResults, err
+	}
+
+	manifestName := manifest.Target + manifestTargetSuffix
+
+	finalResults = c.newResults([]string{manifestName, targetName})
+	finalResults.AddResult(manifestName, manifest.Results)
+	finalResults.AddResult(targetName, result.hashes)
+	finalResults.AddWarnings(targetName, result.warnings...)
+
+	reportErrors := finalResults.CheckForErrors()
+	if len(reportErrors) > 0 {
+		return finalResults, multierr.Combine(reportErrors...)
+	}
+
+	logger.Info("Verification against manifest successful")
+
+	return finalResults, nil
+}
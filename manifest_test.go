@@ -0,0 +1,90 @@
+//nolint:testpackage // unit test for internals, *_test pattern not appropriate
+package pgverify
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestConfiguration(t *testing.T) {
+	since := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	computed := NewConfig(
+		WithTests(TestModeFull, TestModeSparse),
+		WithAggregateSeparator(","),
+		WithAggregateGroupSize(100),
+		WithRowHashExpression("encode(sha256(CONCAT(%s)::BYTEA), 'hex')"),
+		WithChunkSize(1000),
+		WithTrimText(),
+		WithNormalizeNewlines(),
+		WithNormalizeNaiveTimestamps(),
+		WithTypeCast("point", "%s::TEXT"),
+		WithTypeAlias("int4", "integer"),
+		WithCaseInsensitiveColumns("email"),
+		WithLargeObjectColumns("blob"),
+		WithSystemColumns("xmin"),
+		WithShardedTable("a", "public", "events", []string{"events_0", "events_1"}),
+		WithAllowNoPrimaryKey(),
+		WithShard(1, 4),
+		WithExcludePrimaryKeys("public", "events", []string{"42"}),
+		WithHistogramColumn("public", "events", "created_at"),
+		WithDistinctColumns("status"),
+		WithTimeWindow("public", "events", "created_at", since, since.Add(time.Hour)),
+		WithRowFilter("public", "events", "id > 10"),
+		WithTargetRowFilter("a", "public", "events", "tenant = 1"),
+		IncludeSchemas("public"),
+		IncludeTables("events"),
+		WithSchemaPattern("tenant_*"),
+		WithExcludeSystemSchemas(),
+		ExcludeColumns("updated_at"),
+		WithExcludeColumnTypes("bytea"),
+		WithSampleTables(50, 7),
+	)
+
+	var buf bytes.Buffer
+	require.NoError(t, computed.newManifest("a", SingleResult{}).Write(&buf))
+
+	manifest, err := ReadManifest(&buf)
+	require.NoError(t, err)
+
+	verified := manifest.configure(NewConfig(), "b")
+	require.NoError(t, verified.Validate())
+
+	require.Equal(t, computed.TestModes, verified.TestModes)
+	require.Equal(t, computed.AggregateSeparator, verified.AggregateSeparator)
+	require.Equal(t, computed.AggregateGroupSize, verified.AggregateGroupSize)
+	require.Equal(t, computed.RowHashExpression, verified.RowHashExpression)
+	require.Equal(t, computed.ChunkSize, verified.ChunkSize)
+	require.True(t, verified.TrimText)
+	require.True(t, verified.NormalizeNewlines)
+	require.True(t, verified.NormalizeNaiveTimestamps)
+	require.Equal(t, computed.TypeCasts, verified.TypeCasts)
+	require.Equal(t, computed.TypeAliases, verified.TypeAliases)
+	require.Equal(t, computed.CaseInsensitiveColumns, verified.CaseInsensitiveColumns)
+	require.Equal(t, computed.LargeObjectColumns, verified.LargeObjectColumns)
+	require.Equal(t, computed.SystemColumns, verified.SystemColumns)
+	require.Equal(t, computed.ShardedTables["a"], verified.ShardedTables["b"])
+	require.True(t, verified.AllowNoPrimaryKey)
+	require.Equal(t, [2]int{1, 4}, [2]int{verified.ShardIndex, verified.ShardCount})
+	require.Equal(t, computed.ExcludedPrimaryKeys, verified.ExcludedPrimaryKeys)
+	require.Equal(t, computed.HistogramColumns, verified.HistogramColumns)
+	require.Equal(t, computed.DistinctColumns, verified.DistinctColumns)
+	require.Equal(t, computed.TimeWindows, verified.TimeWindows)
+	require.Equal(t, computed.RowFilters, verified.RowFilters)
+	require.Equal(t, computed.TargetRowFilters["a"], verified.TargetRowFilters["b"])
+	require.Equal(t, computed.IncludeSchemas, verified.IncludeSchemas)
+	require.Equal(t, computed.IncludeTables, verified.IncludeTables)
+	require.Equal(t, computed.SchemaPatterns, verified.SchemaPatterns)
+	require.True(t, verified.ExcludeSystemSchemas)
+	require.Equal(t, computed.ExcludeColumns, verified.ExcludeColumns)
+	require.Equal(t, computed.ExcludeColumnTypes, verified.ExcludeColumnTypes)
+	require.Equal(t, computed.SampleTablesPercent, verified.SampleTablesPercent)
+	require.Equal(t, computed.SampleTablesSeed, verified.SampleTablesSeed)
+
+	// Sharding configured for the verified target takes precedence.
+	resharded := manifest.configure(NewConfig(WithShardedTable("b", "public", "events", []string{"events"})), "b")
+	require.Equal(t, []string{"events"}, resharded.ShardedTables["b"]["public.events"])
+}
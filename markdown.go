@@ -0,0 +1,51 @@
+package pgverify
+
+import (
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// markdownCellReplacer escapes the characters that would otherwise end a cell
+// or row of a Markdown table.
+var markdownCellReplacer = strings.NewReplacer(`|`, `\|`, "\r\n", "<br>", "\n", "<br>")
+
+// WriteAsMarkdown writes the results as a GitHub flavored Markdown table to
+// the given io.Writer, with the same columns and rows as WriteAsTable, for
+// pasting into issues and pull requests.
+func (r Results) WriteAsMarkdown(writer io.Writer) error {
+	r.mutex.RLock()
+	header, rows := r.tableRows()
+	r.mutex.RUnlock()
+
+	var builder strings.Builder
+
+	writeMarkdownRow(&builder, header)
+
+	separator := make([]string, len(header))
+	for i := range separator {
+		separator[i] = "---"
+	}
+
+	writeMarkdownRow(&builder, separator)
+
+	for _, row := range rows {
+		writeMarkdownRow(&builder, row)
+	}
+
+	_, err := io.WriteString(writer, builder.String())
+
+	return errors.Wrap(err, "failed to write markdown")
+}
+
+// writeMarkdownRow writes a row of a Markdown table, escaping the cells.
+func writeMarkdownRow(builder *strings.Builder, cells []string) {
+	builder.WriteString("|")
+
+	for _, cell := range cells {
+		builder.WriteString(" " + markdownCellReplacer.Replace(cell) + " |")
+	}
+
+	builder.WriteString("\n")
+}
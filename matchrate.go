@@ -0,0 +1,48 @@
+package pgverify
+
+import (
+	"fmt"
+	"io"
+)
+
+// MatchRate is the number of tables a test mode matched on across all targets,
+// out of the tables it was run on.
+type MatchRate struct {
+	Matched int `json:"matched"`
+	Total   int `json:"total"`
+}
+
+// MatchRateByMode returns the match rate of each test mode run, as a summary
+// of the results, e.g. for a status page. A table matches a test mode if its
+// outputs are the same and are not errors on every target.
+func (r *Results) MatchRateByMode() map[string]MatchRate {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	rates := make(map[string]MatchRate)
+
+	for schema, tables := range r.content {
+		for table, modes := range tables {
+			for mode := range modes {
+				rate := rates[mode]
+				rate.Total++
+
+				if r.testPasses(schema, table, mode) {
+					rate.Matched++
+				}
+
+				rates[mode] = rate
+			}
+		}
+	}
+
+	return rates
+}
+
+// writeMatchRateSummary writes a line summarizing the match rate of each test
+// mode, sorted by test mode.
+func writeMatchRateSummary(writer io.Writer, rates map[string]MatchRate) {
+	for _, mode := range sortedKeys(rates) {
+		fmt.Fprintf(writer, "%s: %d/%d tables matched\n", mode, rates[mode].Matched, rates[mode].Total)
+	}
+}
@@ -0,0 +1,126 @@
+package pgverify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// OutputFormatTable renders the results as a human readable table.
+	OutputFormatTable = "table"
+	// OutputFormatJSON renders the results as a JSON document.
+	OutputFormatJSON = "json"
+	// OutputFormatPairwise renders a matrix of how many table test modes each
+	// pair of targets agree on.
+	OutputFormatPairwise = "pairwise"
+	// OutputFormatJUnit renders the results as a JUnit XML report, for test
+	// reporting tools.
+	OutputFormatJUnit = "junit"
+	// OutputFormatMarkdown renders the results as a GitHub flavored Markdown
+	// table, for pasting into issues and pull requests.
+	OutputFormatMarkdown = "markdown"
+)
+
+// OutputFormats lists the supported output formats.
+func OutputFormats() []string {
+	return []string{OutputFormatTable, OutputFormatJSON, OutputFormatPairwise, OutputFormatJUnit, OutputFormatMarkdown}
+}
+
+// WriteAsFormat writes the results in the given output format to the given
+// io.Writer.
+func (r Results) WriteAsFormat(format string, writer io.Writer) error {
+	switch format {
+	case OutputFormatTable:
+		r.WriteAsTable(writer)
+
+		return nil
+	case OutputFormatJSON:
+		return r.WriteAsJSON(writer)
+	case OutputFormatJUnit:
+		return r.WriteAsJUnit(writer)
+	case OutputFormatMarkdown:
+		return r.WriteAsMarkdown(writer)
+	case OutputFormatPairwise:
+		writePairwiseSummary(writer, r.PairwiseMatrix(), r.targetNames)
+
+		return nil
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
+
+// jsonResults is the JSON representation of Results.
+type jsonResults struct {
+	Targets   []string `json:"targets"`
+	TestModes []string `json:"test_modes"`
+	// Results[schema][table][mode][output] = [targetName1, ...]
+	Results     map[string]map[string]map[string]map[string][]string `json:"results"`
+	Errors      []string                                             `json:"errors"`
+	Warnings    []string                                             `json:"warnings"`
+	Connections []ConnectionStatus                                   `json:"connections"`
+	// Versions[targetName] = engine version
+	Versions      map[string]string `json:"versions"`
+	HashedColumns []TableColumns    `json:"hashed_columns"`
+	// MatchRates[mode] = tables matched out of total
+	MatchRates map[string]MatchRate `json:"match_rates"`
+}
+
+// WriteAsJSON writes the results as a JSON document to the given io.Writer.
+func (r Results) WriteAsJSON(writer io.Writer) error {
+	output := jsonResults{
+		Targets:       r.targetNames,
+		TestModes:     r.testModes,
+		Results:       make(map[string]map[string]map[string]map[string][]string),
+		Errors:        []string{},
+		Warnings:      r.Warnings(),
+		Connections:   r.Connections(),
+		Versions:      r.Versions(),
+		HashedColumns: r.HashedColumns(),
+		MatchRates:    r.MatchRateByMode(),
+	}
+
+	r.mutex.RLock()
+
+	for schema, tables := range r.content {
+		for table, modes := range tables {
+			if r.onlyMismatches && !r.tableHasErrors(schema, table) {
+				continue
+			}
+
+			if _, ok := output.Results[schema]; !ok {
+				output.Results[schema] = make(map[string]map[string]map[string][]string)
+			}
+
+			output.Results[schema][table] = make(map[string]map[string][]string)
+
+			for mode, outputs := range modes {
+				output.Results[schema][table][mode] = make(map[string][]string)
+
+				for testOutput, targets := range outputs {
+					// Distinct outputs may share a redacted placeholder.
+					reportOutput := r.reportOutput(mode, testOutput)
+					sortedTargets := append(output.Results[schema][table][mode][reportOutput], targets...)
+					sort.Strings(sortedTargets)
+					output.Results[schema][table][mode][reportOutput] = sortedTargets
+				}
+			}
+		}
+	}
+
+	for _, err := range r.checkForErrors() {
+		output.Errors = append(output.Errors, err.Error())
+	}
+
+	r.mutex.RUnlock()
+
+	sort.Strings(output.Errors)
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	return errors.Wrap(encoder.Encode(output), "failed to encode results")
+}
@@ -0,0 +1,96 @@
+package pgverify
+
+import (
+	"fmt"
+	"io"
+)
+
+// AgreementMatrix records which pairs of targets produced the same output for
+// a single test mode on a single table.
+type AgreementMatrix struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	Mode   string `json:"mode"`
+	// Targets are the names of the targets, in the order of the rows and
+	// columns of Agree.
+	Targets []string `json:"targets"`
+	// Agree[i][j] is whether Targets[i] and Targets[j] produced the same
+	// output. Targets that errored or produced no output agree with no
+	// targets, including themselves.
+	Agree [][]bool `json:"agree"`
+}
+
+// PairwiseMatrix returns an agreement matrix of the targets for each test
+// mode on each table, ordered by schema, table, and test mode.
+func (r *Results) PairwiseMatrix() []AgreementMatrix {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	index := make(map[string]int, len(r.targetNames))
+	for i, targetName := range r.targetNames {
+		index[targetName] = i
+	}
+
+	var matrices []AgreementMatrix
+
+	for _, schema := range sortedKeys(r.content) {
+		for _, table := range sortedKeys(r.content[schema]) {
+			for _, mode := range sortedKeys(r.content[schema][table]) {
+				matrix := AgreementMatrix{
+					Schema:  schema,
+					Table:   table,
+					Mode:    mode,
+					Targets: r.targetNames,
+					Agree:   make([][]bool, len(r.targetNames)),
+				}
+
+				for i := range matrix.Agree {
+					matrix.Agree[i] = make([]bool, len(r.targetNames))
+				}
+
+				for output, targets := range r.content[schema][table][mode] {
+					if output == defaultErrorOutput || output == lockTimeoutOutput {
+						continue
+					}
+
+					for _, a := range targets {
+						for _, b := range targets {
+							matrix.Agree[index[a]][index[b]] = true
+						}
+					}
+				}
+
+				matrices = append(matrices, matrix)
+			}
+		}
+	}
+
+	return matrices
+}
+
+// writePairwiseSummary writes a table with a row and column for each target,
+// where each cell is the number of table test modes that the pair of targets
+// agree on, out of the total.
+func writePairwiseSummary(writer io.Writer, matrices []AgreementMatrix, targetNames []string) {
+	header := append([]string{""}, targetNames...)
+
+	rows := make([][]string, len(targetNames))
+
+	for i, targetName := range targetNames {
+		rows[i] = []string{targetName}
+
+		for j := range targetNames {
+			agreed := 0
+
+			for _, matrix := range matrices {
+				if matrix.Agree[i][j] {
+					agreed++
+				}
+			}
+
+			rows[i] = append(rows[i], fmt.Sprintf("%d/%d", agreed, len(matrices)))
+		}
+	}
+
+	writeTable(writer, header, rows, nil)
+}
@@ -0,0 +1,150 @@
+package pgverify
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// Lists the partitions of each partitioned table, along with their partition
+// bounds, e.g. "FOR VALUES FROM ('2022-01-01') TO ('2022-02-01')".
+const getPartitionsQuery = `
+	SELECT pn.nspname, p.relname, cn.nspname, c.relname, coalesce(pg_get_expr(c.relpartbound, c.oid), '')
+	FROM pg_catalog.pg_inherits AS i
+		JOIN pg_catalog.pg_class AS p ON p.oid = i.inhparent
+		JOIN pg_catalog.pg_namespace AS pn ON pn.oid = p.relnamespace
+		JOIN pg_catalog.pg_class AS c ON c.oid = i.inhrelid
+		JOIN pg_catalog.pg_namespace AS cn ON cn.oid = c.relnamespace
+	WHERE p.relkind = 'p'`
+
+// Matches the lower bound of a range partition.
+var rangeLowerBoundPattern = regexp.MustCompile(`FROM \((.*?)\) TO \(`)
+
+// partition is a partition of a partitioned table, identified as
+// "schema.table".
+type partition struct {
+	parent string
+	name   string
+	bound  string
+}
+
+// partitionLowerBound returns the lower bound of a range partition, unquoted,
+// or false if the partition is not a range partition or is unbounded below.
+func partitionLowerBound(bound string) (string, bool) {
+	match := rangeLowerBoundPattern.FindStringSubmatch(bound)
+	if match == nil || strings.EqualFold(match[1], "MINVALUE") {
+		return "", false
+	}
+
+	return strings.Trim(match[1], "'"), true
+}
+
+// partitionBefore returns whether partition a is older than partition b.
+// Range partitions are ordered by their lower bounds, numerically if both are
+// numbers. Other partitions, such as list, hash, and default partitions, are
+// ordered by name before all range partitions.
+func partitionBefore(a, b partition) bool {
+	aBound, aIsRange := partitionLowerBound(a.bound)
+	bBound, bIsRange := partitionLowerBound(b.bound)
+
+	switch {
+	case aIsRange != bIsRange:
+		return bIsRange
+	case !aIsRange || aBound == bBound:
+		return a.name < b.name
+	}
+
+	aNumber, aErr := strconv.ParseFloat(aBound, 64)
+	bNumber, bErr := strconv.ParseFloat(bBound, 64)
+
+	if aErr == nil && bErr == nil {
+		return aNumber < bNumber
+	}
+
+	return aBound < bBound
+}
+
+// skippedPartitions returns the set of tables, as "schema.table", to skip so
+// that only the newest n partitions of each partitioned table are verified.
+// Partitioned parent tables are skipped too, unless includeParents is set.
+func skippedPartitions(partitions []partition, n int, includeParents bool) map[string]bool {
+	byParent := make(map[string][]partition)
+	for _, p := range partitions {
+		byParent[p.parent] = append(byParent[p.parent], p)
+	}
+
+	skipped := make(map[string]bool)
+
+	for parent, children := range byParent {
+		if !includeParents {
+			skipped[parent] = true
+		}
+
+		sort.Slice(children, func(i, j int) bool {
+			return partitionBefore(children[i], children[j])
+		})
+
+		for i := 0; i < len(children)-n; i++ {
+			skipped[children[i].name] = true
+		}
+	}
+
+	return skipped
+}
+
+// fetchSkippedPartitions returns the set of tables, as "schema.table", to skip
+// so that only the newest LatestPartitions partitions of each partitioned
+// table are verified. Partitions are combined across targets, so the same
+// partitions are verified on every target. If partitions cannot be listed on
+// any target, nil is returned and all tables are verified.
+func (c Config) fetchSkippedPartitions(ctx context.Context, conns []*pgx.Conn, targetNames []string) map[string]bool {
+	seen := make(map[string]bool)
+
+	var partitions []partition
+
+	for i, conn := range conns {
+		logger := c.Logger.WithField("target", targetNames[i])
+
+		rows, err := conn.Query(ctx, getPartitionsQuery)
+		if err != nil {
+			logger.WithError(wrapQueryError(err, getPartitionsQuery)).Warn("Failed to list partitions, verifying all partitions")
+
+			return nil
+		}
+
+		for rows.Next() {
+			var parentSchema, parentTable, schema, table, bound pgtype.Text
+			if err := rows.Scan(&parentSchema, &parentTable, &schema, &table, &bound); err != nil {
+				rows.Close()
+				logger.WithError(err).Warn("Failed to scan partitions, verifying all partitions")
+
+				return nil
+			}
+
+			name := qualifiedTableName(c.comparisonSchema(targetNames[i], schema.String), table.String)
+			if seen[name] {
+				continue
+			}
+
+			seen[name] = true
+			partitions = append(partitions, partition{
+				parent: qualifiedTableName(c.comparisonSchema(targetNames[i], parentSchema.String), parentTable.String),
+				name:   name,
+				bound:  bound.String,
+			})
+		}
+
+		if err := rows.Err(); err != nil {
+			logger.WithError(err).Warn("Failed to list partitions, verifying all partitions")
+
+			return nil
+		}
+	}
+
+	return skippedPartitions(partitions, c.LatestPartitions, c.VerifyPartitionParents)
+}
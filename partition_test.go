@@ -0,0 +1,36 @@
+//nolint:testpackage // unit test for internals, *_test pattern not appropriate
+package pgverify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkippedPartitions(t *testing.T) {
+	partitions := []partition{
+		{parent: "public.events", name: "public.events_2022_03", bound: "FOR VALUES FROM ('2022-03-01 00:00:00') TO ('2022-04-01 00:00:00')"},
+		{parent: "public.events", name: "public.events_2022_01", bound: "FOR VALUES FROM ('2022-01-01 00:00:00') TO ('2022-02-01 00:00:00')"},
+		{parent: "public.events", name: "public.events_default", bound: "DEFAULT"},
+		{parent: "public.events", name: "public.events_2022_02", bound: "FOR VALUES FROM ('2022-02-01 00:00:00') TO ('2022-03-01 00:00:00')"},
+		{parent: "public.ids", name: "public.ids_900", bound: "FOR VALUES FROM (900) TO (1000)"},
+		{parent: "public.ids", name: "public.ids_1000", bound: "FOR VALUES FROM (1000) TO (1100)"},
+		{parent: "public.ids", name: "public.ids_min", bound: "FOR VALUES FROM (MINVALUE) TO (900)"},
+	}
+
+	require.Equal(t, map[string]bool{
+		"public.events":         true,
+		"public.events_default": true,
+		"public.events_2022_01": true,
+		"public.ids":            true,
+		"public.ids_min":        true,
+	}, skippedPartitions(partitions, 2, false))
+
+	require.Equal(t, map[string]bool{
+		"public.events_default": true,
+		"public.events_2022_01": true,
+		"public.events_2022_02": true,
+		"public.ids_min":        true,
+		"public.ids_900":        true,
+	}, skippedPartitions(partitions, 1, true))
+}
@@ -0,0 +1,83 @@
+package pgverify
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+// TargetStatus is the outcome of checking connectivity to a target.
+type TargetStatus struct {
+	// Target is the name of the target.
+	Target string
+	// Tables is the number of tables visible on the target after applying
+	// the configured schema and table filters.
+	Tables int
+	// Err is the error connecting to or querying the target, if any.
+	Err error
+}
+
+// OK returns whether the target could be connected to and its tables listed.
+func (s TargetStatus) OK() bool {
+	return s.Err == nil
+}
+
+// Ping checks that each target can be connected to and queried, and counts
+// the tables visible for verification on each, without running any tests.
+// A status is returned for every target, in target order, along with the
+// combined errors of any targets that failed.
+func (c Config) Ping(ctx context.Context, targets []*pgx.ConnConfig) ([]TargetStatus, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	targetNames := c.targetNames(targets)
+	statuses := make([]TargetStatus, len(targets))
+
+	var pingErrors []error
+
+	for i, target := range targets {
+		statuses[i] = c.pingTarget(ctx, target, targetNames[i])
+		if statuses[i].Err != nil {
+			pingErrors = append(pingErrors, errors.Wrapf(statuses[i].Err, "target %s", targetNames[i]))
+		}
+	}
+
+	return statuses, multierr.Combine(pingErrors...)
+}
+
+// pingTarget connects to the target, runs a trivial query, and counts the
+// tables visible for verification.
+func (c Config) pingTarget(ctx context.Context, target *pgx.ConnConfig, targetName string) TargetStatus {
+	status := TargetStatus{Target: targetName}
+
+	conn, err := c.connectTarget(ctx, target, targetName)
+	if err != nil {
+		status.Err = errors.Wrap(err, "failed to connect")
+
+		return status
+	}
+	defer conn.Close(ctx)
+
+	var one int
+	if err := conn.QueryRow(ctx, "SELECT 1").Scan(&one); err != nil {
+		status.Err = errors.Wrap(err, "failed to query")
+
+		return status
+	}
+
+	schemaTables, err := c.fetchTargetTableNames(ctx, c.Logger.WithField("target", targetName), targetName, conn)
+	if err != nil {
+		status.Err = err
+
+		return status
+	}
+
+	for _, tables := range schemaTables {
+		status.Tables += len(tables)
+	}
+
+	return status
+}
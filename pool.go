@@ -0,0 +1,75 @@
+package pgverify
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// connPool is a fixed set of connections to a single target, used to run
+// queries concurrently.
+type connPool struct {
+	idle chan *pgx.Conn
+	// Connections opened by the pool, which are closed with it. The target's
+	// original connection is owned by the caller.
+	opened []*pgx.Conn
+}
+
+// newConnPool creates a pool of the given connection.
+func newConnPool(conn *pgx.Conn) *connPool {
+	pool := &connPool{idle: make(chan *pgx.Conn, 1)}
+	pool.idle <- conn
+
+	return pool
+}
+
+// growConnPool opens connections to the target of the pool's connection until
+// the pool has the given number of connections. It must be called before the
+// pool is used.
+func (c Config) growConnPool(ctx context.Context, pool *connPool, size int, targetName string) error {
+	if size <= 1 {
+		return nil
+	}
+
+	conn := <-pool.idle
+	idle := make(chan *pgx.Conn, size)
+	idle <- conn
+
+	for i := 1; i < size; i++ {
+		extra, err := c.connectTarget(ctx, conn.Config(), targetName)
+		if err != nil {
+			pool.idle = idle
+
+			return err
+		}
+
+		pool.opened = append(pool.opened, extra)
+		idle <- extra
+	}
+
+	pool.idle = idle
+
+	return nil
+}
+
+// acquire waits for an idle connection, which must be released after use.
+func (p *connPool) acquire(ctx context.Context) (*pgx.Conn, error) {
+	select {
+	case conn := <-p.idle:
+		return conn, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release returns an acquired connection to the pool.
+func (p *connPool) release(conn *pgx.Conn) {
+	p.idle <- conn
+}
+
+// close closes the connections opened by the pool.
+func (p *connPool) close(ctx context.Context) {
+	for _, conn := range p.opened {
+		conn.Close(ctx)
+	}
+}
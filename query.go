@@ -4,9 +4,15 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// PostgreSQL limits functions to 100 arguments, including variadic ones like
+// CONCAT, so wide column lists are split into nested CONCAT calls.
+const maxConcatArgs = 100
+
 var reduceSpaceRegex = regexp.MustCompile(`\s+`)
 
 func formatQuery(query string) string {
@@ -15,59 +21,212 @@ func formatQuery(query string) string {
 	return strings.TrimSpace(query)
 }
 
+// Builds a CONCAT expression of the given expressions. Since CONCAT of CONCATs
+// produces the same string as a single flat CONCAT, argument lists exceeding
+// maxConcatArgs are chunked into nested calls without changing the result.
+func buildConcat(exprs []string) string {
+	for len(exprs) > maxConcatArgs {
+		var chunks []string
+
+		for start := 0; start < len(exprs); start += maxConcatArgs {
+			end := start + maxConcatArgs
+			if end > len(exprs) {
+				end = len(exprs)
+			}
+
+			chunks = append(chunks, "CONCAT("+strings.Join(exprs[start:end], ", ")+")")
+		}
+
+		exprs = chunks
+	}
+
+	return "CONCAT(" + strings.Join(exprs, ", ") + ")"
+}
+
+// quoteIdent quotes the name as a SQL identifier with double quotes, as on
+// PostgreSQL and CockroachDB, so that reserved words and names with uppercase
+// or special characters are used verbatim. All identifiers in generated
+// queries are quoted here.
+func (c Config) quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteTable quotes the schema-qualified name of a table, or returns the union
+// of its shards if the table is sharded on the target.
+func (c Config) quoteTable(schemaName, tableName string) string {
+	if shards, ok := c.quoteShardedTable(schemaName, tableName); ok {
+		return shards
+	}
+
+	return c.quoteIdent(schemaName) + "." + c.quoteIdent(tableName)
+}
+
+// quoteLiteral quotes the value as a SQL string literal.
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// hashSeparator returns the SQL literal of the separator row hashes are
+// aggregated with.
+func (c Config) hashSeparator() string {
+	return quoteLiteral(c.AggregateSeparator)
+}
+
+// aggregateGroupSize returns the configured aggregate group size, or the
+// default if none is configured.
+func (c Config) aggregateGroupSize() int {
+	if c.AggregateGroupSize <= 0 {
+		return DefaultAggregateGroupSize
+	}
+
+	return c.AggregateGroupSize
+}
+
+// Returns the schema-qualified name of a table, used as a key in table-specific
+// configuration.
+func qualifiedTableName(schemaName, tableName string) string {
+	return schemaName + "." + tableName
+}
+
+// Combines the given SQL predicates into a WHERE clause, prefixed with a space
+// so it can be appended directly to a FROM clause. Returns an empty string if
+// there are no predicates.
+func buildWhereClause(predicates []string) string {
+	if len(predicates) == 0 {
+		return ""
+	}
+
+	return " WHERE " + buildPredicate(predicates)
+}
+
+// Combines the given SQL predicates into a single expression joined by AND.
+func buildPredicate(predicates []string) string {
+	wrapped := make([]string, len(predicates))
+	for i, predicate := range predicates {
+		wrapped[i] = "(" + predicate + ")"
+	}
+
+	return strings.Join(wrapped, " AND ")
+}
+
+// Builds a predicate matching rows with a timestamp column value within the
+// time window, comparing the same epoch representation used when hashing.
+func buildTimeWindowPredicate(config Config, window TimeWindow) string {
+	epoch := epochExpression(config, config.quoteIdent(window.Column))
+
+	return fmt.Sprintf("%s >= %d AND %s < %d", epoch, window.Since.UnixMicro(), epoch, window.Until.UnixMicro())
+}
+
+// Builds a predicate excluding the rows with the given primary keys, which are
+// SQL literals, or tuples of literals for the primary key columns in
+// alphabetical order.
+func buildExcludedKeysPredicate(config Config, primaryKeyNames []string, keys []string) string {
+	sorted := append([]string{}, primaryKeyNames...)
+	sort.Strings(sorted)
+
+	quoted := make([]string, len(sorted))
+	for i, name := range sorted {
+		quoted[i] = config.quoteIdent(name)
+	}
+
+	keyExpression := quoted[0]
+	if len(quoted) > 1 {
+		keyExpression = "(" + strings.Join(quoted, ", ") + ")"
+	}
+
+	return fmt.Sprintf("%s NOT IN (%s)", keyExpression, strings.Join(keys, ", "))
+}
+
+// Builds an 'IN' (or 'NOT IN') SQL expression matching the column against
+// the list of string values.
+func buildInClause(columnName string, values []string, negate bool) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("'%s'", value)
+	}
+
+	operator := "IN"
+	if negate {
+		operator = "NOT IN"
+	}
+
+	return fmt.Sprintf("%s %s (%s)", columnName, operator, strings.Join(quoted, ", "))
+}
+
+// Translates a glob pattern, where * matches any sequence of characters and ?
+// matches any single character, to a LIKE pattern literal, escaping the
+// characters special to LIKE.
+func globToLikePattern(glob string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`, `*`, `%`, `?`, `_`, `'`, `''`)
+
+	return "'" + replacer.Replace(glob) + "'"
+}
+
+// Builds a predicate matching the column against any of the glob patterns.
+func buildGlobPredicate(columnName string, globs []string) string {
+	matches := make([]string, len(globs))
+	for i, glob := range globs {
+		matches[i] = fmt.Sprintf("%s LIKE %s", columnName, globToLikePattern(glob))
+	}
+
+	return strings.Join(matches, " OR ")
+}
+
+// System schemas of PostgreSQL and CockroachDB, skipped with
+// WithExcludeSystemSchemas.
+var systemSchemas = []string{"pg_catalog", "pg_toast", "information_schema", "pg_extension", "crdb_internal"}
+
+// LIKE patterns matching the per-session temporary schemas, e.g. pg_temp_3 and
+// pg_toast_temp_3, with the underscores escaped to match literally.
+var systemSchemaPatterns = []string{`pg\_temp\_%`, `pg\_toast\_temp\_%`}
+
+// Builds predicates excluding the system and temporary schemas.
+func buildSystemSchemaExclusion(schemaColumn string) []string {
+	predicates := []string{buildInClause(schemaColumn, systemSchemas, true)}
+	for _, pattern := range systemSchemaPatterns {
+		predicates = append(predicates, fmt.Sprintf("%s NOT LIKE '%s'", schemaColumn, pattern))
+	}
+
+	return predicates
+}
+
 // Constructs a query that returns a list of tables with schemas that will be
 // used for verification, translating the provided filter configuration to a
 // SQL 'WHERE' clause. Exclusions override inclusions.
-func buildGetTablesQuery(includeSchemas, excludeSchemas, includeTables, excludeTables []string) string {
+func buildGetTablesQuery(config Config) string {
 	query := "SELECT table_schema, table_name FROM information_schema.tables"
+	schemaColumn, tableColumn := "table_schema", "table_name"
 	whereClauses := []string{}
 
-	if len(includeSchemas) > 0 {
-		whereClause := "table_schema IN ("
-		for i := 0; i < len(includeSchemas); i++ {
-			whereClause += fmt.Sprintf("'%s'", includeSchemas[i])
-			if i < len(includeSchemas)-1 {
-				whereClause += ", "
-			}
-		}
-
-		whereClause += ")"
+	if config.CatalogSource == CatalogSourcePgCatalog {
+		query = `
+			SELECT n.nspname AS table_schema, c.relname AS table_name
+			FROM pg_catalog.pg_class AS c
+				JOIN pg_catalog.pg_namespace AS n ON n.oid = c.relnamespace`
+		schemaColumn, tableColumn = "n.nspname", "c.relname"
+		// Tables, partitioned tables, views, and foreign tables, matching the
+		// relations listed in information_schema.tables.
+		whereClauses = append(whereClauses, "c.relkind IN ('r', 'p', 'v', 'f')")
+	}
 
-		whereClauses = append(whereClauses, whereClause)
-	} else if len(excludeSchemas) > 0 {
-		whereClause := "table_schema NOT IN ("
-		for i := 0; i < len(excludeSchemas); i++ {
-			whereClause += fmt.Sprintf("'%s'", excludeSchemas[i])
-			if i < len(excludeSchemas)-1 {
-				whereClause += ", "
-			}
-		}
-		whereClause += ")"
-		whereClauses = append(whereClauses, whereClause)
+	if len(config.IncludeSchemas) > 0 {
+		whereClauses = append(whereClauses, buildInClause(schemaColumn, config.IncludeSchemas, false))
+	} else if len(config.ExcludeSchemas) > 0 {
+		whereClauses = append(whereClauses, buildInClause(schemaColumn, config.ExcludeSchemas, true))
 	}
 
-	if len(includeTables) > 0 {
-		whereClause := "table_name IN ("
-		for i := 0; i < len(includeTables); i++ {
-			whereClause += fmt.Sprintf("'%s'", includeTables[i])
-			if i < len(includeTables)-1 {
-				whereClause += ", "
-			}
-		}
+	if config.ExcludeSystemSchemas {
+		whereClauses = append(whereClauses, buildSystemSchemaExclusion(schemaColumn)...)
+	}
 
-		whereClause += ")"
+	if len(config.SchemaPatterns) > 0 {
+		whereClauses = append(whereClauses, "("+buildGlobPredicate(schemaColumn, config.SchemaPatterns)+")")
+	}
 
-		whereClauses = append(whereClauses, whereClause)
-	} else if len(excludeTables) > 0 {
-		whereClause := "table_name NOT IN ("
-		for i := 0; i < len(excludeTables); i++ {
-			whereClause += fmt.Sprintf("'%s'", excludeTables[i])
-			if i < len(excludeTables)-1 {
-				whereClause += ", "
-			}
-		}
-		whereClause += ")"
-		whereClauses = append(whereClauses, whereClause)
+	if len(config.IncludeTables) > 0 {
+		whereClauses = append(whereClauses, buildInClause(tableColumn, config.IncludeTables, false))
+	} else if len(config.ExcludeTables) > 0 {
+		whereClauses = append(whereClauses, buildInClause(tableColumn, config.ExcludeTables, true))
 	}
 
 	if len(whereClauses) > 0 {
@@ -78,10 +237,49 @@ func buildGetTablesQuery(includeSchemas, excludeSchemas, includeTables, excludeT
 }
 
 // Constructs a query that returns a list of columns for the given table,
-// including the column name, data type, and constraint.
-func buildGetColumsQuery(schemaName, tableName string) string {
+// including the column name, data type, constraint, default expression,
+// ordinal position, and whether it allows NULL values. The data types read
+// from pg_catalog are those information_schema reports, i.e. without type
+// modifiers, with the base types of domains, and with arrays and types outside
+// of pg_catalog reported as ARRAY and USER-DEFINED.
+func buildGetColumsQuery(config Config, schemaName, tableName string) string {
+	if config.CatalogSource == CatalogSourcePgCatalog {
+		return formatQuery(fmt.Sprintf(`
+			SELECT a.attname AS column_name,
+				CASE
+					WHEN t.typname = 'citext' THEN t.typname
+					WHEN bt.typelem <> 0 AND bt.typlen = -1 THEN 'ARRAY'
+					WHEN bn.nspname = 'pg_catalog' THEN format_type(bt.oid, NULL)
+					ELSE 'USER-DEFINED'
+				END AS data_type,
+				con.conname AS constraint_name,
+				CASE con.contype
+					WHEN 'p' THEN 'PRIMARY KEY'
+					WHEN 'u' THEN 'UNIQUE'
+					WHEN 'f' THEN 'FOREIGN KEY'
+					WHEN 'c' THEN 'CHECK'
+				END AS constraint_type,
+				pg_get_expr(d.adbin, d.adrelid) AS column_default, a.attnum::INT8 AS ordinal_position, NOT a.attnotnull AS is_nullable
+			FROM pg_catalog.pg_attribute AS a
+				JOIN pg_catalog.pg_class AS c ON c.oid = a.attrelid
+				JOIN pg_catalog.pg_namespace AS n ON n.oid = c.relnamespace
+				JOIN pg_catalog.pg_type AS t ON t.oid = a.atttypid
+				JOIN pg_catalog.pg_type AS bt ON bt.oid = CASE WHEN t.typtype = 'd' THEN t.typbasetype ELSE t.oid END
+				JOIN pg_catalog.pg_namespace AS bn ON bn.oid = bt.typnamespace
+				LEFT OUTER JOIN pg_catalog.pg_constraint AS con ON (
+					con.conrelid = c.oid AND
+					a.attnum = ANY(con.conkey)
+				)
+				LEFT OUTER JOIN pg_catalog.pg_attrdef AS d ON (
+					d.adrelid = c.oid AND
+					d.adnum = a.attnum
+				)
+			WHERE c.relname = %s AND n.nspname = %s AND a.attnum > 0 AND NOT a.attisdropped
+			`, quoteLiteral(tableName), quoteLiteral(schemaName)))
+	}
+
 	return formatQuery(fmt.Sprintf(`
-		SELECT c.column_name, c.data_type, k.constraint_name, tc.constraint_type
+		SELECT c.column_name, CASE WHEN c.udt_name = 'citext' THEN c.udt_name ELSE c.data_type END AS data_type, k.constraint_name, tc.constraint_type, c.column_default, c.ordinal_position::INT8, c.is_nullable = 'YES' AS is_nullable
 		FROM information_schema.columns as c
 			LEFT OUTER JOIN information_schema.key_column_usage as k ON (
 				c.column_name = k.column_name AND
@@ -91,63 +289,253 @@ func buildGetColumsQuery(schemaName, tableName string) string {
 			LEFT OUTER JOIN information_schema.table_constraints as tc ON (
 				k.constraint_name = tc.constraint_name
 			)
-		WHERE c.table_name = '%s' AND c.table_schema = '%s'
-		`, tableName, schemaName))
+		WHERE c.table_name = %s AND c.table_schema = %s
+		`, quoteLiteral(tableName), quoteLiteral(schemaName)))
 }
 
-// Constructs a query for test mode full that generates a MD5 hash of each row,
-// aggregates those hashes, and outputs a single hash of those hashes.
-func buildFullHashQuery(config Config, schemaName, tableName string, columns []column) string {
-	var columnsWithCasting []string
+// Constructs a query that returns the names of the primary key columns of the
+// given table from CockroachDB's crdb_internal tables, whose primary keys are
+// not reliably listed in information_schema on some versions. The hidden
+// rowid column keying tables without a primary key is omitted.
+func buildGetCockroachPrimaryKeysQuery(schemaName, tableName string) string {
+	return formatQuery(fmt.Sprintf(`
+		SELECT ic.column_name
+		FROM crdb_internal.index_columns AS ic
+			JOIN crdb_internal.table_indexes AS ti ON (
+				ti.descriptor_id = ic.descriptor_id AND
+				ti.index_id = ic.index_id
+			)
+			JOIN crdb_internal.table_columns AS tc ON (
+				tc.descriptor_id = ic.descriptor_id AND
+				tc.column_id = ic.column_id
+			)
+			JOIN crdb_internal.tables AS t ON t.table_id = ic.descriptor_id
+		WHERE t.name = %s AND t.schema_name = %s AND t.database_name = current_database()
+			AND ti.index_type = 'primary' AND ic.column_type = 'key' AND NOT tc.hidden
+		`, quoteLiteral(tableName), quoteLiteral(schemaName)))
+}
 
-	var primaryKeyNamesWithCasting []string
+// Constructs a query that returns the definitions of the CHECK and FOREIGN KEY
+// constraints on the given table.
+func buildGetConstraintsQuery(schemaName, tableName string) string {
+	return formatQuery(fmt.Sprintf(`
+		SELECT pg_get_constraintdef(con.oid) AS definition
+		FROM pg_catalog.pg_constraint AS con
+			JOIN pg_catalog.pg_class AS c ON c.oid = con.conrelid
+			JOIN pg_catalog.pg_namespace AS n ON n.oid = c.relnamespace
+		WHERE c.relname = %s AND n.nspname = %s AND con.contype IN ('c', 'f')
+		`, quoteLiteral(tableName), quoteLiteral(schemaName)))
+}
 
-	for _, column := range columns {
-		colNameWithCasting := column.CastToText(config.TimestampPrecision)
-		columnsWithCasting = append(columnsWithCasting, colNameWithCasting)
+// Constructs a query that returns each user table, and whether its statistics
+// suggest it has been modified since the given time: either rows have been
+// modified since it was last analyzed, or it was vacuumed or analyzed since
+// the given time, which follows modifications.
+func buildGetModifiedTablesQuery(since time.Time) string {
+	return formatQuery(fmt.Sprintf(`
+		SELECT schemaname, relname, (
+			COALESCE(n_mod_since_analyze, 0) > 0 OR
+			COALESCE(GREATEST(last_vacuum, last_autovacuum, last_analyze, last_autoanalyze) >= '%s'::TIMESTAMPTZ, false)
+		) AS modified
+		FROM pg_catalog.pg_stat_user_tables
+		`, since.UTC().Format(time.RFC3339Nano)))
+}
+
+// Constructs a query that returns whether the table has any rows matching the
+// predicates, stopping at the first row found.
+func buildTableHasRowsQuery(config Config, schemaName, tableName string, predicates []string) string {
+	return formatQuery(fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s%s)`, config.quoteTable(schemaName, tableName), buildWhereClause(predicates)))
+}
+
+// Casts each of the columns to text, ordered according to the configured
+// column order.
+func castColumns(config Config, columns []column) []string {
+	if config.ColumnOrder != ColumnOrderOrdinal {
+		return castSorted(config, columns)
+	}
+
+	ordered := make([]column, len(columns))
+	copy(ordered, columns)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].ordinal < ordered[j].ordinal
+	})
+
+	casted := make([]string, len(ordered))
+	for i, column := range ordered {
+		casted[i] = column.CastToText(config)
+	}
+
+	return casted
+}
+
+// castSorted casts the columns to text, sorted as their cast expressions would
+// be with unquoted identifiers, as they were before identifiers were quoted,
+// so that quoting does not change the order columns are hashed in, and so the
+// hashes of existing manifests.
+func castSorted(config Config, columns []column) []string {
+	type castColumn struct {
+		key    string
+		casted string
+	}
+
+	sorted := make([]castColumn, len(columns))
+	for i, column := range columns {
+		casted := column.CastToText(config)
+		sorted[i] = castColumn{
+			key:    strings.ReplaceAll(casted, config.quoteIdent(column.name), column.name),
+			casted: casted,
+		}
+	}
 
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].key != sorted[j].key {
+			return sorted[i].key < sorted[j].key
+		}
+
+		return sorted[i].casted < sorted[j].casted
+	})
+
+	casted := make([]string, len(sorted))
+	for i, column := range sorted {
+		casted[i] = column.casted
+	}
+
+	return casted
+}
+
+// primaryKeyColumns returns the columns that are part of the primary key.
+func primaryKeyColumns(columns []column) []column {
+	var primaryKey []column
+
+	for _, column := range columns {
 		if column.IsPrimaryKey() {
-			primaryKeyNamesWithCasting = append(primaryKeyNamesWithCasting, colNameWithCasting)
+			primaryKey = append(primaryKey, column)
 		}
 	}
 
-	sort.Strings(columnsWithCasting)
-	sort.Strings(primaryKeyNamesWithCasting)
+	return primaryKey
+}
+
+// Constructs a query that returns the comment on the given table, with a NULL
+// column name, and the comments on each of its columns.
+func buildGetCommentsQuery(schemaName, tableName string) string {
+	tableLiteral, schemaLiteral := quoteLiteral(tableName), quoteLiteral(schemaName)
+
+	return formatQuery(fmt.Sprintf(`
+		SELECT NULL AS column_name, obj_description(c.oid, 'pg_class') AS comment
+		FROM pg_catalog.pg_class AS c
+			JOIN pg_catalog.pg_namespace AS n ON n.oid = c.relnamespace
+		WHERE c.relname = %s AND n.nspname = %s
+		UNION ALL
+		SELECT a.attname AS column_name, col_description(c.oid, a.attnum) AS comment
+		FROM pg_catalog.pg_attribute AS a
+			JOIN pg_catalog.pg_class AS c ON c.oid = a.attrelid
+			JOIN pg_catalog.pg_namespace AS n ON n.oid = c.relnamespace
+		WHERE c.relname = %s AND n.nspname = %s AND a.attnum > 0 AND NOT a.attisdropped
+		`, tableLiteral, schemaLiteral, tableLiteral, schemaLiteral))
+}
+
+// Constructs a query that hashes the rows returned by the given query, which
+// must select each row's hash and primary_key, in primary key order. Rather
+// than aggregating every row hash into a single string, which holds the
+// hashes of all rows in memory at once, rows are numbered in primary key
+// order and split into groups of the configured size. The hashes of each
+// group are aggregated separately, and the group hashes are then aggregated
+// in order, so the largest aggregated string is bounded by the group size, or
+// by the number of groups on tables with more rows than the square of it.
+func buildOrderedHashAggregate(config Config, rowsQuery string) string {
+	separator := config.hashSeparator()
+
+	return fmt.Sprintf(`
+		SELECT md5(string_agg(grouphash, %s ORDER BY hashgroup))
+		FROM (
+			SELECT hashgroup, md5(string_agg(hash, %s ORDER BY primary_key)) AS grouphash
+			FROM (
+				SELECT hash, primary_key, floor((row_number() OVER (ORDER BY primary_key) - 1) / %d) AS hashgroup
+				FROM (%s) AS eachrow
+			) AS numberedrows
+			GROUP BY hashgroup
+		) AS grouphashes
+		`, separator, separator, config.aggregateGroupSize(), rowsQuery)
+}
+
+// Constructs a query for test mode full that generates a MD5 hash of each row,
+// aggregates those hashes in primary key order, and outputs a single hash of
+// those hashes.
+func buildFullHashQuery(config Config, schemaName, tableName string, columns []column, predicates []string) string {
+	columnsWithCasting := castColumns(config, columns)
+
+	primaryKeyNamesWithCasting := castSorted(config, primaryKeyColumns(columns))
+
+	return formatQuery(buildOrderedHashAggregate(config, fmt.Sprintf(
+		`SELECT %s AS hash, %s AS primary_key FROM %s%s`,
+		config.buildRowHash(columnsWithCasting), buildConcat(primaryKeyNamesWithCasting), config.quoteTable(schemaName, tableName), buildWhereClause(predicates))))
+}
+
+// Builds an expression converting the first 64 bits of the MD5 hash of the key
+// expression to a bigint, used to deterministically bucket rows by key.
+func buildKeyHashInteger(key string) string {
+	return fmt.Sprintf("('x' || substr(md5(%s),1,16))::bit(64)::bigint", key)
+}
+
+// Builds a predicate matching the rows in the configured shard, bucketing rows
+// by their primary key, or by all of the columns without one, in the same way
+// as the sparse test. As the hash integer may be negative, the remainder is
+// normalized to be non-negative.
+func buildShardPredicate(config Config, columns []column) string {
+	keyColumns := primaryKeyColumns(columns)
+	if len(keyColumns) == 0 {
+		keyColumns = columns
+	}
+
+	keyColumnsWithCasting := castSorted(config, keyColumns)
+
+	return fmt.Sprintf("(%s %% %d + %d) %% %d = %d",
+		buildKeyHashInteger(buildConcat(keyColumnsWithCasting)), config.ShardCount, config.ShardCount, config.ShardCount, config.ShardIndex)
+}
 
-	primaryColumnString := strings.Join(primaryKeyNamesWithCasting, ", ")
+// Constructs a query for test mode full on tables without a primary key, which
+// sums the integer values of two halves of each row's MD5 hash and outputs a
+// hash of the row count and sums. Unlike the full test query, the result does
+// not depend on the order rows are read in.
+func buildUnorderedHashQuery(config Config, schemaName, tableName string, columns []column, predicates []string) string {
+	rowHash := fmt.Sprintf("MD5(%s)", buildConcat(castColumns(config, columns)))
 
 	return formatQuery(fmt.Sprintf(`
-		SELECT md5(string_agg(hash, ''))
-		FROM (SELECT '' AS grouper, MD5(CONCAT(%s)) AS hash, CONCAT(%s) as primary_key FROM "%s"."%s") AS eachrow
-		GROUP BY grouper, primary_key ORDER BY primary_key
-		`, strings.Join(columnsWithCasting, ", "), primaryColumnString, schemaName, tableName))
+		SELECT CASE WHEN count(*) = 0 THEN NULL ELSE md5(CONCAT(count(*), ':', sum(high), ':', sum(low))) END
+		FROM (
+			SELECT ('x' || substr(hash, 1, 16))::bit(64)::bigint AS high, ('x' || substr(hash, 17, 16))::bit(64)::bigint AS low
+			FROM (SELECT %s AS hash FROM %s%s) AS eachrow
+		) AS rowhashes
+		`, rowHash, config.quoteTable(schemaName, tableName), buildWhereClause(predicates)))
 }
 
 // Similar to the full test query, this test differs by first selecting a subset
 // of the rows by casting the primary key value to an integer, then bucketing
 // based off of that value modulo the configured SparseMod value.
-func buildSparseHashQuery(config Config, schemaName, tableName string, columns []column, sparseMod int) string {
-	var columnsWithCasting []string
+func buildSparseHashQuery(config Config, schemaName, tableName string, columns []column, sparseMod int, predicates []string) string {
+	columnsWithCasting := castColumns(config, columns)
 
-	var primaryKeyNamesWithCasting []string
+	primaryKeyNamesWithCasting := castSorted(config, primaryKeyColumns(columns))
 
 	var primaryKeyNames []string
 
 	for _, column := range columns {
-		colNameWithCasting := column.CastToText(config.TimestampPrecision)
-		columnsWithCasting = append(columnsWithCasting, colNameWithCasting)
-
 		if column.IsPrimaryKey() {
-			primaryKeyNames = append(primaryKeyNames, column.name)
-			primaryKeyNamesWithCasting = append(primaryKeyNamesWithCasting, colNameWithCasting)
+			primaryKeyNames = append(primaryKeyNames, config.quoteIdent(column.name))
 		}
 	}
 
-	sort.Strings(columnsWithCasting)
-	sort.Strings(primaryKeyNamesWithCasting)
 	sort.Strings(primaryKeyNames)
 
-	primaryKeyNamesWithCastingString := strings.Join(primaryKeyNamesWithCasting, ", ")
+	primaryKeyConcat := buildConcat(primaryKeyNamesWithCasting)
+
+	// A non-zero sample seed salts the primary key hash, selecting a different
+	// but equally deterministic subset of rows.
+	sampleKey := primaryKeyConcat
+	if config.SampleSeed != 0 {
+		sampleKey = fmt.Sprintf("CONCAT('%d:', %s)", config.SampleSeed, primaryKeyConcat)
+	}
 
 	var whenClauses []string
 	for _, pkeyName := range primaryKeyNames {
@@ -155,85 +543,105 @@ func buildSparseHashQuery(config Config, schemaName, tableName string, columns [
 			whenClauses, fmt.Sprintf(
 				` %s in (
 					SELECT %s
-					FROM "%s"."%s"
-					WHERE ('x' || substr(md5(CONCAT(%s)),1,16))::bit(64)::bigint %% %d = 0
+					FROM %s
+					WHERE %s %% %d = 0
 				)`,
 				pkeyName,
 				pkeyName,
-				schemaName,
-				tableName,
-				primaryKeyNamesWithCastingString,
+				config.quoteTable(schemaName, tableName),
+				buildKeyHashInteger(sampleKey),
 				sparseMod,
 			),
 		)
 	}
 
-	whenClausesString := strings.Join(whenClauses, " AND ")
+	if len(predicates) > 0 {
+		whenClauses = append(whenClauses, buildPredicate(predicates))
+	}
 
-	primaryColumnString := strings.Join(primaryKeyNamesWithCasting, ", ")
+	whenClausesString := strings.Join(whenClauses, " AND ")
 
-	return formatQuery(fmt.Sprintf(`
-		SELECT md5(string_agg(hash, ''))
-		FROM (
-			SELECT '' AS grouper, MD5(CONCAT(%s)) AS hash, CONCAT(%s) as primary_key
-			FROM "%s"."%s"
-			WHERE %s
-			ORDER BY CONCAT(%s)
-		) AS eachrow
-		GROUP BY grouper, primary_key
-		ORDER BY primary_key
-		`,
-		strings.Join(columnsWithCasting, ", "), primaryColumnString,
-		schemaName, tableName, whenClausesString,
-		primaryKeyNamesWithCastingString))
+	return formatQuery(buildOrderedHashAggregate(config, fmt.Sprintf(
+		`SELECT %s AS hash, %s AS primary_key FROM %s WHERE %s`,
+		config.buildRowHash(columnsWithCasting), primaryKeyConcat, config.quoteTable(schemaName, tableName), whenClausesString)))
 }
 
 // Like the full test query, but only looks at the first and last N rows for generating hashes.
-func buildBookendHashQuery(config Config, schemaName, tableName string, columns []column, limit int) string {
-	var columnsWithCasting []string
-
-	var primaryKeyNamesWithCasting []string
+func buildBookendHashQuery(config Config, schemaName, tableName string, columns []column, limit int, predicates []string) string {
+	columnsWithCasting := castColumns(config, columns)
 
-	for _, column := range columns {
-		colNameWithCasting := column.CastToText(config.TimestampPrecision)
-		columnsWithCasting = append(columnsWithCasting, colNameWithCasting)
-
-		if column.IsPrimaryKey() {
-			primaryKeyNamesWithCasting = append(primaryKeyNamesWithCasting, colNameWithCasting)
-		}
-	}
+	primaryKeyNamesWithCasting := castSorted(config, primaryKeyColumns(columns))
 
-	sort.Strings(columnsWithCasting)
-	sort.Strings(primaryKeyNamesWithCasting)
-
-	allColumnsWithCasting := strings.Join(columnsWithCasting, ", ")
-	allPrimaryColumnsWithCasting := strings.Join(primaryKeyNamesWithCasting, ", ")
+	rowHash := config.buildRowHash(columnsWithCasting)
+	allPrimaryColumnsWithCasting := buildConcat(primaryKeyNamesWithCasting)
+	whereClause := buildWhereClause(predicates)
+	table := config.quoteTable(schemaName, tableName)
+	separator := config.hashSeparator()
 
 	return formatQuery(fmt.Sprintf(`
 			SELECT md5(CONCAT(starthash::TEXT, endhash::TEXT))
 			FROM (
-				SELECT md5(string_agg(hash, ''))
+				SELECT md5(string_agg(hash, %s))
 				FROM (
-					SELECT '' AS grouper, MD5(CONCAT(%s)) AS hash
-					FROM "%s"."%s"
-					ORDER BY CONCAT(%s) ASC
+					SELECT '' AS grouper, %s AS hash
+					FROM %s%s
+					ORDER BY %s ASC
 					LIMIT %d
 				) AS eachrow
 				GROUP BY grouper
 			) as starthash, (
-				SELECT md5(string_agg(hash, ''))
+				SELECT md5(string_agg(hash, %s))
 				FROM (
-					SELECT '' AS grouper, MD5(CONCAT(%s)) AS hash
-					FROM "%s"."%s"
-					ORDER BY CONCAT(%s) DESC
+					SELECT '' AS grouper, %s AS hash
+					FROM %s%s
+					ORDER BY %s DESC
 					LIMIT %d
 				) AS eachrow
 				GROUP BY grouper
 			) as endhash
-			`, allColumnsWithCasting, schemaName, tableName, allPrimaryColumnsWithCasting, limit, allColumnsWithCasting, schemaName, tableName, allPrimaryColumnsWithCasting, limit))
+			`, separator, rowHash, table, whereClause, allPrimaryColumnsWithCasting, limit, separator, rowHash, table, whereClause, allPrimaryColumnsWithCasting, limit))
 }
 
 // A minimal test that simply counts the number of rows.
-func buildRowCountQuery(schemaName, tableName string) string {
-	return formatQuery(fmt.Sprintf(`SELECT count(*)::TEXT FROM "%s"."%s"`, schemaName, tableName))
+func buildRowCountQuery(config Config, schemaName, tableName string, predicates []string) string {
+	return formatQuery(fmt.Sprintf(`SELECT count(*)::TEXT FROM %s%s`, config.quoteTable(schemaName, tableName), buildWhereClause(predicates)))
+}
+
+// Counts the distinct values of each of the columns, as cast to text for
+// hashing, aggregating the counts into a single keyed output of quoted
+// column=count entries sorted by column.
+func buildDistinctCountQuery(config Config, schemaName, tableName string, columns []column, predicates []string) string {
+	sorted := append([]column{}, columns...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+
+	var exprs []string
+
+	for i, col := range sorted {
+		key := strconv.Quote(col.name) + "="
+		if i > 0 {
+			key = ", " + key
+		}
+
+		exprs = append(exprs, quoteLiteral(key), fmt.Sprintf("count(DISTINCT %s)", col.CastToText(config)))
+	}
+
+	if len(exprs) == 0 {
+		return "SELECT ''"
+	}
+
+	return formatQuery(fmt.Sprintf(`SELECT %s FROM %s%s`, buildConcat(exprs), config.quoteTable(schemaName, tableName), buildWhereClause(predicates)))
+}
+
+// Counts the rows in each bucket of the given expression, aggregating the
+// buckets into a single value of length-prefixed 'bucket=count;' entries. The
+// buckets are left unordered, as collations differ between engines, and are
+// sorted when the output is parsed.
+func buildHistogramQuery(config Config, schemaName, tableName, expression string, predicates []string) string {
+	return formatQuery(fmt.Sprintf(`
+		SELECT string_agg(CONCAT(COALESCE(length(bucket), -1), ':', bucket, '=', n, ';'), '')
+		FROM (
+			SELECT (%s)::TEXT AS bucket, count(*) AS n
+			FROM %s%s
+			GROUP BY 1
+		) AS buckets`, expression, config.quoteTable(schemaName, tableName), buildWhereClause(predicates)))
 }
@@ -2,7 +2,10 @@
 package pgverify
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -11,10 +14,7 @@ func TestBuildGetTablesQuery(t *testing.T) {
 	for _, tc := range []struct {
 		name string
 
-		includeSchemas []string
-		excludeSchemas []string
-		includeTables  []string
-		excludeTables  []string
+		config Config
 
 		expectedQuery string
 	}{
@@ -22,11 +22,81 @@ func TestBuildGetTablesQuery(t *testing.T) {
 			name:          "no filters",
 			expectedQuery: "SELECT table_schema, table_name FROM information_schema.tables",
 		},
+		{
+			name: "schema and table filters",
+			config: Config{
+				IncludeSchemas: []string{"public", "other"},
+				ExcludeTables:  []string{"skipped"},
+			},
+			expectedQuery: "SELECT table_schema, table_name FROM information_schema.tables WHERE table_schema IN ('public', 'other') AND table_name NOT IN ('skipped')",
+		},
+		{
+			name:   "pg_catalog source",
+			config: Config{CatalogSource: CatalogSourcePgCatalog, ExcludeSchemas: []string{"pg_catalog"}},
+			expectedQuery: formatQuery(`
+				SELECT n.nspname AS table_schema, c.relname AS table_name
+				FROM pg_catalog.pg_class AS c JOIN pg_catalog.pg_namespace AS n ON n.oid = c.relnamespace
+				WHERE c.relkind IN ('r', 'p', 'v', 'f') AND n.nspname NOT IN ('pg_catalog')`),
+		},
+		{
+			name:   "system schemas with user exclusions",
+			config: Config{ExcludeSchemas: []string{"audit"}, ExcludeSystemSchemas: true},
+			expectedQuery: formatQuery(`
+				SELECT table_schema, table_name FROM information_schema.tables
+				WHERE table_schema NOT IN ('audit')
+				AND table_schema NOT IN ('pg_catalog', 'pg_toast', 'information_schema', 'pg_extension', 'crdb_internal')
+				AND table_schema NOT LIKE 'pg\_temp\_%'
+				AND table_schema NOT LIKE 'pg\_toast\_temp\_%'`),
+		},
+		{
+			name:   "schema patterns",
+			config: Config{SchemaPatterns: []string{"tenant_*", "shard?"}},
+			expectedQuery: formatQuery(`
+				SELECT table_schema, table_name FROM information_schema.tables
+				WHERE (table_schema LIKE 'tenant\_%' OR table_schema LIKE 'shard_')`),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expectedQuery, buildGetTablesQuery(tc.config))
+		})
+	}
+}
+
+func TestBuildGetColumsQuery(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+
+		config Config
+
+		expectedFrom string
+	}{
+		{
+			name:         "information_schema source",
+			config:       Config{CatalogSource: CatalogSourceInformationSchema},
+			expectedFrom: "FROM information_schema.columns",
+		},
+		{
+			name:         "pg_catalog source",
+			config:       Config{CatalogSource: CatalogSourcePgCatalog},
+			expectedFrom: "FROM pg_catalog.pg_attribute",
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
-			require.Equal(t, tc.expectedQuery, buildGetTablesQuery(tc.includeSchemas, tc.excludeSchemas, tc.includeTables, tc.excludeTables))
+			query := buildGetColumsQuery(tc.config, "testSchema", "testTable")
+			require.Contains(t, query, tc.expectedFrom)
+			require.Contains(t, query, "'testTable'")
+			require.Contains(t, query, "'testSchema'")
+
+			quoted := buildGetColumsQuery(tc.config, "it's", "O'Brien")
+			require.Contains(t, quoted, "'O''Brien'")
+			require.Contains(t, quoted, "'it''s'")
 		})
 	}
+
+	// Types are reported as information_schema does, without modifiers.
+	query := buildGetColumsQuery(Config{CatalogSource: CatalogSourcePgCatalog}, "testSchema", "testTable")
+	require.Contains(t, query, "format_type(bt.oid, NULL)")
+	require.Contains(t, query, "'USER-DEFINED'")
 }
 
 func TestBuildFullHashQuery(t *testing.T) {
@@ -37,6 +107,7 @@ func TestBuildFullHashQuery(t *testing.T) {
 		schemaName               string
 		tableName                string
 		columns                  []column
+		predicates               []string
 		primaryColumnNamesString string
 
 		expectedQuery string
@@ -53,10 +124,11 @@ func TestBuildFullHashQuery(t *testing.T) {
 			},
 			primaryColumnNamesString: "id",
 			expectedQuery: formatQuery(`
-            SELECT md5(string_agg(hash, ''))
-            FROM
-                (SELECT '' AS grouper, MD5(CONCAT((extract(epoch from date_trunc('milliseconds', when))::DECIMAL * 1000000)::BIGINT::TEXT, content::TEXT, id::TEXT)) AS hash, CONCAT(id::TEXT) as primary_key
-                FROM "testSchema"."testTable") AS eachrow GROUP BY grouper, primary_key ORDER BY primary_key`),
+            SELECT md5(string_agg(grouphash, '' ORDER BY hashgroup))
+            FROM ( SELECT hashgroup, md5(string_agg(hash, '' ORDER BY primary_key)) AS grouphash
+            FROM ( SELECT hash, primary_key, floor((row_number() OVER (ORDER BY primary_key) - 1) / 10000) AS hashgroup
+            FROM (SELECT MD5(CONCAT((extract(epoch from date_trunc('milliseconds', "when"))::DECIMAL * 1000000)::BIGINT::TEXT, "content"::TEXT, "id"::TEXT)) AS hash, CONCAT("id"::TEXT) AS primary_key
+                FROM "testSchema"."testTable") AS eachrow ) AS numberedrows GROUP BY hashgroup ) AS grouphashes`),
 		},
 		{
 			name:       "multi-column primary key",
@@ -70,14 +142,49 @@ func TestBuildFullHashQuery(t *testing.T) {
 			},
 			primaryColumnNamesString: "id, content",
 			expectedQuery: formatQuery(`
-            SELECT md5(string_agg(hash, ''))
-            FROM
-                (SELECT '' AS grouper, MD5(CONCAT((extract(epoch from date_trunc('milliseconds', when))::DECIMAL * 1000000)::BIGINT::TEXT, content::TEXT, id::TEXT)) AS hash, CONCAT(content::TEXT, id::TEXT) as primary_key
-                FROM "testSchema"."testTable") AS eachrow GROUP BY grouper, primary_key ORDER BY primary_key`),
+            SELECT md5(string_agg(grouphash, '' ORDER BY hashgroup))
+            FROM ( SELECT hashgroup, md5(string_agg(hash, '' ORDER BY primary_key)) AS grouphash
+            FROM ( SELECT hash, primary_key, floor((row_number() OVER (ORDER BY primary_key) - 1) / 10000) AS hashgroup
+            FROM (SELECT MD5(CONCAT((extract(epoch from date_trunc('milliseconds', "when"))::DECIMAL * 1000000)::BIGINT::TEXT, "content"::TEXT, "id"::TEXT)) AS hash, CONCAT("content"::TEXT, "id"::TEXT) AS primary_key
+                FROM "testSchema"."testTable") AS eachrow ) AS numberedrows GROUP BY hashgroup ) AS grouphashes`),
+		},
+		{
+			name:       "with predicates",
+			config:     Config{TimestampPrecision: TimestampPrecisionMilliseconds},
+			schemaName: "testSchema",
+			tableName:  "testTable",
+			columns: []column{
+				{name: "id", dataType: "uuid", constraints: []string{"PRIMARY KEY"}},
+				{name: "content", dataType: "text"},
+			},
+			predicates: []string{"content <> 'skip'", "id IS NOT NULL"},
+			expectedQuery: formatQuery(`
+            SELECT md5(string_agg(grouphash, '' ORDER BY hashgroup))
+            FROM ( SELECT hashgroup, md5(string_agg(hash, '' ORDER BY primary_key)) AS grouphash
+            FROM ( SELECT hash, primary_key, floor((row_number() OVER (ORDER BY primary_key) - 1) / 10000) AS hashgroup
+            FROM (SELECT MD5(CONCAT("content"::TEXT, "id"::TEXT)) AS hash, CONCAT("id"::TEXT) AS primary_key
+                FROM "testSchema"."testTable" WHERE (content <> 'skip') AND (id IS NOT NULL)) AS eachrow ) AS numberedrows GROUP BY hashgroup ) AS grouphashes`),
+		},
+		{
+			name:       "reserved word and mixed case columns",
+			config:     Config{TimestampPrecision: TimestampPrecisionMilliseconds},
+			schemaName: "testSchema",
+			tableName:  "testTable",
+			columns: []column{
+				{name: "order", dataType: "integer", constraints: []string{"PRIMARY KEY"}},
+				{name: "select", dataType: "text"},
+				{name: "createdAt", dataType: "timestamp with time zone"},
+			},
+			expectedQuery: formatQuery(`
+            SELECT md5(string_agg(grouphash, '' ORDER BY hashgroup))
+            FROM ( SELECT hashgroup, md5(string_agg(hash, '' ORDER BY primary_key)) AS grouphash
+            FROM ( SELECT hash, primary_key, floor((row_number() OVER (ORDER BY primary_key) - 1) / 10000) AS hashgroup
+            FROM (SELECT MD5(CONCAT((extract(epoch from date_trunc('milliseconds', "createdAt"))::DECIMAL * 1000000)::BIGINT::TEXT, "order"::TEXT, "select"::TEXT)) AS hash, CONCAT("order"::TEXT) AS primary_key
+                FROM "testSchema"."testTable") AS eachrow ) AS numberedrows GROUP BY hashgroup ) AS grouphashes`),
 		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
-			require.Equal(t, tc.expectedQuery, buildFullHashQuery(tc.config, tc.schemaName, tc.tableName, tc.columns))
+			require.Equal(t, tc.expectedQuery, buildFullHashQuery(tc.config, tc.schemaName, tc.tableName, tc.columns, tc.predicates))
 		})
 	}
 }
@@ -90,6 +197,7 @@ func TestBuildSparseHashQuery(t *testing.T) {
 		schemaName    string
 		tableName     string
 		columns       []column
+		predicates    []string
 		expectedQuery string
 	}{
 		{
@@ -103,16 +211,14 @@ func TestBuildSparseHashQuery(t *testing.T) {
 				{name: "when", dataType: "timestamp with time zone"},
 			},
 			expectedQuery: formatQuery(`
-            SELECT md5(string_agg(hash, ''))
-            FROM
-                ( SELECT '' AS grouper, MD5(CONCAT((extract(epoch from date_trunc('milliseconds', when))::DECIMAL * 1000000)::BIGINT::TEXT, content::TEXT, id::TEXT)) AS hash, CONCAT(id::TEXT) as primary_key
+            SELECT md5(string_agg(grouphash, '' ORDER BY hashgroup))
+            FROM ( SELECT hashgroup, md5(string_agg(hash, '' ORDER BY primary_key)) AS grouphash
+            FROM ( SELECT hash, primary_key, floor((row_number() OVER (ORDER BY primary_key) - 1) / 10000) AS hashgroup
+            FROM (SELECT MD5(CONCAT((extract(epoch from date_trunc('milliseconds', "when"))::DECIMAL * 1000000)::BIGINT::TEXT, "content"::TEXT, "id"::TEXT)) AS hash, CONCAT("id"::TEXT) AS primary_key
                 FROM "testSchema"."testTable" 
-				WHERE id in ( 
-					SELECT id FROM "testSchema"."testTable" 
-					WHERE ('x' || substr(md5(CONCAT(id::TEXT)),1,16))::bit(64)::bigint % 10 = 0 ) 
-					ORDER BY CONCAT(id::TEXT)
-				) 
-				AS eachrow GROUP BY grouper, primary_key ORDER BY primary_key`),
+				WHERE "id" in ( 
+					SELECT "id" FROM "testSchema"."testTable" 
+					WHERE ('x' || substr(md5(CONCAT("id"::TEXT)),1,16))::bit(64)::bigint % 10 = 0 )) AS eachrow ) AS numberedrows GROUP BY hashgroup ) AS grouphashes`),
 		},
 		{
 			name:       "multi-column primary key",
@@ -125,22 +231,429 @@ func TestBuildSparseHashQuery(t *testing.T) {
 				{name: "when", dataType: "timestamp with time zone"},
 			},
 			expectedQuery: formatQuery(`
-            SELECT md5(string_agg(hash, ''))
-            FROM
-                ( SELECT '' AS grouper, MD5(CONCAT((extract(epoch from date_trunc('milliseconds', when))::DECIMAL * 1000000)::BIGINT::TEXT, content::TEXT, id::TEXT)) AS hash, CONCAT(content::TEXT, id::TEXT) as primary_key
+            SELECT md5(string_agg(grouphash, '' ORDER BY hashgroup))
+            FROM ( SELECT hashgroup, md5(string_agg(hash, '' ORDER BY primary_key)) AS grouphash
+            FROM ( SELECT hash, primary_key, floor((row_number() OVER (ORDER BY primary_key) - 1) / 10000) AS hashgroup
+            FROM (SELECT MD5(CONCAT((extract(epoch from date_trunc('milliseconds', "when"))::DECIMAL * 1000000)::BIGINT::TEXT, "content"::TEXT, "id"::TEXT)) AS hash, CONCAT("content"::TEXT, "id"::TEXT) AS primary_key
                 FROM "testSchema"."testTable" 
-				WHERE content in ( 
-					SELECT content FROM "testSchema"."testTable" 
-					WHERE ('x' || substr(md5(CONCAT(content::TEXT, id::TEXT)),1,16))::bit(64)::bigint % 10 = 0
-				) AND id in ( 
-					SELECT id FROM "testSchema"."testTable" 
-					WHERE ('x' || substr(md5(CONCAT(content::TEXT, id::TEXT)),1,16))::bit(64)::bigint % 10 = 0
-				) ORDER BY CONCAT(content::TEXT, id::TEXT) )
-				AS eachrow GROUP BY grouper, primary_key ORDER BY primary_key`),
+				WHERE "content" in ( 
+					SELECT "content" FROM "testSchema"."testTable" 
+					WHERE ('x' || substr(md5(CONCAT("content"::TEXT, "id"::TEXT)),1,16))::bit(64)::bigint % 10 = 0
+				) AND "id" in ( 
+					SELECT "id" FROM "testSchema"."testTable" 
+					WHERE ('x' || substr(md5(CONCAT("content"::TEXT, "id"::TEXT)),1,16))::bit(64)::bigint % 10 = 0
+				)) AS eachrow ) AS numberedrows GROUP BY hashgroup ) AS grouphashes`),
+		},
+		{
+			name:       "with predicates",
+			config:     Config{TimestampPrecision: TimestampPrecisionMilliseconds},
+			schemaName: "testSchema",
+			tableName:  "testTable",
+			columns: []column{
+				{name: "id", dataType: "uuid", constraints: []string{"PRIMARY KEY"}},
+				{name: "content", dataType: "text"},
+			},
+			predicates: []string{"content <> 'skip'"},
+			expectedQuery: formatQuery(`
+            SELECT md5(string_agg(grouphash, '' ORDER BY hashgroup))
+            FROM ( SELECT hashgroup, md5(string_agg(hash, '' ORDER BY primary_key)) AS grouphash
+            FROM ( SELECT hash, primary_key, floor((row_number() OVER (ORDER BY primary_key) - 1) / 10000) AS hashgroup
+            FROM (SELECT MD5(CONCAT("content"::TEXT, "id"::TEXT)) AS hash, CONCAT("id"::TEXT) AS primary_key
+                FROM "testSchema"."testTable"
+				WHERE "id" in (
+					SELECT "id" FROM "testSchema"."testTable"
+					WHERE ('x' || substr(md5(CONCAT("id"::TEXT)),1,16))::bit(64)::bigint % 10 = 0 )
+					AND (content <> 'skip')) AS eachrow ) AS numberedrows GROUP BY hashgroup ) AS grouphashes`),
+		},
+		{
+			name:       "with sample seed",
+			config:     Config{TimestampPrecision: TimestampPrecisionMilliseconds, SampleSeed: 42},
+			schemaName: "testSchema",
+			tableName:  "testTable",
+			columns: []column{
+				{name: "id", dataType: "uuid", constraints: []string{"PRIMARY KEY"}},
+				{name: "content", dataType: "text"},
+			},
+			expectedQuery: formatQuery(`
+            SELECT md5(string_agg(grouphash, '' ORDER BY hashgroup))
+            FROM ( SELECT hashgroup, md5(string_agg(hash, '' ORDER BY primary_key)) AS grouphash
+            FROM ( SELECT hash, primary_key, floor((row_number() OVER (ORDER BY primary_key) - 1) / 10000) AS hashgroup
+            FROM (SELECT MD5(CONCAT("content"::TEXT, "id"::TEXT)) AS hash, CONCAT("id"::TEXT) AS primary_key
+                FROM "testSchema"."testTable"
+				WHERE "id" in (
+					SELECT "id" FROM "testSchema"."testTable"
+					WHERE ('x' || substr(md5(CONCAT('42:', CONCAT("id"::TEXT))),1,16))::bit(64)::bigint % 10 = 0 )) AS eachrow ) AS numberedrows GROUP BY hashgroup ) AS grouphashes`),
+		},
+		{
+			name:       "reserved word and mixed case primary key",
+			config:     Config{TimestampPrecision: TimestampPrecisionMilliseconds},
+			schemaName: "testSchema",
+			tableName:  "testTable",
+			columns: []column{
+				{name: "order", dataType: "integer", constraints: []string{"PRIMARY KEY"}},
+				{name: "lineItem", dataType: "integer", constraints: []string{"PRIMARY KEY"}},
+				{name: "content", dataType: "text"},
+			},
+			expectedQuery: formatQuery(`
+            SELECT md5(string_agg(grouphash, '' ORDER BY hashgroup))
+            FROM ( SELECT hashgroup, md5(string_agg(hash, '' ORDER BY primary_key)) AS grouphash
+            FROM ( SELECT hash, primary_key, floor((row_number() OVER (ORDER BY primary_key) - 1) / 10000) AS hashgroup
+            FROM (SELECT MD5(CONCAT("content"::TEXT, "lineItem"::TEXT, "order"::TEXT)) AS hash, CONCAT("lineItem"::TEXT, "order"::TEXT) AS primary_key
+                FROM "testSchema"."testTable"
+				WHERE "lineItem" in (
+					SELECT "lineItem" FROM "testSchema"."testTable"
+					WHERE ('x' || substr(md5(CONCAT("lineItem"::TEXT, "order"::TEXT)),1,16))::bit(64)::bigint % 10 = 0
+				) AND "order" in (
+					SELECT "order" FROM "testSchema"."testTable"
+					WHERE ('x' || substr(md5(CONCAT("lineItem"::TEXT, "order"::TEXT)),1,16))::bit(64)::bigint % 10 = 0
+				)) AS eachrow ) AS numberedrows GROUP BY hashgroup ) AS grouphashes`),
 		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
-			require.Equal(t, tc.expectedQuery, buildSparseHashQuery(tc.config, tc.schemaName, tc.tableName, tc.columns, 10))
+			require.Equal(t, tc.expectedQuery, buildSparseHashQuery(tc.config, tc.schemaName, tc.tableName, tc.columns, 10, tc.predicates))
 		})
 	}
 }
+
+func TestBuildUnorderedHashQuery(t *testing.T) {
+	columns := []column{
+		{name: "code", dataType: "text"},
+		{name: "label", dataType: "text"},
+	}
+
+	require.Equal(t,
+		formatQuery(`
+		SELECT CASE WHEN count(*) = 0 THEN NULL ELSE md5(CONCAT(count(*), ':', sum(high), ':', sum(low))) END
+		FROM (
+			SELECT ('x' || substr(hash, 1, 16))::bit(64)::bigint AS high, ('x' || substr(hash, 17, 16))::bit(64)::bigint AS low
+			FROM (SELECT MD5(CONCAT("code"::TEXT, "label"::TEXT)) AS hash FROM "testSchema"."lookup" WHERE (code <> 'skip')) AS eachrow
+		) AS rowhashes`),
+		buildUnorderedHashQuery(Config{}, "testSchema", "lookup", columns, []string{"code <> 'skip'"}))
+}
+
+func TestBuildFullHashQueryWideTable(t *testing.T) {
+	columns := []column{{name: "id", dataType: "integer", constraints: []string{"PRIMARY KEY"}}}
+	for i := 0; i < 200; i++ {
+		columns = append(columns, column{name: fmt.Sprintf("col%03d", i), dataType: "text"})
+	}
+
+	query := buildFullHashQuery(Config{TimestampPrecision: TimestampPrecisionMilliseconds}, "testSchema", "testTable", columns, nil)
+
+	require.Contains(t, query, `MD5(CONCAT(CONCAT("col000"::TEXT`)
+	require.Contains(t, query, `"col199"::TEXT), CONCAT("id"::TEXT)))`)
+
+	// Every CONCAT call must stay within the function argument limit.
+	for offset := strings.Index(query, "CONCAT("); offset >= 0; {
+		depth, args := 0, 1
+
+		for _, char := range query[offset+len("CONCAT("):] {
+			if depth == 0 && char == ')' {
+				break
+			}
+
+			switch char {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			case ',':
+				if depth == 0 {
+					args++
+				}
+			}
+		}
+
+		require.LessOrEqual(t, args, maxConcatArgs)
+
+		next := strings.Index(query[offset+1:], "CONCAT(")
+		if next < 0 {
+			break
+		}
+
+		offset += next + 1
+	}
+}
+
+func TestBuildConcat(t *testing.T) {
+	require.Equal(t, "CONCAT(a, b)", buildConcat([]string{"a", "b"}))
+
+	exprs := make([]string, maxConcatArgs+1)
+	for i := range exprs {
+		exprs[i] = "x"
+	}
+
+	require.Equal(t,
+		"CONCAT(CONCAT("+strings.Repeat("x, ", maxConcatArgs-1)+"x), CONCAT(x))",
+		buildConcat(exprs))
+}
+
+func TestBuildTimeWindowPredicate(t *testing.T) {
+	config := Config{TimestampPrecision: TimestampPrecisionMilliseconds}
+	window := TimeWindow{
+		Column: "created_at",
+		Since:  time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		Until:  time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	epoch := `(extract(epoch from date_trunc('milliseconds', "created_at"))::DECIMAL * 1000000)::BIGINT`
+	require.Equal(t,
+		epoch+" >= 1640995200000000 AND "+epoch+" < 1641081600000000",
+		buildTimeWindowPredicate(config, window))
+
+	// The predicate compares the same expression that the column is hashed with.
+	require.Equal(t, epoch+"::TEXT", column{name: "created_at", dataType: "timestamp with time zone"}.CastToText(config))
+}
+
+func TestCastColumns(t *testing.T) {
+	columns := []column{
+		{name: "id", dataType: "integer", ordinal: 1},
+		{name: "title", dataType: "text", ordinal: 2},
+		{name: "body", dataType: "text", ordinal: 3},
+	}
+
+	require.Equal(t,
+		[]string{`"body"::TEXT`, `"id"::TEXT`, `"title"::TEXT`},
+		castColumns(Config{ColumnOrder: ColumnOrderAlphabetical}, columns))
+	require.Equal(t,
+		[]string{`"id"::TEXT`, `"title"::TEXT`, `"body"::TEXT`},
+		castColumns(Config{ColumnOrder: ColumnOrderOrdinal}, columns))
+}
+
+func TestBuildDistinctCountQuery(t *testing.T) {
+	columns := []column{
+		{name: "status", dataType: "text"},
+		{name: "it's", dataType: "integer"},
+	}
+
+	require.Equal(t,
+		formatQuery(`
+		SELECT CONCAT('"it''s"=', count(DISTINCT "it's"::TEXT), ', "status"=', count(DISTINCT "status"::TEXT))
+		FROM "public"."orders" WHERE (id > 10)`),
+		buildDistinctCountQuery(Config{}, "public", "orders", columns, []string{"id > 10"}))
+
+	require.Equal(t,
+		formatQuery(`SELECT CONCAT('"status"=', count(DISTINCT "status"::TEXT)) FROM "public"."orders"`),
+		distinctTestMode{}.BuildQuery(Config{DistinctColumns: []string{"status"}}, "public", "orders", columns, nil))
+}
+
+func TestBuildGetCockroachPrimaryKeysQuery(t *testing.T) {
+	query := buildGetCockroachPrimaryKeysQuery("testSchema", "testTable")
+
+	require.Contains(t, query, "t.name = 'testTable' AND t.schema_name = 'testSchema'")
+	require.Contains(t, query, "ti.index_type = 'primary' AND ic.column_type = 'key' AND NOT tc.hidden")
+	require.Contains(t, buildGetCockroachPrimaryKeysQuery("it's", "O'Brien"), "t.name = 'O''Brien' AND t.schema_name = 'it''s'")
+}
+
+func TestBuildGetConstraintsQuery(t *testing.T) {
+	require.Contains(t, buildGetConstraintsQuery("it's", "O'Brien"), "c.relname = 'O''Brien' AND n.nspname = 'it''s'")
+}
+
+func TestBuildGetCommentsQuery(t *testing.T) {
+	query := buildGetCommentsQuery("it's", "O'Brien")
+	require.Equal(t, 2, strings.Count(query, "c.relname = 'O''Brien' AND n.nspname = 'it''s'"))
+}
+
+func TestBuildTableHasRowsQuery(t *testing.T) {
+	require.Equal(t,
+		`SELECT EXISTS (SELECT 1 FROM "public"."staging" WHERE (id > 10))`,
+		buildTableHasRowsQuery(Config{}, "public", "staging", []string{"id > 10"}))
+}
+
+func TestBuildShardPredicate(t *testing.T) {
+	columns := []column{
+		{name: "id", dataType: "integer", constraints: []string{"PRIMARY KEY"}},
+		{name: "content", dataType: "text"},
+	}
+
+	require.Equal(t,
+		formatQuery(`
+		SELECT md5(string_agg(grouphash, '' ORDER BY hashgroup))
+		FROM ( SELECT hashgroup, md5(string_agg(hash, '' ORDER BY primary_key)) AS grouphash
+			FROM ( SELECT hash, primary_key, floor((row_number() OVER (ORDER BY primary_key) - 1) / 10000) AS hashgroup
+				FROM (SELECT MD5(CONCAT("content"::TEXT, "id"::TEXT)) AS hash, CONCAT("id"::TEXT) AS primary_key
+					FROM "public"."events"
+					WHERE (id > 10) AND ((('x' || substr(md5(CONCAT("id"::TEXT)),1,16))::bit(64)::bigint % 4 + 4) % 4 = 3)) AS eachrow
+			) AS numberedrows GROUP BY hashgroup
+		) AS grouphashes`),
+		fullTestMode{}.BuildQuery(Config{ShardIndex: 3, ShardCount: 4}, "public", "events", columns, []string{"id > 10"}))
+
+	// The full test run in place of the bookend test is not sharded.
+	require.Equal(t,
+		buildFullHashQuery(Config{}, "public", "events", columns, []string{"id > 10"}),
+		bookendAsFullTestMode{}.BuildQuery(Config{ShardIndex: 3, ShardCount: 4}, "public", "events", columns, []string{"id > 10"}))
+
+	require.Equal(t,
+		`(('x' || substr(md5(CONCAT("content"::TEXT)),1,16))::bit(64)::bigint % 2 + 2) % 2 = 0`,
+		buildShardPredicate(Config{ShardCount: 2}, []column{{name: "content", dataType: "text"}}))
+}
+
+func TestBuildOrderedHashAggregate(t *testing.T) {
+	// Row hashes are aggregated in bounded groups, then the group hashes in
+	// turn, rather than all at once.
+	require.Equal(t,
+		formatQuery(`
+		SELECT md5(string_agg(grouphash, '' ORDER BY hashgroup))
+		FROM ( SELECT hashgroup, md5(string_agg(hash, '' ORDER BY primary_key)) AS grouphash
+			FROM ( SELECT hash, primary_key, floor((row_number() OVER (ORDER BY primary_key) - 1) / 2) AS hashgroup
+				FROM (SELECT hash, primary_key FROM rowhashes) AS eachrow
+			) AS numberedrows GROUP BY hashgroup
+		) AS grouphashes`),
+		formatQuery(buildOrderedHashAggregate(Config{AggregateGroupSize: 2}, "SELECT hash, primary_key FROM rowhashes")))
+
+	require.Contains(t, buildOrderedHashAggregate(Config{}, "SELECT hash, primary_key FROM rowhashes"), fmt.Sprintf("/ %d)", DefaultAggregateGroupSize))
+}
+
+func TestAggregateSeparator(t *testing.T) {
+	columns := []column{
+		{name: "id", dataType: "integer", constraints: []string{"PRIMARY KEY"}},
+		{name: "content", dataType: "text"},
+	}
+	config := Config{AggregateSeparator: "'"}
+
+	for _, query := range []string{
+		buildFullHashQuery(config, "public", "events", columns, nil),
+		buildSparseHashQuery(config, "public", "events", columns, 10, nil),
+		buildBookendHashQuery(config, "public", "events", columns, 10, nil),
+	} {
+		require.Contains(t, query, `string_agg(hash, ''''`)
+		require.NotContains(t, query, `, '')`)
+		require.NotContains(t, query, `, '' ORDER BY`)
+	}
+}
+
+func TestRowHashExpression(t *testing.T) {
+	columns := []column{
+		{name: "id", dataType: "integer", constraints: []string{"PRIMARY KEY"}},
+		{name: "content", dataType: "text"},
+	}
+	config := Config{RowHashExpression: "encode(sha256(CONCAT(%s)::BYTEA), 'hex')"}
+
+	require.NoError(t, config.validateRowHashExpression())
+
+	for _, query := range []string{
+		buildFullHashQuery(config, "public", "events", columns, nil),
+		buildSparseHashQuery(config, "public", "events", columns, 10, nil),
+		buildBookendHashQuery(config, "public", "events", columns, 10, nil),
+		buildChunkHashQuery(config, "public", "events", columns, 10, nil, false),
+	} {
+		require.Contains(t, query, `encode(sha256(CONCAT("content"::TEXT, "id"::TEXT)::BYTEA), 'hex') AS hash`)
+		require.NotContains(t, query, `MD5(CONCAT("content"`)
+	}
+
+	for _, template := range []string{"MD5('constant')", "MD5(%s) || MD5(%s)", "substr(%s, %d)"} {
+		require.Error(t, Config{RowHashExpression: template}.validateRowHashExpression(), template)
+	}
+}
+
+func TestBuildChunkHashQuery(t *testing.T) {
+	columns := []column{
+		{name: "id", dataType: "integer", constraints: []string{"PRIMARY KEY"}},
+		{name: "content", dataType: "text"},
+	}
+
+	require.Equal(t,
+		formatQuery(`
+		SELECT md5(string_agg(hash, '' ORDER BY key_1)), count(*), (array_agg(key_1 ORDER BY key_1 DESC))[1]
+		FROM (
+			SELECT MD5(CONCAT("content"::TEXT, "id"::TEXT)) AS hash, "id"::TEXT AS key_1
+			FROM "public"."events" WHERE (id > 10)
+			ORDER BY "id"::TEXT
+			LIMIT 1000
+		) AS eachrow`),
+		buildChunkHashQuery(Config{}, "public", "events", columns, 1000, []string{"id > 10"}, false))
+
+	require.Contains(t,
+		buildChunkHashQuery(Config{}, "public", "events", columns, 1000, []string{"id > 10"}, true),
+		`WHERE (id > 10) AND (("id"::TEXT) > ($1))`)
+
+	// Composite keys are compared as row values, as (1, 23) and (12, 3) would
+	// otherwise both compare as "123".
+	columns = []column{
+		{name: "a", dataType: "integer", constraints: []string{"PRIMARY KEY"}},
+		{name: "b", dataType: "integer", constraints: []string{"PRIMARY KEY"}},
+	}
+	query := buildChunkHashQuery(Config{}, "public", "pairs", columns, 1000, nil, true)
+	require.Contains(t, query, `WHERE (("a"::TEXT, "b"::TEXT) > ($1, $2))`)
+	require.Contains(t, query, `ORDER BY "a"::TEXT, "b"::TEXT`)
+	require.Contains(t, query, `(array_agg(key_2 ORDER BY key_1 DESC, key_2 DESC))[1]`)
+}
+
+func TestCombineChunkHashes(t *testing.T) {
+	require.Equal(t, emptyTableOutput, combineChunkHashes(nil))
+	require.Equal(t, combineChunkHashes([]string{"a", "b"}), combineChunkHashes([]string{"a", "b"}))
+	require.NotEqual(t, combineChunkHashes([]string{"a", "b"}), combineChunkHashes([]string{"b", "a"}))
+}
+
+func TestBuildExcludedKeysPredicate(t *testing.T) {
+	require.Equal(t, `"id" NOT IN (1, 42)`, buildExcludedKeysPredicate(Config{}, []string{"id"}, []string{"1", "42"}))
+	require.Equal(t,
+		`("env", "key") NOT IN (('prod', 'url'), ('prod', 'token'))`,
+		buildExcludedKeysPredicate(Config{}, []string{"key", "env"}, []string{"('prod', 'url')", "('prod', 'token')"}))
+}
+
+func TestQuoteIdent(t *testing.T) {
+	require.Equal(t, `"Order"`, Config{}.quoteIdent("Order"))
+	require.Equal(t, `"say ""hi"""`, Config{}.quoteIdent(`say "hi"`))
+
+	require.Equal(t,
+		`SELECT count(*)::TEXT FROM "My Schema"."user"`,
+		buildRowCountQuery(Config{}, "My Schema", "user", nil))
+}
+
+func TestShardedTable(t *testing.T) {
+	config := NewConfig(
+		WithShardedTable("a", "app", "events", []string{"events_0", "events_1"}),
+		WithTargetSchema("a", "app", "app_a"),
+	)
+	require.NoError(t, config.Validate())
+
+	sharded := config.withTargetShardedTables("a")
+	require.Equal(t, "events", sharded.logicalTableName("app_a", "events_1"))
+	require.Equal(t, "other", sharded.logicalTableName("app_a", "other"))
+	require.Equal(t, "events_0", sharded.metadataTableName("app_a", "events"))
+	require.Equal(t,
+		`SELECT count(*)::TEXT FROM (SELECT * FROM "app_a"."events_0" UNION ALL SELECT * FROM "app_a"."events_1") AS "events"`,
+		buildRowCountQuery(sharded, "app_a", "events", nil))
+
+	require.Equal(t,
+		`CREATE TEMPORARY TABLE pgverify_file (LIKE "app_a"."events_0") ON COMMIT DROP`,
+		buildFileTableQuery(sharded, "app_a", "events"))
+
+	unsharded := config.withTargetShardedTables("b")
+	require.Equal(t, "events", unsharded.metadataTableName("app", "events"))
+	require.Equal(t, `SELECT count(*)::TEXT FROM "app"."events"`, buildRowCountQuery(unsharded, "app", "events", nil))
+	require.Equal(t,
+		`CREATE TEMPORARY TABLE pgverify_file (LIKE "app"."events") ON COMMIT DROP`,
+		buildFileTableQuery(unsharded, "app", "events"))
+
+	// The summed estimate of the shards on one target is over the limit, so
+	// the table is not small on every target.
+	bookendConfig := NewConfig(WithBookendLimit(100))
+	require.Equal(t,
+		map[string]int64{"app.other": 150},
+		bookendConfig.selectSmallBookendTables([]map[string]int64{
+			{"app.events": 150, "app.other": 10},
+			{"app.events": 250, "app.other": 150},
+		}))
+
+	require.Error(t, NewConfig(WithShardedTable("a", "app", "events", nil)).Validate())
+}
+
+func TestCastSortedIgnoresQuoting(t *testing.T) {
+	// Sorted as the unquoted expressions were before identifiers were quoted,
+	// with the timestamp first, although a quoted column name would sort
+	// before its opening parenthesis.
+	columns := []column{
+		{name: "abc", dataType: "text"},
+		{name: "ab_c", dataType: "text"},
+		{name: "ab", dataType: "text"},
+		{name: "created", dataType: "timestamp with time zone"},
+	}
+
+	require.Equal(t, []string{
+		`(extract(epoch from date_trunc('milliseconds', "created"))::DECIMAL * 1000000)::BIGINT::TEXT`,
+		`"ab"::TEXT`,
+		`"ab_c"::TEXT`,
+		`"abc"::TEXT`,
+	}, castSorted(NewConfig(), columns))
+}
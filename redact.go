@@ -0,0 +1,47 @@
+package pgverify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The number of leading characters of a redacted test output that are kept,
+// enough to tell differing outputs apart in a report.
+const redactedPrefixLength = 4
+
+// redactOutput replaces a test output derived from table data, such as a hash,
+// with a placeholder of its prefix and length, e.g. "1ad3…[32]". Row counts
+// and placeholder outputs, such as errors, are not derived from the values in
+// the table, so are left as they are.
+func redactOutput(mode, output string) string {
+	if mode == TestModeRowCount || (strings.HasPrefix(output, "(") && strings.HasSuffix(output, ")")) {
+		return output
+	}
+
+	prefix := output
+	if len(prefix) > redactedPrefixLength {
+		prefix = prefix[:redactedPrefixLength]
+	}
+
+	return fmt.Sprintf("%s…[%d]", prefix, len(output))
+}
+
+// logOutput returns the test output as it may be logged, redacted if
+// configured.
+func (c Config) logOutput(mode, output string) string {
+	if c.RedactHashes {
+		return redactOutput(mode, output)
+	}
+
+	return output
+}
+
+// reportOutput returns the test output as it may be shown in reports and
+// errors, redacted if configured.
+func (r Results) reportOutput(mode, output string) string {
+	if r.redactHashes {
+		return redactOutput(mode, output)
+	}
+
+	return output
+}
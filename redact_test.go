@@ -0,0 +1,40 @@
+//nolint:testpackage // unit test for internals, *_test pattern not appropriate
+package pgverify
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactOutput(t *testing.T) {
+	require.Equal(t, "1ad3…[32]", redactOutput(TestModeFull, "1ad319171686aaf21d97da2a52f2d5f6"))
+	require.Equal(t, "ab…[2]", redactOutput(TestModeFull, "ab"))
+	require.Equal(t, "10", redactOutput(TestModeRowCount, "10"))
+	require.Equal(t, defaultErrorOutput, redactOutput(TestModeFull, defaultErrorOutput))
+}
+
+func TestRedactHashes(t *testing.T) {
+	results := NewResults([]string{"a", "b"}, []string{TestModeFull})
+	results.redactHashes = true
+
+	results.AddResult("a", SingleResult{"public": {"table": {TestModeFull: "1ad319171686aaf21d97da2a52f2d5f6"}}})
+	results.AddResult("b", SingleResult{"public": {"table": {TestModeFull: "1ad3ffffffffffffffffffffffffffff"}}})
+
+	errs := results.CheckForErrors()
+	require.Len(t, errs, 1)
+	require.Equal(t, "public.table test full has 2 outputs: 1ad3…[32] [a], 1ad3…[32] [b]", errs[0].Error())
+
+	var output bytes.Buffer
+	results.WriteAsTable(&output)
+	require.NotContains(t, output.String(), "1ad319171686")
+
+	output.Reset()
+	require.NoError(t, results.WriteAsJSON(&output))
+
+	var decoded jsonResults
+	require.NoError(t, json.Unmarshal(output.Bytes(), &decoded))
+	require.Equal(t, map[string][]string{"1ad3…[32]": {"a", "b"}}, decoded.Results["public"]["table"][TestModeFull])
+}
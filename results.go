@@ -4,12 +4,31 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/olekukonko/tablewriter"
+	"github.com/sirupsen/logrus"
 )
 
-const defaultErrorOutput = "(err)"
+const (
+	defaultErrorOutput = "(err)"
+	// Output recorded when a test query gives up waiting for a lock, such as
+	// one held by concurrent DDL, after the configured lock timeout.
+	lockTimeoutOutput = "(lock timeout)"
+	// Output recorded when a test runs against a table without any rows.
+	emptyTableOutput = "(empty)"
+	// Output recorded for tests that select rows by primary key, when run
+	// against a table without one.
+	noPrimaryKeyOutput = "(no primary key)"
+	// Output recorded by the existence test for tables present on a target.
+	tableExistsOutput = "(exists)"
+	// Output shown in tabular results for test modes that were not run on a
+	// table, when test modes are overridden for specific tables.
+	notApplicableOutput = "(n/a)"
+)
 
 // Results stores the results from tests run in a verification. It is accessed
 // from the per-target goroutines and is designed to be thread-safe.
@@ -23,18 +42,67 @@ type Results struct {
 	//   content[schema][table][mode][test output] = [targetName1, ...]
 	content map[string]map[string]map[string]map[string][]string
 
-	// Mutex to protect access to Results.content
-	mutex *sync.Mutex
+	// Warnings raised while running tests, such as skipped columns, stored
+	// with the schema:
+	//   warnings[targetName] = [warning1, ...]
+	warnings map[string][]string
+
+	// Time spent running test queries, recorded when reporting throughput,
+	// stored with the schema:
+	//   elapsed[targetName][schema][table] = duration
+	elapsed map[string]map[string]map[string]time.Duration
+
+	// The outcome of connecting to each target, stored with the schema:
+	//   connections[targetName] = status
+	connections map[string]ConnectionStatus
+
+	// The output of the self-check on each target, stored with the schema:
+	//   selfChecks[targetName] = output
+	selfChecks map[string]string
+
+	// The engine version reported by each target, stored with the schema:
+	//   versions[targetName] = version
+	versions map[string]string
+
+	// The names of the columns hashed in each table on each target, stored
+	// with the schema:
+	//   hashedColumns[targetName][schema][table] = [column1, ...]
+	hashedColumns map[string]map[string]map[string][]string
+
+	// Whether to omit tables without any mismatches or errors from the output.
+	onlyMismatches bool
+	// Whether to output a separate table for each schema.
+	groupBySchema bool
+	// Whether to redact test outputs derived from table data in the output.
+	redactHashes bool
+	// The maximum difference between rowcount test outputs that are still
+	// considered matching.
+	rowCountTolerance int64
+	// Whether to output the columns hashed in each table in the table output.
+	showHashedColumns bool
+
+	// Mutex to protect access to Results.content, Results.warnings,
+	// Results.elapsed, Results.connections, Results.versions,
+	// Results.hashedColumns, and Results.selfChecks. Readers take the read
+	// lock, so that results can be read concurrently, e.g. while rendering
+	// partial results.
+	mutex *sync.RWMutex
 }
 
 // NewResults creates a new Results object, configured with the output-formatted
 // names of the targets and list of test modes ran.
 func NewResults(targetNames []string, testModes []string) *Results {
 	return &Results{
-		content:     make(map[string]map[string]map[string]map[string][]string),
-		targetNames: targetNames,
-		testModes:   testModes,
-		mutex:       &sync.Mutex{},
+		content:       make(map[string]map[string]map[string]map[string][]string),
+		warnings:      make(map[string][]string),
+		elapsed:       make(map[string]map[string]map[string]time.Duration),
+		connections:   make(map[string]ConnectionStatus),
+		versions:      make(map[string]string),
+		selfChecks:    make(map[string]string),
+		hashedColumns: make(map[string]map[string]map[string][]string),
+		targetNames:   targetNames,
+		testModes:     testModes,
+		mutex:         &sync.RWMutex{},
 	}
 }
 
@@ -62,56 +130,332 @@ func (r *Results) AddResult(targetName string, schemaTableHashes SingleResult) {
 					r.content[schema][table][mode] = make(map[string][]string)
 				}
 
-				r.content[schema][table][mode][output] = append(r.content[schema][table][mode][output], targetName)
+				// Targets are kept sorted, rather than in order of completion,
+				// so that identical results produce identical output.
+				targets := append(r.content[schema][table][mode][output], targetName)
+				sort.Strings(targets)
+				r.content[schema][table][mode][output] = targets
 			}
 		}
 	}
 }
 
-// CheckForErrors checks for and returns a list of any errors found by comparing test outputs.
+// AddWarnings records warnings raised while running tests on a specific target.
+func (r *Results) AddWarnings(targetName string, warnings ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.warnings[targetName] = append(r.warnings[targetName], warnings...)
+}
+
+// Warnings returns a sorted list of all warnings raised while running tests,
+// each prefixed by the name of the target it was raised on.
+func (r *Results) Warnings() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var warnings []string
+
+	for targetName, targetWarnings := range r.warnings {
+		for _, warning := range targetWarnings {
+			warnings = append(warnings, targetName+": "+warning)
+		}
+	}
+
+	sort.Strings(warnings)
+
+	return warnings
+}
+
+// CheckForErrors checks for and returns a list of any errors found by comparing
+// test outputs, ordered by schema, table, and test mode. Tables found on some
+// targets but not others are reported as missing on those targets. It is safe
+// to call while results are still being added.
 func (r Results) CheckForErrors() []error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.checkForErrors()
+}
+
+// checkForErrors implements CheckForErrors, without locking.
+func (r Results) checkForErrors() []error {
+	// Failed self-checks come first, as they may explain the other errors.
+	errors := r.checkSelfChecks()
+
+	for _, schema := range sortedKeys(r.content) {
+		tables := r.content[schema]
+
+		for _, table := range sortedKeys(tables) {
+			modes := tables[table]
+
+			for _, targetName := range r.missingTargets(schema, table) {
+				errors = append(errors, fmt.Errorf("table %s.%s missing on target %s", schema, table, targetName))
+			}
+
+			for _, mode := range sortedKeys(modes) {
+				errors = append(errors, r.checkModeOutputs(schema, table, mode, modes[mode])...)
+			}
+		}
+	}
+
+	return errors
+}
+
+// sortedKeys returns the keys of the map in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// missingTargets returns the targets, in target order, without any test
+// outputs for the table, such as when the table or its schema only exists on
+// the other targets.
+func (r Results) missingTargets(schema, table string) []string {
+	found := make(map[string]bool)
+
+	for _, outputs := range r.content[schema][table] {
+		for _, targets := range outputs {
+			for _, targetName := range targets {
+				found[targetName] = true
+			}
+		}
+	}
+
+	var missing []string
+
+	for _, targetName := range r.targetNames {
+		if !found[targetName] {
+			missing = append(missing, targetName)
+		}
+	}
+
+	return missing
+}
+
+// checkModeOutputs returns any errors found by comparing the outputs of a
+// single test mode on a single table. Targets missing the table entirely are
+// reported separately, so are not expected to have outputs.
+func (r Results) checkModeOutputs(schema, table, mode string, outputs map[string][]string) []error {
+	if r.outputsDiffer(mode, outputs) {
+		var outputTargets []string
+		for _, output := range sortedKeys(outputs) {
+			outputTargets = append(outputTargets, fmt.Sprintf("%s %v", r.reportOutput(mode, output), outputs[output]))
+		}
+
+		var details string
+
+		switch mode {
+		case TestModeHistogram:
+			// Buckets are values from the table, so are redacted entirely.
+			if !r.redactHashes {
+				details = describeDivergingKeys(sortedKeys(outputs), "buckets")
+			}
+		case TestModeColumns, TestModeDistinct, TestModeNullability:
+			details = describeDivergingKeys(sortedKeys(outputs), "columns")
+		}
+
+		return []error{fmt.Errorf("%s.%s test %s has %d outputs: %s%s", schema, table, mode, len(outputs), strings.Join(outputTargets, ", "), details)}
+	}
+
 	var errors []error
 
-	for schema, tables := range r.content {
-		for table, modes := range tables {
-			for mode, outputs := range modes {
-				if len(outputs) > 1 {
-					errors = append(errors, fmt.Errorf("%s.%s test %s has %d outputs", schema, table, mode, len(outputs)))
+	numTargets := 0
 
+	for output, targets := range outputs {
+		numTargets += len(targets)
+
+		switch output {
+		case defaultErrorOutput:
+			errors = append(errors, fmt.Errorf("%s.%s test %s has error output", schema, table, mode))
+		case lockTimeoutOutput:
+			errors = append(errors, fmt.Errorf("%s.%s test %s has lock timeout output", schema, table, mode))
+		}
+	}
+
+	if expected := len(r.targetNames) - len(r.missingTargets(schema, table)); numTargets != expected {
+		errors = append(errors, fmt.Errorf("%s.%s test %s has %d targets (should be %d)", schema, table, mode, numTargets, expected))
+	}
+
+	return errors
+}
+
+// outputsDiffer returns whether the outputs of a single test mode on a single
+// table differ between targets.
+func (r Results) outputsDiffer(mode string, outputs map[string][]string) bool {
+	return len(outputs) > 1 && !(mode == TestModeRowCount && r.rowCountsWithinTolerance(outputs))
+}
+
+// logMismatches logs a structured log line for each target of each test whose
+// outputs differ between targets, ordered by schema, table, and test mode.
+func (r Results) logMismatches(logger logrus.FieldLogger) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, schema := range sortedKeys(r.content) {
+		for _, table := range sortedKeys(r.content[schema]) {
+			for _, mode := range sortedKeys(r.content[schema][table]) {
+				outputs := r.content[schema][table][mode]
+				if !r.outputsDiffer(mode, outputs) {
 					continue
 				}
 
-				for output, targets := range outputs {
-					if len(targets) != len(r.targetNames) {
-						errors = append(errors, fmt.Errorf("%s.%s test %s has %d targets (should be %d)", schema, table, mode, len(targets), len(r.targetNames)))
-					}
-
-					if output == defaultErrorOutput {
-						errors = append(errors, fmt.Errorf("%s.%s test %s has error output", schema, table, mode))
+				for _, output := range sortedKeys(outputs) {
+					for _, targetName := range outputs[output] {
+						logger.WithFields(logrus.Fields{
+							"event":  logEventHashMismatch,
+							"status": logStatusMismatch,
+							"schema": schema,
+							"table":  table,
+							"mode":   mode,
+							"target": targetName,
+							"hash":   r.reportOutput(mode, output),
+						}).Warn("Hash mismatch")
 					}
 				}
 			}
 		}
 	}
+}
 
-	return errors
+// rowCountsWithinTolerance returns whether all of the rowcount test outputs are
+// numeric and differ by no more than the configured tolerance.
+func (r Results) rowCountsWithinTolerance(outputs map[string][]string) bool {
+	if r.rowCountTolerance <= 0 {
+		return false
+	}
+
+	var minCount, maxCount int64
+
+	first := true
+
+	for output := range outputs {
+		count, err := strconv.ParseInt(output, 10, 64)
+		if err != nil {
+			return false
+		}
+
+		if first || count < minCount {
+			minCount = count
+		}
+
+		if first || count > maxCount {
+			maxCount = count
+		}
+
+		first = false
+	}
+
+	return maxCount-minCount <= r.rowCountTolerance
+}
+
+// tableHasErrors returns whether comparing the test outputs of a table
+// produces any errors.
+func (r Results) tableHasErrors(schema, table string) bool {
+	if len(r.missingTargets(schema, table)) > 0 {
+		return true
+	}
+
+	for mode, outputs := range r.content[schema][table] {
+		if len(r.checkModeOutputs(schema, table, mode, outputs)) > 0 {
+			return true
+		}
+	}
+
+	return false
 }
 
-// WriteAsTable writes the results as a table to the given io.Writer.
+// FailingTables returns a sorted list of the tables, as "schema.table", with
+// mismatched or erroneous test outputs.
+func (r Results) FailingTables() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var tables []string
+
+	for schema, schemaTables := range r.content {
+		for table := range schemaTables {
+			if r.tableHasErrors(schema, table) {
+				tables = append(tables, qualifiedTableName(schema, table))
+			}
+		}
+	}
+
+	sort.Strings(tables)
+
+	return tables
+}
+
+// WriteAsTable writes the results as a table to the given io.Writer. It is safe
+// to call while results are still being added.
 func (r Results) WriteAsTable(writer io.Writer) {
-	sort.Strings(r.testModes)
+	// The versions and throughput take the lock themselves, so are read
+	// before it is held, as read locks must not be taken recursively.
+	r.writeVersionsHeader(writer)
+
+	if throughputs := r.Throughput(); len(throughputs) > 0 {
+		defer writeThroughputSummary(writer, throughputs)
+	}
+
+	if r.showHashedColumns {
+		defer writeHashedColumnsTable(writer, r.HashedColumns())
+	}
+
+	defer writeMatchRateSummary(writer, r.MatchRateByMode())
+
+	r.mutex.RLock()
+	header, rows := r.tableRows()
+	r.writeSelfCheckWarning(writer)
+	r.mutex.RUnlock()
+
+	if !r.groupBySchema {
+		writeTable(writer, header, rows, []int{0, 1})
+
+		return
+	}
+
+	// Render a separate table for each schema, under a heading, with the
+	// schema column omitted.
+	var schemaRows [][]string
+
+	for i, row := range rows {
+		schemaRows = append(schemaRows, row[1:])
+
+		if i == len(rows)-1 || rows[i+1][0] != row[0] {
+			fmt.Fprintf(writer, "schema: %s\n", row[0])
+			writeTable(writer, header[1:], schemaRows, []int{0})
+			fmt.Fprintln(writer)
+
+			schemaRows = nil
+		}
+	}
+}
+
+// tableRows returns the header and sorted rows used to output the results in a
+// tabular format, with a row for each table and target.
+func (r Results) tableRows() ([]string, [][]string) {
+	testModes := append([]string{}, r.testModes...)
+	sort.Strings(testModes)
 
 	header := []string{"schema", "table"}
 
-	header = append(header, r.testModes...)
+	header = append(header, testModes...)
 	header = append(header, "target")
-	output := tablewriter.NewWriter(writer)
-	output.SetHeader(header)
 
 	var rows [][]string
 
 	for schema, tables := range r.content {
 		for table, modes := range tables {
+			if r.onlyMismatches && !r.tableHasErrors(schema, table) {
+				continue
+			}
+
 			// map[target][mode] = output
 			combinedModesOutputs := make(map[string]map[string]string)
 
@@ -122,7 +466,7 @@ func (r Results) WriteAsTable(writer io.Writer) {
 							combinedModesOutputs[target] = make(map[string]string)
 						}
 
-						combinedModesOutputs[target][mode] = output
+						combinedModesOutputs[target][mode] = r.reportOutput(mode, output)
 					}
 				}
 			}
@@ -130,9 +474,11 @@ func (r Results) WriteAsTable(writer io.Writer) {
 			for target := range combinedModesOutputs {
 				row := []string{schema, table}
 
-				for _, mode := range r.testModes {
+				for _, mode := range testModes {
 					if _, ok := combinedModesOutputs[target][mode]; ok {
 						row = append(row, combinedModesOutputs[target][mode])
+					} else if _, ok := modes[mode]; !ok {
+						row = append(row, notApplicableOutput)
 					} else {
 						row = append(row, defaultErrorOutput)
 					}
@@ -154,11 +500,20 @@ func (r Results) WriteAsTable(writer io.Writer) {
 		return false
 	})
 
+	return header, rows
+}
+
+// writeTable renders the header and rows as a table to the given io.Writer,
+// merging repeated cells in the given columns.
+func writeTable(writer io.Writer, header []string, rows [][]string, mergeColumns []int) {
+	output := tablewriter.NewWriter(writer)
+	output.SetHeader(header)
+
 	for _, row := range rows {
 		output.Append(row)
 	}
 
-	output.SetAutoMergeCellsByColumnIndex([]int{0, 1})
+	output.SetAutoMergeCellsByColumnIndex(mergeColumns)
 	output.SetAutoFormatHeaders(false)
 	output.Render()
 }
@@ -0,0 +1,413 @@
+//nolint:testpackage // unit test for internals, *_test pattern not appropriate
+package pgverify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteAsTableOnlyMismatches(t *testing.T) {
+	results := NewResults([]string{"a", "b"}, []string{TestModeRowCount})
+	results.onlyMismatches = true
+
+	results.AddResult("a", SingleResult{"public": {"matching": {TestModeRowCount: "10"}, "mismatched": {TestModeRowCount: "10"}}})
+	results.AddResult("b", SingleResult{"public": {"matching": {TestModeRowCount: "10"}, "mismatched": {TestModeRowCount: "9"}}})
+
+	var output bytes.Buffer
+	results.WriteAsTable(&output)
+
+	require.Contains(t, output.String(), "mismatched")
+	require.NotContains(t, output.String(), " matching ")
+	require.Len(t, results.CheckForErrors(), 1)
+}
+
+func TestWriteAsTableGroupBySchema(t *testing.T) {
+	results := NewResults([]string{"a"}, []string{TestModeRowCount})
+	results.groupBySchema = true
+
+	results.AddResult("a", SingleResult{
+		"first":  {"table1": {TestModeRowCount: "1"}},
+		"second": {"table2": {TestModeRowCount: "2"}, "table3": {TestModeRowCount: "3"}},
+	})
+
+	var output bytes.Buffer
+	results.WriteAsTable(&output)
+
+	first := strings.Index(output.String(), "schema: first")
+	second := strings.Index(output.String(), "schema: second")
+
+	require.GreaterOrEqual(t, first, 0)
+	require.Greater(t, second, first)
+	require.Equal(t, 2, strings.Count(output.String(), "| rowcount | target |"))
+}
+
+func TestCheckForErrorsRowCountTolerance(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+
+		tolerance int64
+		counts    []string
+
+		expectedErrors int
+	}{
+		{name: "exact match", counts: []string{"100", "100"}},
+		{name: "mismatch without tolerance", counts: []string{"100", "98"}, expectedErrors: 1},
+		{name: "within tolerance", tolerance: 2, counts: []string{"100", "98"}},
+		{name: "outside tolerance", tolerance: 2, counts: []string{"100", "97"}, expectedErrors: 1},
+		{name: "non-numeric output", tolerance: 2, counts: []string{"100", defaultErrorOutput}, expectedErrors: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			targetNames := []string{"a", "b"}
+			results := NewResults(targetNames, []string{TestModeRowCount})
+			results.rowCountTolerance = tc.tolerance
+
+			for i, count := range tc.counts {
+				results.AddResult(targetNames[i], SingleResult{"public": {"table": {TestModeRowCount: count}}})
+			}
+
+			require.Len(t, results.CheckForErrors(), tc.expectedErrors)
+		})
+	}
+}
+
+func TestWriteAsJSON(t *testing.T) {
+	results := NewResults([]string{"a", "b"}, []string{TestModeRowCount})
+
+	results.AddResult("b", SingleResult{"public": {"table": {TestModeRowCount: "10"}}})
+	results.AddResult("a", SingleResult{"public": {"table": {TestModeRowCount: "10"}}})
+
+	var output bytes.Buffer
+	require.NoError(t, results.WriteAsFormat(OutputFormatJSON, &output))
+
+	var decoded jsonResults
+	require.NoError(t, json.Unmarshal(output.Bytes(), &decoded))
+	require.Equal(t, []string{"a", "b"}, decoded.Results["public"]["table"][TestModeRowCount]["10"])
+	require.Empty(t, decoded.Errors)
+
+	require.Error(t, results.WriteAsFormat("invalid", &output))
+}
+
+func TestDiffFailingTables(t *testing.T) {
+	previous := NewResults([]string{"a", "b"}, []string{TestModeRowCount})
+	previous.AddResult("a", SingleResult{"public": {"fixed": {TestModeRowCount: "1"}, "stable": {TestModeRowCount: "1"}}})
+	previous.AddResult("b", SingleResult{"public": {"fixed": {TestModeRowCount: "2"}, "stable": {TestModeRowCount: "1"}}})
+
+	current := NewResults([]string{"a", "b"}, []string{TestModeRowCount})
+	current.AddResult("a", SingleResult{"public": {"fixed": {TestModeRowCount: "1"}, "stable": {TestModeRowCount: "1"}, "drifted": {TestModeRowCount: "1"}}})
+	current.AddResult("b", SingleResult{"public": {"fixed": {TestModeRowCount: "1"}, "stable": {TestModeRowCount: "1"}, "drifted": {TestModeRowCount: "3"}}})
+
+	newlyFailing, newlyPassing := DiffFailingTables(previous, current)
+	require.Equal(t, []string{"public.drifted"}, newlyFailing)
+	require.Equal(t, []string{"public.fixed"}, newlyPassing)
+
+	newlyFailing, newlyPassing = DiffFailingTables(nil, previous)
+	require.Equal(t, []string{"public.fixed"}, newlyFailing)
+	require.Empty(t, newlyPassing)
+}
+
+func TestThroughput(t *testing.T) {
+	results := NewResults([]string{"a", "b"}, []string{TestModeRowCount})
+	results.AddResult("a", SingleResult{"public": {"t1": {TestModeRowCount: "1000"}, "t2": {TestModeRowCount: defaultErrorOutput}}})
+	results.AddResult("b", SingleResult{"public": {"t1": {TestModeRowCount: "1000"}}})
+	results.AddElapsed("a", map[string]map[string]time.Duration{"public": {"t1": time.Second, "t2": time.Second}})
+	results.AddElapsed("b", map[string]map[string]time.Duration{"public": {"t1": 2 * time.Second}})
+
+	throughputs := results.Throughput()
+	require.Len(t, throughputs, 2)
+	require.Equal(t, "a", throughputs[0].Target)
+	require.InDelta(t, 1000, throughputs[0].RowsPerSecond(), 0.001)
+	require.Equal(t, "b", throughputs[1].Target)
+	require.InDelta(t, 500, throughputs[1].RowsPerSecond(), 0.001)
+
+	var output bytes.Buffer
+	results.WriteAsTable(&output)
+
+	require.Contains(t, output.String(), "throughput: a hashed 1000 rows in 1s (1000 rows/sec)")
+	require.Contains(t, output.String(), "throughput: b hashed 1000 rows in 2s (500 rows/sec)")
+}
+
+func TestHashedColumns(t *testing.T) {
+	results := NewResults([]string{"a", "b"}, []string{TestModeFull})
+	results.showHashedColumns = true
+	results.AddHashedColumns("b", map[string]map[string][]string{"public": {"users": {"id", "email"}}})
+	results.AddHashedColumns("a", map[string]map[string][]string{"public": {"users": {"name", "id", "email"}}})
+
+	require.Equal(t, []TableColumns{
+		{Target: "a", Schema: "public", Table: "users", Columns: []string{"email", "id", "name"}},
+		{Target: "b", Schema: "public", Table: "users", Columns: []string{"email", "id"}},
+	}, results.HashedColumns())
+
+	var output bytes.Buffer
+	results.WriteAsTable(&output)
+	require.Contains(t, output.String(), "email, id, name")
+
+	output.Reset()
+	require.NoError(t, results.WriteAsJSON(&output))
+
+	var decoded jsonResults
+	require.NoError(t, json.Unmarshal(output.Bytes(), &decoded))
+	require.Equal(t, results.HashedColumns(), decoded.HashedColumns)
+}
+
+func TestMatchRateByMode(t *testing.T) {
+	results := NewResults([]string{"a", "b"}, []string{TestModeFull, TestModeRowCount})
+	results.AddResult("a", SingleResult{"public": {
+		"t1": {TestModeFull: "x", TestModeRowCount: "1"},
+		"t2": {TestModeFull: "y", TestModeRowCount: "1"},
+		"t3": {TestModeFull: defaultErrorOutput},
+	}})
+	results.AddResult("b", SingleResult{"public": {
+		"t1": {TestModeFull: "x", TestModeRowCount: "1"},
+		"t2": {TestModeFull: "z", TestModeRowCount: "1"},
+		"t3": {TestModeFull: defaultErrorOutput},
+	}})
+
+	require.Equal(t, map[string]MatchRate{
+		TestModeFull:     {Matched: 1, Total: 3},
+		TestModeRowCount: {Matched: 2, Total: 2},
+	}, results.MatchRateByMode())
+
+	var output bytes.Buffer
+	results.WriteAsTable(&output)
+	require.Contains(t, output.String(), "full: 1/3 tables matched\nrowcount: 2/2 tables matched\n")
+}
+
+func TestCheckForErrorsSortedTargets(t *testing.T) {
+	results := NewResults([]string{"a", "b", "c"}, []string{TestModeRowCount})
+	results.AddResult("c", SingleResult{"public": {"t": {TestModeRowCount: "1"}}})
+	results.AddResult("b", SingleResult{"public": {"t": {TestModeRowCount: "2"}}})
+	results.AddResult("a", SingleResult{"public": {"t": {TestModeRowCount: "1"}}})
+
+	require.Equal(t, []string{"a", "c"}, results.content["public"]["t"][TestModeRowCount]["1"])
+
+	errs := results.CheckForErrors()
+	require.Len(t, errs, 1)
+	require.Equal(t, "public.t test rowcount has 2 outputs: 1 [a c], 2 [b]", errs[0].Error())
+}
+
+func TestConnections(t *testing.T) {
+	results := NewResults([]string{"a", "b", "c"}, []string{TestModeFull})
+	require.False(t, results.AllConnected())
+	require.Equal(t, "0 of 3 targets connected", results.ConnectionSummary())
+
+	results.addConnection("c", errors.New("connection refused"))
+	results.addConnection("a", nil)
+	results.addConnection("b", nil)
+
+	require.False(t, results.AllConnected())
+	require.Equal(t, []ConnectionStatus{
+		{Target: "a", Connected: true},
+		{Target: "b", Connected: true},
+		{Target: "c", Error: "connection refused"},
+	}, results.Connections())
+	require.Equal(t, "2 of 3 targets connected; 1 failed: c", results.ConnectionSummary())
+
+	results.addConnection("c", nil)
+	require.True(t, results.AllConnected())
+}
+
+func TestCheckForErrorsDivergingColumns(t *testing.T) {
+	results := NewResults([]string{"a", "b"}, []string{TestModeColumns})
+	results.AddResult("a", SingleResult{"public": {"users": {TestModeColumns: `"email"=aaa, "id"=bbb, "name"=ccc`}}})
+	results.AddResult("b", SingleResult{"public": {"users": {TestModeColumns: `"email"=aaa, "id"=bbb, "name"=ddd`}}})
+
+	errs := results.CheckForErrors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0].Error(), `diverging columns: "name"`)
+}
+
+func TestPairwiseMatrix(t *testing.T) {
+	results := NewResults([]string{"primary", "replica1", "replica2"}, []string{TestModeRowCount})
+	results.AddResult("primary", SingleResult{"public": {"a": {TestModeRowCount: "10"}, "b": {TestModeRowCount: "5"}}})
+	results.AddResult("replica1", SingleResult{"public": {"a": {TestModeRowCount: "10"}, "b": {TestModeRowCount: defaultErrorOutput}}})
+	results.AddResult("replica2", SingleResult{"public": {"a": {TestModeRowCount: "9"}, "b": {TestModeRowCount: "5"}}})
+
+	matrices := results.PairwiseMatrix()
+	require.Len(t, matrices, 2)
+	require.Equal(t, "a", matrices[0].Table)
+	require.Equal(t, [][]bool{{true, true, false}, {true, true, false}, {false, false, true}}, matrices[0].Agree)
+	require.Equal(t, [][]bool{{true, false, true}, {false, false, false}, {true, false, true}}, matrices[1].Agree)
+
+	var output bytes.Buffer
+	require.NoError(t, results.WriteAsFormat(OutputFormatPairwise, &output))
+	require.Contains(t, output.String(), "| primary  | 2/2     | 1/2      | 1/2      |")
+}
+
+func TestVersions(t *testing.T) {
+	results := NewResults([]string{"a", "b", "c"}, []string{TestModeRowCount})
+	results.addVersion("b", "CockroachDB CCL v23.2.0 (x86_64-pc-linux-gnu, built 2024/01/16 19:28:40, go1.21.5)")
+	results.addVersion("a", "PostgreSQL 14.5 (Debian 14.5-1.pgdg110+1) on x86_64-pc-linux-gnu, compiled by gcc, 64-bit")
+	results.AddResult("a", SingleResult{"public": {"table": {TestModeRowCount: "10"}}})
+
+	var output bytes.Buffer
+	results.WriteAsTable(&output)
+	require.True(t, strings.HasPrefix(output.String(), "engines: a: PostgreSQL 14.5, b: CockroachDB CCL v23.2.0\n"))
+
+	output.Reset()
+	require.NoError(t, results.WriteAsJSON(&output))
+
+	var decoded jsonResults
+	require.NoError(t, json.Unmarshal(output.Bytes(), &decoded))
+	require.Equal(t, results.Versions(), decoded.Versions)
+	require.Len(t, decoded.Versions, 2)
+}
+
+func TestCheckForErrorsMissingTables(t *testing.T) {
+	results := NewResults([]string{"a", "b", "c"}, []string{TestModeRowCount, TestModeFull})
+
+	results.AddResult("a", SingleResult{
+		"public": {"shared": {TestModeRowCount: "1", TestModeFull: "x"}, "only_a": {TestModeRowCount: "1", TestModeFull: "x"}},
+		"extra":  {"table": {TestModeRowCount: "1", TestModeFull: "x"}},
+	})
+	results.AddResult("b", SingleResult{"public": {"shared": {TestModeRowCount: "1", TestModeFull: "x"}}})
+	results.AddResult("c", SingleResult{"public": {"shared": {TestModeRowCount: "1"}, "only_a": {TestModeRowCount: "1", TestModeFull: "x"}}})
+
+	require.Equal(t, []string{
+		"table extra.table missing on target b",
+		"table extra.table missing on target c",
+		"table public.only_a missing on target b",
+		"public.shared test full has 2 targets (should be 3)",
+	}, errorStrings(results.CheckForErrors()))
+	require.Equal(t, []string{"extra.table", "public.only_a", "public.shared"}, results.FailingTables())
+}
+
+func TestWriteAsTableTableTestModes(t *testing.T) {
+	results := NewResults([]string{"a", "b"}, []string{TestModeRowCount, TestModeFull})
+
+	results.AddResult("a", SingleResult{"public": {"orders": {TestModeRowCount: "10", TestModeFull: "x"}, "users": {TestModeRowCount: "5"}}})
+	results.AddResult("b", SingleResult{"public": {"orders": {TestModeRowCount: "10"}, "users": {TestModeRowCount: "5"}}})
+
+	_, rows := results.tableRows()
+	require.Equal(t, [][]string{
+		{"public", "orders", defaultErrorOutput, "10", "b"},
+		{"public", "orders", "x", "10", "a"},
+		{"public", "users", notApplicableOutput, "5", "a"},
+		{"public", "users", notApplicableOutput, "5", "b"},
+	}, rows)
+	require.Equal(t, []string{"public.orders"}, results.FailingTables())
+}
+
+func TestLogMismatches(t *testing.T) {
+	results := NewResults([]string{"a", "b"}, []string{TestModeFull, TestModeRowCount})
+	results.AddResult("a", SingleResult{"public": {"t": {TestModeFull: "x", TestModeRowCount: "10"}}})
+	results.AddResult("b", SingleResult{"public": {"t": {TestModeFull: "y", TestModeRowCount: "10"}}})
+
+	var buf bytes.Buffer
+
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+
+	results.logMismatches(logger)
+
+	var targets []string
+
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var line map[string]interface{}
+		require.NoError(t, decoder.Decode(&line))
+		require.Equal(t, logEventHashMismatch, line["event"])
+		require.Equal(t, logStatusMismatch, line["status"])
+		require.Equal(t, "public", line["schema"])
+		require.Equal(t, "t", line["table"])
+		require.Equal(t, TestModeFull, line["mode"])
+
+		targets = append(targets, line["target"].(string))
+	}
+
+	require.Equal(t, []string{"a", "b"}, targets)
+}
+
+func TestResultsConcurrentReads(t *testing.T) {
+	// Run with -race to detect unsynchronized access to the results.
+	results := NewResults([]string{"a", "b"}, []string{TestModeFull, TestModeRowCount})
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 100; i++ {
+			table := "t" + strconv.Itoa(i)
+			results.AddResult("a", SingleResult{"public": {table: {TestModeFull: "x", TestModeRowCount: "1"}}})
+			results.AddResult("b", SingleResult{"public": {table: {TestModeFull: "y", TestModeRowCount: "1"}}})
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		results.CheckForErrors()
+		results.WriteAsTable(io.Discard)
+		require.NoError(t, results.WriteAsJSON(io.Discard))
+	}
+
+	<-done
+
+	require.Len(t, results.CheckForErrors(), 100)
+}
+
+func TestWriteAsJUnit(t *testing.T) {
+	results := NewResults([]string{"a", "b"}, []string{TestModeFull, TestModeRowCount})
+	results.AddResult("a", SingleResult{"public": {"t": {TestModeFull: "x", TestModeRowCount: "10"}}})
+	results.AddResult("b", SingleResult{"public": {"t": {TestModeFull: "y", TestModeRowCount: "10"}}})
+
+	var buf bytes.Buffer
+	require.NoError(t, results.WriteAsJUnit(&buf))
+
+	require.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="2" failures="1">
+  <testsuite name="pgverify" tests="2" failures="1">
+    <testcase name="public.t/full" classname="public.t">
+      <failure message="public.t test full has 2 outputs: x [a], y [b]">public.t test full has 2 outputs: x [a], y [b]&#xA;x: a&#xA;y: b</failure>
+    </testcase>
+    <testcase name="public.t/rowcount" classname="public.t"></testcase>
+  </testsuite>
+</testsuites>
+`, buf.String())
+}
+
+func TestWriteAsMarkdown(t *testing.T) {
+	results := NewResults([]string{"a", "b"}, []string{TestModeFull, TestModeRowCount})
+	results.AddResult("a", SingleResult{"public": {"t": {TestModeFull: "x|y", TestModeRowCount: "10"}}})
+	results.AddResult("b", SingleResult{"public": {"t": {TestModeFull: "z", TestModeRowCount: "10"}}})
+
+	var buf bytes.Buffer
+	require.NoError(t, results.WriteAsFormat(OutputFormatMarkdown, &buf))
+
+	require.Equal(t, `| schema | table | full | rowcount | target |
+| --- | --- | --- | --- | --- |
+| public | t | x\|y | 10 | a |
+| public | t | z | 10 | b |
+`, buf.String())
+}
+
+func TestResultsDiff(t *testing.T) {
+	previous := NewResults([]string{"a", "b"}, []string{TestModeFull, TestModeRowCount})
+	previous.AddResult("a", SingleResult{"public": {"t": {TestModeFull: "x", TestModeRowCount: "10"}, "old": {TestModeFull: "x"}}})
+	previous.AddResult("b", SingleResult{"public": {"t": {TestModeFull: "y", TestModeRowCount: "10"}, "old": {TestModeFull: "x"}}})
+
+	// The same statuses with different outputs, and targets in another order.
+	same := NewResults([]string{"b", "a"}, []string{TestModeFull, TestModeRowCount})
+	same.AddResult("b", SingleResult{"public": {"t": {TestModeFull: "z", TestModeRowCount: "11"}, "old": {TestModeFull: "w"}}})
+	same.AddResult("a", SingleResult{"public": {"t": {TestModeFull: "x", TestModeRowCount: "11"}, "old": {TestModeFull: "w"}}})
+	require.True(t, previous.Equal(same))
+
+	current := NewResults([]string{"a", "b"}, []string{TestModeFull, TestModeRowCount})
+	current.AddResult("a", SingleResult{"public": {"t": {TestModeFull: "x", TestModeRowCount: "10"}, "new": {TestModeFull: "x"}}})
+	current.AddResult("b", SingleResult{"public": {"t": {TestModeFull: "x", TestModeRowCount: "9"}, "new": {TestModeFull: "x"}}})
+	require.False(t, previous.Equal(current))
+	require.Equal(t, ResultsDiff{
+		NewlyFailing: []string{"public.t/rowcount"},
+		NewlyPassing: []string{"public.t/full"},
+		Added:        []string{"public.new/full"},
+		Removed:      []string{"public.old/full"},
+	}, previous.Diff(current))
+}
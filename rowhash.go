@@ -0,0 +1,53 @@
+package pgverify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+// buildRowHash builds the expression hashing a row from its columns cast to
+// text, in hashing order. By default, this is the MD5 hash of their
+// concatenation, unless a row hash expression is configured.
+func (c Config) buildRowHash(columnsWithCasting []string) string {
+	if c.RowHashExpression == "" {
+		return "MD5(" + buildConcat(columnsWithCasting) + ")"
+	}
+
+	return fmt.Sprintf(c.RowHashExpression, strings.Join(columnsWithCasting, ", "))
+}
+
+// validateRowHashExpression returns an error if the configured row hash
+// expression does not have exactly one %s verb for the columns.
+func (c Config) validateRowHashExpression() error {
+	if c.RowHashExpression == "" {
+		return nil
+	}
+
+	if strings.Count(c.RowHashExpression, "%s") != 1 || strings.Contains(fmt.Sprintf(c.RowHashExpression, "columns"), "%!") {
+		return fmt.Errorf("invalid row hash expression: %q, must be a format string with a single %%s verb", c.RowHashExpression)
+	}
+
+	return nil
+}
+
+// checkRowHashExpression returns an error if the configured row hash
+// expression does not produce a single text value on the target, by applying
+// it to sample columns.
+func (c Config) checkRowHashExpression(ctx context.Context, conn *pgx.Conn) error {
+	query := fmt.Sprintf("SELECT pg_typeof(%s)::TEXT", c.buildRowHash([]string{"'a'::TEXT", "'b'::TEXT"}))
+
+	var dataType string
+	if err := conn.QueryRow(ctx, query).Scan(&dataType); err != nil {
+		return errors.Wrap(wrapQueryError(err, query), "invalid row hash expression")
+	}
+
+	if column := (column{dataType: dataType}); !column.IsText() {
+		return fmt.Errorf("invalid row hash expression: produces a value of type %s, not text", dataType)
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package pgverify
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec // used for fingerprinting, not security
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// selfCheckRow is a row of the fixed dataset hashed by the self-check, with a
+// nil label for NULL.
+type selfCheckRow struct {
+	id    int
+	label *string
+}
+
+func selfCheckLabel(label string) *string {
+	return &label
+}
+
+// selfCheckRows cover ASCII, multi-byte, empty, and NULL text values.
+var selfCheckRows = []selfCheckRow{
+	{id: 1, label: selfCheckLabel("a")},
+	{id: 2, label: selfCheckLabel("é")},
+	{id: 3, label: selfCheckLabel("")},
+	{id: 4},
+}
+
+// buildSelfCheckQuery hashes the fixed self-check dataset with the same
+// primitives the test queries rely on: md5, string_agg, CONCAT of text and
+// NULL values, and the conversion of a hash prefix to a bigint.
+func buildSelfCheckQuery() string {
+	values := make([]string, len(selfCheckRows))
+
+	for i, row := range selfCheckRows {
+		label := "NULL"
+		if row.label != nil {
+			label = "'" + *row.label + "'"
+		}
+
+		values[i] = fmt.Sprintf("(%d, %s)", row.id, label)
+	}
+
+	return formatQuery(fmt.Sprintf(`
+		SELECT md5(string_agg(
+			MD5(CONCAT(id::TEXT, ':', label, ':', (('x' || substr(md5(label), 1, 16))::bit(64)::bigint)::TEXT)),
+			'' ORDER BY id
+		))
+		FROM (VALUES %s) AS selfcheck (id, label)`, strings.Join(values, ", ")))
+}
+
+// selfCheckExpected computes the output of the self-check query in Go, which
+// every target must produce.
+func selfCheckExpected() string {
+	var hashes strings.Builder
+
+	for _, row := range selfCheckRows {
+		label, prefix := "", ""
+
+		if row.label != nil {
+			label = *row.label
+			sum := md5.Sum([]byte(label)) //nolint:gosec // used for fingerprinting, not security
+			prefix = strconv.FormatInt(int64(binary.BigEndian.Uint64(sum[:8])), 10)
+		}
+
+		sum := md5.Sum([]byte(fmt.Sprintf("%d:%s:%s", row.id, label, prefix))) //nolint:gosec // used for fingerprinting, not security
+		hashes.WriteString(hex.EncodeToString(sum[:]))
+	}
+
+	sum := md5.Sum([]byte(hashes.String())) //nolint:gosec // used for fingerprinting, not security
+
+	return hex.EncodeToString(sum[:])
+}
+
+// runSelfCheck runs the self-check query on the target, returning its output,
+// or the error output if it fails.
+func runSelfCheck(ctx context.Context, conn *pgx.Conn) (string, error) {
+	output, err := runTestOnTable(ctx, conn, fullTestMode{}, buildSelfCheckQuery())
+	if err != nil {
+		return errorOutput(err), err
+	}
+
+	return output, nil
+}
+
+// addSelfCheck records the output of the self-check on a target.
+func (r *Results) addSelfCheck(targetName, output string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.selfChecks[targetName] = output
+}
+
+// failedSelfChecks returns the targets, sorted by name, whose self-check
+// output differs from the expected output.
+func (r Results) failedSelfChecks() []string {
+	expected := selfCheckExpected()
+
+	var failed []string
+
+	for targetName, output := range r.selfChecks {
+		if output != expected {
+			failed = append(failed, targetName)
+		}
+	}
+
+	sort.Strings(failed)
+
+	return failed
+}
+
+// checkSelfChecks returns an error for each target whose self-check failed.
+func (r Results) checkSelfChecks() []error {
+	var errors []error
+
+	for _, targetName := range r.failedSelfChecks() {
+		errors = append(errors, fmt.Errorf(
+			"target %s failed the %s test with output %s (expected %s): its hashing primitives differ, so mismatches may not be caused by the data",
+			targetName, TestModeSelfCheck, r.selfChecks[targetName], selfCheckExpected()))
+	}
+
+	return errors
+}
+
+// writeSelfCheckWarning writes a warning line ahead of the results table if any
+// target failed the self-check.
+func (r Results) writeSelfCheckWarning(writer io.Writer) {
+	if failed := r.failedSelfChecks(); len(failed) > 0 {
+		fmt.Fprintf(writer, "WARNING: hashing self-check failed on %s; mismatches may not be caused by the data\n", strings.Join(failed, ", "))
+	}
+}
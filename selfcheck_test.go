@@ -0,0 +1,28 @@
+//nolint:testpackage // unit test for internals, *_test pattern not appropriate
+package pgverify
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfCheck(t *testing.T) {
+	require.Equal(t, "1ad319171686aaf21d97da2a52f2d5f6", selfCheckExpected())
+	require.Contains(t, buildSelfCheckQuery(), "FROM (VALUES (1, 'a'), (2, 'é'), (3, ''), (4, NULL)) AS selfcheck (id, label)")
+
+	results := NewResults([]string{"a", "b"}, []string{TestModeRowCount})
+	results.addSelfCheck("a", selfCheckExpected())
+	results.addSelfCheck("b", "0123456789abcdef0123456789abcdef")
+	results.AddResult("a", SingleResult{"public": {"table": {TestModeRowCount: "10"}}})
+	results.AddResult("b", SingleResult{"public": {"table": {TestModeRowCount: "10"}}})
+
+	errs := results.CheckForErrors()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0].Error(), "target b failed the selfcheck test")
+
+	var output bytes.Buffer
+	results.WriteAsTable(&output)
+	require.Contains(t, output.String(), "WARNING: hashing self-check failed on b;")
+}
@@ -0,0 +1,76 @@
+package pgverify
+
+import "strings"
+
+// withTargetShardedTables returns the config with the sharded tables of the
+// target resolved to the physical schema names on the target, so that the
+// tables can be enumerated and queried by their logical names.
+func (c Config) withTargetShardedTables(targetName string) Config {
+	c.shardedTables = nil
+	c.shardLogicalTables = nil
+
+	for qualifiedName, physicalTables := range c.ShardedTables[targetName] {
+		schemaName, tableName := splitQualifiedTableName(qualifiedName)
+		physicalSchemaName := c.physicalSchema(targetName, schemaName)
+
+		if c.shardedTables == nil {
+			c.shardedTables = make(map[string][]string)
+			c.shardLogicalTables = make(map[string]string)
+		}
+
+		c.shardedTables[qualifiedTableName(physicalSchemaName, tableName)] = physicalTables
+
+		for _, physicalTable := range physicalTables {
+			c.shardLogicalTables[qualifiedTableName(physicalSchemaName, physicalTable)] = tableName
+		}
+	}
+
+	return c
+}
+
+// splitQualifiedTableName splits a name returned by qualifiedTableName into
+// the schema and table names.
+func splitQualifiedTableName(qualifiedName string) (string, string) {
+	if i := strings.Index(qualifiedName, "."); i >= 0 {
+		return qualifiedName[:i], qualifiedName[i+1:]
+	}
+
+	return "", qualifiedName
+}
+
+// logicalTableName returns the name the table is verified as, which is the
+// logical name of the sharded table if the table is one of its shards.
+func (c Config) logicalTableName(physicalSchemaName, tableName string) string {
+	if logicalName, ok := c.shardLogicalTables[qualifiedTableName(physicalSchemaName, tableName)]; ok {
+		return logicalName
+	}
+
+	return tableName
+}
+
+// metadataTableName returns the name of the table to query the catalog for the
+// columns, comments, and constraints of the table, which for a sharded table
+// is its first shard, as all shards share the same definition.
+func (c Config) metadataTableName(physicalSchemaName, tableName string) string {
+	if physicalTables, ok := c.shardedTables[qualifiedTableName(physicalSchemaName, tableName)]; ok {
+		return physicalTables[0]
+	}
+
+	return tableName
+}
+
+// quoteShardedTable returns the union of the shards of a sharded table, in
+// place of the table in a FROM clause, if the table is sharded on the target.
+func (c Config) quoteShardedTable(schemaName, tableName string) (string, bool) {
+	physicalTables, ok := c.shardedTables[qualifiedTableName(schemaName, tableName)]
+	if !ok {
+		return "", false
+	}
+
+	selects := make([]string, len(physicalTables))
+	for i, physicalTable := range physicalTables {
+		selects[i] = "SELECT * FROM " + c.quoteIdent(schemaName) + "." + c.quoteIdent(physicalTable)
+	}
+
+	return "(" + strings.Join(selects, " UNION ALL ") + ") AS " + c.quoteIdent(tableName), true
+}
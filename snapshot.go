@@ -0,0 +1,101 @@
+package pgverify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	beginSnapshotQuery = "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY"
+	// Test queries are run under a savepoint while in a snapshot, so that a
+	// failed query does not abort the transaction for the queries after it.
+	testSavepoint = "pgverify_test"
+)
+
+// beginSnapshot starts a read only transaction on the connection, so that all
+// later queries on it see the same point in time until endSnapshot.
+func beginSnapshot(ctx context.Context, conn *pgx.Conn) error {
+	if _, err := conn.Exec(ctx, beginSnapshotQuery); err != nil {
+		return errors.Wrap(wrapQueryError(err, beginSnapshotQuery), "failed to begin snapshot")
+	}
+
+	return nil
+}
+
+// buildBeginAsOfSystemTimeQuery returns the query starting a transaction that
+// reads the data as of the given system time, on CockroachDB.
+func buildBeginAsOfSystemTimeQuery(systemTime string) string {
+	return "BEGIN AS OF SYSTEM TIME " + quoteLiteral(systemTime)
+}
+
+// beginAsOfSystemTime starts a transaction on the connection, which must be to
+// CockroachDB, so that all later queries on it read the data as of the given
+// system time until endSnapshot. Such transactions are read only.
+func beginAsOfSystemTime(ctx context.Context, conn *pgx.Conn, systemTime string) error {
+	query := buildBeginAsOfSystemTimeQuery(systemTime)
+	if _, err := conn.Exec(ctx, query); err != nil {
+		return errors.Wrap(wrapQueryError(err, query), "failed to begin transaction as of system time")
+	}
+
+	return nil
+}
+
+// endSnapshot ends the transaction started by beginSnapshot. Nothing is
+// written in the transaction, so it is rolled back.
+func endSnapshot(ctx context.Context, conn *pgx.Conn) error {
+	_, err := conn.Exec(ctx, "ROLLBACK")
+
+	return errors.Wrap(err, "failed to end snapshot")
+}
+
+// shareSnapshot exports the snapshot of the transaction on the connection and
+// starts transactions using the same snapshot on the other connections, so
+// that queries on all of them see the same point in time. Exporting snapshots
+// is unsupported on CockroachDB.
+func shareSnapshot(ctx context.Context, conn *pgx.Conn, others []*pgx.Conn) error {
+	var snapshotID string
+	if err := conn.QueryRow(ctx, "SELECT pg_export_snapshot()").Scan(&snapshotID); err != nil {
+		return errors.Wrap(err, "failed to export snapshot")
+	}
+
+	for _, other := range others {
+		if err := beginSnapshot(ctx, other); err != nil {
+			return err
+		}
+
+		query := fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s'", snapshotID)
+		if _, err := other.Exec(ctx, query); err != nil {
+			return errors.Wrap(wrapQueryError(err, query), "failed to import snapshot")
+		}
+	}
+
+	return nil
+}
+
+// withSavepoint runs the function, which queries the connection, under a
+// savepoint if in a consistent snapshot, rolling back to the savepoint if it
+// fails so that later queries in the snapshot can still run.
+func (c Config) withSavepoint(ctx context.Context, conn *pgx.Conn, run func() error) error {
+	if !c.ConsistentSnapshot {
+		return run()
+	}
+
+	if _, err := conn.Exec(ctx, "SAVEPOINT "+testSavepoint); err != nil {
+		return errors.Wrap(err, "failed to create savepoint")
+	}
+
+	if err := run(); err != nil {
+		if _, rollbackErr := conn.Exec(ctx, "ROLLBACK TO SAVEPOINT "+testSavepoint); rollbackErr != nil {
+			return errors.Wrap(rollbackErr, "failed to roll back to savepoint")
+		}
+
+		return err
+	}
+
+	_, err := conn.Exec(ctx, "RELEASE SAVEPOINT "+testSavepoint)
+
+	return errors.Wrap(err, "failed to release savepoint")
+}
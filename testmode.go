@@ -0,0 +1,179 @@
+package pgverify
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Column is a column of a table being verified, as passed to TestMode
+// implementations.
+type Column = column
+
+// Name returns the name of the column.
+func (c column) Name() string {
+	return c.name
+}
+
+// DataType returns the data type of the column.
+func (c column) DataType() string {
+	return c.dataType
+}
+
+// TestMode is a strategy for comparing a table across targets. Each target
+// runs the query built by the test mode, and the parsed results of those
+// queries are compared, so a test mode must build a query that returns
+// identical results for identical tables regardless of the engine.
+type TestMode interface {
+	// BuildQuery returns the query to run for the table. The columns are
+	// those selected for hashing, including the primary key columns, and the
+	// predicates, if any, must be applied to restrict the rows compared.
+	BuildQuery(config Config, schemaName, tableName string, columns []Column, predicates []string) string
+	// ParseResult reads the output of the query from the returned row.
+	ParseResult(row pgx.Row) (string, error)
+}
+
+// unregisteredTestModes are the built-in test modes that compare table metadata
+// or run multiple queries per table, rather than running a single query, and
+// so cannot be implemented as a TestMode.
+var unregisteredTestModes = map[string]bool{
+	TestModeComments:    true,
+	TestModeConstraints: true,
+	TestModeDDL:         true,
+	TestModeDefaults:    true,
+	TestModeNullability: true,
+	TestModeColumns:     true,
+	TestModeSelfCheck:   true,
+	TestModeExistence:   true,
+}
+
+var testModeRegistry = struct {
+	sync.RWMutex
+	modes map[string]TestMode
+}{
+	modes: map[string]TestMode{
+		TestModeFull:     fullTestMode{},
+		TestModeBookend:  bookendTestMode{},
+		TestModeSparse:   sparseTestMode{},
+		TestModeRowCount: rowCountTestMode{},
+		TestModeDistinct: distinctTestMode{},
+		// The bucket expression is configured per table.
+		TestModeHistogram: histogramTestMode{},
+	},
+}
+
+// RegisterTestMode makes a custom test mode available by name, so that it can
+// be configured with WithTests like a built-in mode. It panics if the name is
+// empty, the mode is nil, or a test mode with the name is already registered.
+func RegisterTestMode(name string, mode TestMode) {
+	testModeRegistry.Lock()
+	defer testModeRegistry.Unlock()
+
+	if name == "" {
+		panic("pgverify: RegisterTestMode name is empty")
+	}
+
+	if mode == nil {
+		panic("pgverify: RegisterTestMode mode is nil")
+	}
+
+	if _, exists := testModeRegistry.modes[name]; exists || unregisteredTestModes[name] {
+		panic(fmt.Sprintf("pgverify: RegisterTestMode called twice for test mode %s", name))
+	}
+
+	testModeRegistry.modes[name] = mode
+}
+
+// lookupTestMode returns the registered test mode with the name, if any.
+func lookupTestMode(name string) (TestMode, bool) {
+	testModeRegistry.RLock()
+	defer testModeRegistry.RUnlock()
+
+	mode, ok := testModeRegistry.modes[name]
+
+	return mode, ok
+}
+
+// unregisterTestMode removes the registered test mode with the name, so that
+// tests registering test modes do not leak them into other tests.
+func unregisterTestMode(name string) {
+	testModeRegistry.Lock()
+	defer testModeRegistry.Unlock()
+
+	delete(testModeRegistry.modes, name)
+}
+
+// hashTestMode implements ParseResult for the built-in test modes, which all
+// return a single text value.
+type hashTestMode struct{}
+
+func (hashTestMode) ParseResult(row pgx.Row) (string, error) {
+	return scanTestOutput(row)
+}
+
+type fullTestMode struct{ hashTestMode }
+
+func (fullTestMode) BuildQuery(config Config, schemaName, tableName string, columns []Column, predicates []string) string {
+	return buildFullHashQuery(config, schemaName, tableName, columns, shardPredicates(config, columns, predicates))
+}
+
+// unorderedFullTestMode replaces the full test mode on tables without a
+// primary key, when allowed.
+type unorderedFullTestMode struct{ hashTestMode }
+
+func (unorderedFullTestMode) BuildQuery(config Config, schemaName, tableName string, columns []Column, predicates []string) string {
+	return buildUnorderedHashQuery(config, schemaName, tableName, columns, shardPredicates(config, columns, predicates))
+}
+
+// shardPredicates adds the predicate selecting the configured shard of rows to
+// the predicates of a full test, if sharding is configured.
+func shardPredicates(config Config, columns []Column, predicates []string) []string {
+	if config.ShardCount <= 1 {
+		return predicates
+	}
+
+	return append(append([]string{}, predicates...), buildShardPredicate(config, columns))
+}
+
+type bookendTestMode struct{ hashTestMode }
+
+func (bookendTestMode) BuildQuery(config Config, schemaName, tableName string, columns []Column, predicates []string) string {
+	return buildBookendHashQuery(config, schemaName, tableName, columns, config.BookendLimit, predicates)
+}
+
+type sparseTestMode struct{ hashTestMode }
+
+func (sparseTestMode) BuildQuery(config Config, schemaName, tableName string, columns []Column, predicates []string) string {
+	return buildSparseHashQuery(config, schemaName, tableName, columns, config.SparseMod, predicates)
+}
+
+type rowCountTestMode struct{ hashTestMode }
+
+func (rowCountTestMode) BuildQuery(config Config, schemaName, tableName string, _ []Column, predicates []string) string {
+	return buildRowCountQuery(config, schemaName, tableName, predicates)
+}
+
+type distinctTestMode struct{ hashTestMode }
+
+// BuildQuery counts the distinct values of the columns selected with
+// WithDistinctColumns, or of all the columns if none are selected.
+func (distinctTestMode) BuildQuery(config Config, schemaName, tableName string, columns []Column, predicates []string) string {
+	if len(config.DistinctColumns) == 0 {
+		return buildDistinctCountQuery(config, schemaName, tableName, columns, predicates)
+	}
+
+	var selected []column
+
+	for _, col := range columns {
+		for _, name := range config.DistinctColumns {
+			if col.name == name {
+				selected = append(selected, col)
+
+				break
+			}
+		}
+	}
+
+	return buildDistinctCountQuery(config, schemaName, tableName, selected, predicates)
+}
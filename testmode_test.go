@@ -0,0 +1,47 @@
+//nolint:testpackage // unit test for internals, *_test pattern not appropriate
+package pgverify
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/require"
+)
+
+type maxPrimaryKeyTestMode struct{}
+
+func (maxPrimaryKeyTestMode) BuildQuery(config Config, schemaName, tableName string, columns []Column, _ []string) string {
+	for _, column := range columns {
+		if column.IsPrimaryKey() {
+			return fmt.Sprintf(`SELECT max(%s)::TEXT FROM %s`, config.quoteIdent(column.Name()), config.quoteTable(schemaName, tableName))
+		}
+	}
+
+	return ""
+}
+
+func (maxPrimaryKeyTestMode) ParseResult(row pgx.Row) (string, error) {
+	var output string
+
+	return output, row.Scan(&output)
+}
+
+func TestRegisterTestMode(t *testing.T) {
+	config := NewConfig(WithTests("maxpk"))
+	require.Equal(t, ErrInvalidTestMode{Mode: "maxpk"}, config.Validate())
+
+	RegisterTestMode("maxpk", maxPrimaryKeyTestMode{})
+	t.Cleanup(func() { unregisterTestMode("maxpk") })
+	require.NoError(t, config.Validate())
+
+	mode, ok := lookupTestMode("maxpk")
+	require.True(t, ok)
+	require.Equal(t,
+		`SELECT max("id")::TEXT FROM "public"."widgets"`,
+		mode.BuildQuery(config, "public", "widgets", []Column{{name: "id", constraints: []string{"PRIMARY KEY"}}}, nil))
+
+	require.Panics(t, func() { RegisterTestMode("maxpk", maxPrimaryKeyTestMode{}) })
+	require.Panics(t, func() { RegisterTestMode(TestModeFull, maxPrimaryKeyTestMode{}) })
+	require.Panics(t, func() { RegisterTestMode(TestModeDDL, maxPrimaryKeyTestMode{}) })
+}
@@ -0,0 +1,136 @@
+package pgverify
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TableThroughput is the rate at which a table was hashed on a target.
+type TableThroughput struct {
+	Target string
+	Schema string
+	Table  string
+	// Rows is the number of rows in the table, as reported by the rowcount
+	// test mode.
+	Rows int64
+	// Elapsed is the total time spent running the test queries on the table.
+	Elapsed time.Duration
+}
+
+// RowsPerSecond returns the number of rows processed per second.
+func (t TableThroughput) RowsPerSecond() float64 {
+	if t.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(t.Rows) / t.Elapsed.Seconds()
+}
+
+// AddElapsed records the time spent running test queries on each table of a
+// specific target, keyed by schema and then table.
+func (r *Results) AddElapsed(targetName string, elapsed map[string]map[string]time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.elapsed[targetName]; !ok {
+		r.elapsed[targetName] = make(map[string]map[string]time.Duration)
+	}
+
+	for schema, tables := range elapsed {
+		if _, ok := r.elapsed[targetName][schema]; !ok {
+			r.elapsed[targetName][schema] = make(map[string]time.Duration)
+		}
+
+		for table, duration := range tables {
+			r.elapsed[targetName][schema][table] += duration
+		}
+	}
+}
+
+// Throughput returns the hashing throughput of each table on each target,
+// sorted by target, schema, and table. Tables without a numeric rowcount test
+// output for the target are omitted.
+func (r *Results) Throughput() []TableThroughput {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var throughputs []TableThroughput
+
+	for target, schemas := range r.elapsed {
+		for schema, tables := range schemas {
+			for table, elapsed := range tables {
+				rows, ok := r.rowCount(schema, table, target)
+				if !ok {
+					continue
+				}
+
+				throughputs = append(throughputs, TableThroughput{
+					Target:  target,
+					Schema:  schema,
+					Table:   table,
+					Rows:    rows,
+					Elapsed: elapsed,
+				})
+			}
+		}
+	}
+
+	sort.Slice(throughputs, func(i, j int) bool {
+		if throughputs[i].Target != throughputs[j].Target {
+			return throughputs[i].Target < throughputs[j].Target
+		}
+
+		if throughputs[i].Schema != throughputs[j].Schema {
+			return throughputs[i].Schema < throughputs[j].Schema
+		}
+
+		return throughputs[i].Table < throughputs[j].Table
+	})
+
+	return throughputs
+}
+
+// rowCount returns the rowcount test output of the table on the target.
+func (r *Results) rowCount(schema, table, target string) (int64, bool) {
+	for output, targets := range r.content[schema][table][TestModeRowCount] {
+		for _, outputTarget := range targets {
+			if outputTarget != target {
+				continue
+			}
+
+			rows, err := strconv.ParseInt(output, 10, 64)
+
+			return rows, err == nil
+		}
+	}
+
+	return 0, false
+}
+
+// writeThroughputSummary writes a line for each target summarizing the total
+// rows hashed, time taken, and resulting throughput.
+func writeThroughputSummary(writer io.Writer, throughputs []TableThroughput) {
+	totals := make(map[string]TableThroughput)
+
+	var targets []string
+
+	for _, throughput := range throughputs {
+		total, ok := totals[throughput.Target]
+		if !ok {
+			targets = append(targets, throughput.Target)
+		}
+
+		total.Rows += throughput.Rows
+		total.Elapsed += throughput.Elapsed
+		totals[throughput.Target] = total
+	}
+
+	for _, target := range targets {
+		total := totals[target]
+		fmt.Fprintf(writer, "throughput: %s hashed %d rows in %s (%.0f rows/sec)\n",
+			target, total.Rows, total.Elapsed.Round(time.Millisecond), total.RowsPerSecond())
+	}
+}
@@ -0,0 +1,47 @@
+package pgverify
+
+import "context"
+
+// Tracer creates spans around the stages of a verification, allowing it to be
+// instrumented with a tracing system such as OpenTelemetry without this
+// package depending on one. Spans should be created as children of any span
+// carried by the given context.
+type Tracer interface {
+	// Start begins a span with the given name and attributes, returning a
+	// context carrying the span and the span itself.
+	Start(ctx context.Context, name string, attributes map[string]string) (context.Context, Span)
+}
+
+// Span is a single traced operation started by a Tracer.
+type Span interface {
+	// End completes the span, recording the error if the operation failed.
+	End(err error)
+}
+
+// Names of the spans created during a verification.
+const (
+	SpanConnect     = "pgverify.connect"
+	SpanFetchTables = "pgverify.fetch_tables"
+	SpanTestQuery   = "pgverify.test_query"
+	SpanTestBatch   = "pgverify.test_batch"
+)
+
+// noopTracer is the default Tracer, which does nothing.
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ map[string]string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) End(error) {}
+
+// startSpan starts a span with the configured Tracer, if any.
+func (c Config) startSpan(ctx context.Context, name string, attributes map[string]string) (context.Context, Span) {
+	if c.Tracer == nil {
+		return noopTracer{}.Start(ctx, name, attributes)
+	}
+
+	return c.Tracer.Start(ctx, name, attributes)
+}
@@ -2,7 +2,13 @@ package pgverify
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/pgtype"
 	"github.com/jackc/pgx/v4"
 	"github.com/pkg/errors"
@@ -18,65 +24,171 @@ func Verify(ctx context.Context, targets []*pgx.ConnConfig, opts ...Option) (*Re
 	return c.Verify(ctx, targets)
 }
 
-// Verify runs all verification tests for the given table.
+// Verify runs all verification tests for the given table. The returned Results
+// are never nil, and record whether each target could be connected to, even
+// if the verification fails before running any tests. The connection to each
+// target is closed as soon as the tests on it finish.
 func (c Config) Verify(ctx context.Context, targets []*pgx.ConnConfig) (*Results, error) {
-	var finalResults *Results
+	targetNames := c.targetNames(targets)
+	finalResults := c.newResults(targetNames)
 
 	if err := c.Validate(); err != nil {
 		return finalResults, err
 	}
 
-	c.Logger.Infof("Verifying %d targets", len(targets))
-
 	// First check that we can connect to every specified target database.
-	targetNames := make([]string, len(targets))
-	conns := make(map[int]*pgx.Conn)
+	conns := make([]*pgx.Conn, len(targets))
+
+	var connectErrors []error
 
 	for i, target := range targets {
-		pgxLoggerFields := logrus.Fields{
-			"component": "pgx",
-			"host":      targets[i].Host,
-			"port":      targets[i].Port,
-			"database":  targets[i].Database,
-			"user":      targets[i].User,
+		conn, err := c.connectTarget(ctx, target, targetNames[i])
+		finalResults.addConnection(targetNames[i], err)
+
+		if err != nil {
+			connectErrors = append(connectErrors, errors.Wrapf(err, "failed to connect to target %s", targetNames[i]))
+
+			continue
 		}
 
-		if len(c.Aliases) == len(targets) {
-			targetNames[i] = c.Aliases[i]
-			pgxLoggerFields["alias"] = c.Aliases[i]
-		} else {
-			targetNames[i] = targets[i].Host
+		conns[i] = conn
+	}
+
+	if len(connectErrors) > 0 {
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Close(ctx)
+			}
+		}
+
+		return finalResults, multierr.Combine(connectErrors...)
+	}
+
+	return c.verifyConns(ctx, conns, finalResults, true)
+}
+
+// VerifyConns runs all verification tests using existing connections to the
+// targets, which are not closed afterwards. The names are used to identify the
+// targets in reporting output, falling back to the configured aliases or hosts
+// if the number of names is not equal to the number of connections. Session
+// settings configured by options, such as the statement timeout, are applied
+// to the connections.
+func (c Config) VerifyConns(ctx context.Context, conns []*pgx.Conn, names []string) (*Results, error) {
+	targetNames := names
+	if len(names) != len(conns) {
+		targets := make([]*pgx.ConnConfig, len(conns))
+		for i, conn := range conns {
+			targets[i] = conn.Config()
 		}
 
-		target.Logger = &pgxLogger{c.Logger.WithFields(pgxLoggerFields)}
+		targetNames = c.targetNames(targets)
+	}
+
+	finalResults := c.newResults(targetNames)
+
+	if err := c.Validate(); err != nil {
+		return finalResults, err
+	}
 
-		target.LogLevel = pgx.LogLevelError
+	for i, conn := range conns {
+		err := c.configureSession(ctx, conn)
+		finalResults.addConnection(targetNames[i], err)
 
-		conn, err := pgx.ConnectConfig(ctx, target)
 		if err != nil {
 			return finalResults, err
 		}
-		defer conn.Close(ctx)
-		conns[i] = conn
 	}
 
-	finalResults = NewResults(targetNames, c.TestModes)
+	return c.verifyConns(ctx, conns, finalResults, false)
+}
+
+// verifyConns runs all verification tests on the connections, adding the test
+// outputs to the results, which are named for the targets in the same order.
+// If closeConns is set, each connection is closed as soon as the tests on its
+// target finish or fail, e.g. due to cancellation, rather than being held
+// until every target finishes.
+func (c Config) verifyConns(ctx context.Context, conns []*pgx.Conn, finalResults *Results, closeConns bool) (*Results, error) {
+	targetNames := finalResults.targetNames
+	c.Logger.WithField("targets", targetNames).Infof("Verifying %d targets", len(conns))
+
+	// Record the engine version of each target, to help explain benign
+	// differences between engines in the report.
+	for i, conn := range conns {
+		version, err := fetchEngineVersion(ctx, conn)
+		if err != nil {
+			c.Logger.WithError(err).WithField("target", targetNames[i]).Warn("Failed to query engine version")
+
+			continue
+		}
+
+		finalResults.addVersion(targetNames[i], version)
+	}
+
+	if c.RequireEngine != "" {
+		if err := checkRequiredEngine(c.RequireEngine, targetNames, finalResults.Versions()); err != nil {
+			if closeConns {
+				for _, conn := range conns {
+					conn.Close(ctx)
+				}
+			}
+
+			return finalResults, err
+		}
+	}
+
+	if !c.ModifiedSince.IsZero() {
+		c.modifiedTables = c.fetchModifiedTables(ctx, conns, targetNames)
+	}
+
+	if c.LatestPartitions > 0 {
+		c.skippedPartitions = c.fetchSkippedPartitions(ctx, conns, targetNames)
+	}
+
+	if c.usesTestMode(TestModeBookend) {
+		c.smallBookendTables = c.fetchSmallBookendTables(ctx, conns, targetNames)
+	}
+
+	if c.SkipEmptyTables {
+		c.emptyTables = c.fetchEmptyTables(ctx, conns, targetNames)
+	}
+
+	if c.ExplainThreshold > 0 {
+		c.overExplainThresholdTables = c.fetchOverExplainThresholdTables(ctx, conns, targetNames)
+	}
 
-	// Then query each target database in parallel to generate table hashes.
-	var doneChannels []chan struct{}
+	// Query each target database in parallel to generate table hashes.
+	var doneChannels []chan error
 
 	for i, conn := range conns {
-		done := make(chan struct{})
-		go c.runTestsOnTarget(ctx, targetNames[i], conn, finalResults, done)
+		done := make(chan error, 1)
+
+		go func(targetName string, conn *pgx.Conn, done chan error) {
+			targetDone := make(chan error, 1)
+			c.runTestsOnTarget(ctx, targetName, conn, finalResults, targetDone)
+
+			if closeConns {
+				conn.Close(ctx)
+				c.Logger.WithField("target", targetName).Debug("Closed connection")
+			}
+
+			done <- <-targetDone
+		}(targetNames[i], conn, done)
+
 		doneChannels = append(doneChannels, done)
 	}
 
-	for _, done := range doneChannels {
-		<-done
+	var targetErrors []error
+
+	for i, done := range doneChannels {
+		if err := <-done; err != nil {
+			targetErrors = append(targetErrors, errors.Wrapf(err, "target %s", targetNames[i]))
+		}
 	}
 
 	// Compare final results
-	reportErrors := finalResults.CheckForErrors()
+	finalResults.logMismatches(c.Logger)
+
+	reportErrors := append(targetErrors, finalResults.CheckForErrors()...)
 	if len(reportErrors) > 0 {
 		return finalResults, multierr.Combine(reportErrors...)
 	}
@@ -86,183 +198,1328 @@ func (c Config) Verify(ctx context.Context, targets []*pgx.ConnConfig) (*Results
 	return finalResults, nil
 }
 
-func (c Config) runTestsOnTarget(ctx context.Context, targetName string, conn *pgx.Conn, finalResults *Results, done chan struct{}) {
-	logger := c.Logger.WithField("target", targetName)
+// newResults creates a new Results object for the given targets, configured
+// with the reporting options.
+func (c Config) newResults(targetNames []string) *Results {
+	results := NewResults(targetNames, c.tableTestModes())
+	results.onlyMismatches = c.OnlyShowMismatches
+	results.groupBySchema = c.GroupBySchema
+	results.redactHashes = c.RedactHashes
+	results.rowCountTolerance = int64(c.RowCountTolerance)
+	results.showHashedColumns = c.ReportHashedColumns
+
+	return results
+}
+
+// targetNames returns the names used to identify each target in logs and
+// reporting output, using the configured alias at the same index when
+// available and falling back to the default target name otherwise.
+func (c Config) targetNames(targets []*pgx.ConnConfig) []string {
+	targetNames := make([]string, len(targets))
+
+	for i, target := range targets {
+		if i < len(c.Aliases) && c.Aliases[i] != "" {
+			targetNames[i] = c.Aliases[i]
+		} else {
+			targetNames[i] = defaultTargetName(target)
+		}
+	}
+
+	return targetNames
+}
+
+// defaultTargetName returns the name used to identify a target without an
+// alias, in the form user@host:port/database. The user distinguishes targets
+// that differ only by role, such as when tunneling to localhost.
+func defaultTargetName(target *pgx.ConnConfig) string {
+	name := fmt.Sprintf("%s:%d/%s", target.Host, target.Port, target.Database)
+	if target.User != "" {
+		name = target.User + "@" + name
+	}
+
+	return name
+}
+
+// connectTarget connects to the given target, routing pgx logs through the
+// configured logger.
+func (c Config) connectTarget(ctx context.Context, target *pgx.ConnConfig, targetName string) (conn *pgx.Conn, err error) {
+	ctx, span := c.startSpan(ctx, SpanConnect, map[string]string{"target": targetName})
+	defer func() { span.End(err) }()
+
+	// The target name is the canonical identifier in all log lines, as the
+	// connection details can be ambiguous, e.g. when tunneling to localhost.
+	pgxLoggerFields := logrus.Fields{
+		"component": "pgx",
+		"target":    targetName,
+		"host":      target.Host,
+		"port":      target.Port,
+		"database":  target.Database,
+		"user":      target.User,
+	}
 
-	schemaTableHashes, err := c.fetchTargetTableNames(ctx, logger, conn)
+	target.Logger = &pgxLogger{c.Logger.WithFields(pgxLoggerFields)}
+
+	target.LogLevel = pgx.LogLevelError
+
+	if _, ok := target.RuntimeParams["application_name"]; !ok && c.ApplicationName != "" {
+		if target.RuntimeParams == nil {
+			target.RuntimeParams = make(map[string]string)
+		}
+
+		target.RuntimeParams["application_name"] = c.ApplicationName
+	}
+
+	conn, err = pgx.ConnectConfig(ctx, target)
 	if err != nil {
-		logger.WithError(err).Error("failed to fetch target tables")
-		close(done)
+		return nil, err
+	}
 
-		return
+	if err = c.configureSession(ctx, conn); err != nil {
+		conn.Close(ctx)
+
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// configureSession applies the configured session settings to the connection.
+func (c Config) configureSession(ctx context.Context, conn *pgx.Conn) error {
+	// Have the server cancel long running queries, rather than only giving up
+	// client-side and leaving them consuming resources.
+	if c.StatementTimeout > 0 {
+		query := fmt.Sprintf("SET statement_timeout = '%dms'", c.StatementTimeout.Milliseconds())
+		if _, err := conn.Exec(ctx, query); err != nil {
+			return errors.Wrap(wrapQueryError(err, query), "failed to set statement timeout")
+		}
+	}
+
+	// Give up on queries waiting for locks, e.g. held by concurrent DDL,
+	// rather than queuing behind them and blocking other sessions.
+	if c.LockTimeout > 0 {
+		query := fmt.Sprintf("SET lock_timeout = '%dms'", c.LockTimeout.Milliseconds())
+		if _, err := conn.Exec(ctx, query); err != nil {
+			return errors.Wrap(wrapQueryError(err, query), "failed to set lock timeout")
+		}
+	}
+
+	return nil
+}
+
+// targetResult holds the test outputs and metadata from running the
+// verification tests on a single target.
+type targetResult struct {
+	hashes   SingleResult
+	warnings []string
+	// Time spent running the test queries on each table, stored with the
+	// schema:
+	//   elapsed[schema][table] = duration
+	elapsed map[string]map[string]time.Duration
+	// The names of the columns hashed in each table, stored with the schema:
+	//   hashedColumns[schema][table] = [column1, ...]
+	hashedColumns map[string]map[string][]string
+}
+
+// addElapsed records time spent running a test query on the table.
+func (r *targetResult) addElapsed(schemaName, tableName string, elapsed time.Duration) {
+	if _, ok := r.elapsed[schemaName]; !ok {
+		r.elapsed[schemaName] = make(map[string]time.Duration)
+	}
+
+	r.elapsed[schemaName][tableName] += elapsed
+}
+
+// addHashedColumns records the columns hashed in the table.
+func (r *targetResult) addHashedColumns(schemaName, tableName string, columns []column) {
+	if _, ok := r.hashedColumns[schemaName]; !ok {
+		r.hashedColumns[schemaName] = make(map[string][]string)
+	}
+
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.name
+	}
+
+	r.hashedColumns[schemaName][tableName] = names
+}
+
+func (c Config) runTestsOnTarget(ctx context.Context, targetName string, conn *pgx.Conn, finalResults *Results, done chan error) {
+	logger := c.Logger.WithField("target", targetName)
+
+	if c.hasTestMode(TestModeSelfCheck) {
+		output, err := runSelfCheck(ctx, conn)
+		if err != nil {
+			logger.WithError(err).Error("Failed to run hashing self-check")
+		}
+
+		finalResults.addSelfCheck(targetName, output)
+	}
+
+	beginTransaction := beginSnapshot
+
+	if c.AsOfSystemTime != "" {
+		if isCockroachDB(conn) {
+			// The historical reads are also a consistent snapshot of the
+			// target, so are run in a single transaction the same way.
+			c.ConsistentSnapshot = true
+			beginTransaction = func(ctx context.Context, conn *pgx.Conn) error {
+				return beginAsOfSystemTime(ctx, conn, c.AsOfSystemTime)
+			}
+		} else {
+			logger.Warn("AS OF SYSTEM TIME is only supported on CockroachDB, verifying the latest data")
+		}
+	}
+
+	if c.ConsistentSnapshot {
+		if err := beginTransaction(ctx, conn); err != nil {
+			logger.WithError(err).Error("failed to begin consistent snapshot")
+			done <- err
+
+			return
+		}
+
+		defer func() {
+			if err := endSnapshot(ctx, conn); err != nil {
+				logger.WithError(err).Warn("Failed to end consistent snapshot")
+			}
+		}()
 	}
 
-	schemaTableHashes, err = c.runTestQueriesOnTarget(ctx, logger, conn, schemaTableHashes)
+	result, err := c.computeTargetResult(ctx, logger, targetName, conn)
 	if err != nil {
-		logger.WithError(err).Error("failed to run verification tests")
-		close(done)
+		logger.WithError(err).Error("failed to compute table hashes")
+		done <- err
 
 		return
 	}
 
-	finalResults.AddResult(targetName, schemaTableHashes)
+	finalResults.AddResult(targetName, result.hashes)
+	finalResults.AddWarnings(targetName, result.warnings...)
+
+	finalResults.AddHashedColumns(targetName, result.hashedColumns)
+
+	if c.Throughput {
+		finalResults.AddElapsed(targetName, result.elapsed)
+	}
+
 	logger.Info("Table hashes computed")
 	close(done)
 }
 
-func (c Config) fetchTargetTableNames(ctx context.Context, logger *logrus.Entry, conn *pgx.Conn) (SingleResult, error) {
+// computeTargetResult enumerates the tables on the target and runs the
+// configured test modes against each of them.
+func (c Config) computeTargetResult(ctx context.Context, logger *logrus.Entry, targetName string, conn *pgx.Conn) (*targetResult, error) {
+	c = c.withTargetShardedTables(targetName)
+
+	if c.RowHashExpression != "" {
+		// Queries in a consistent snapshot run under a savepoint, so that a
+		// failure does not abort the transaction for the queries after it.
+		if err := c.withSavepoint(ctx, conn, func() error {
+			return c.checkRowHashExpression(ctx, conn)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	spanCtx, span := c.startSpan(ctx, SpanFetchTables, map[string]string{"target": targetName})
+
+	var schemaTableHashes SingleResult
+
+	err := c.withSavepoint(spanCtx, conn, func() (err error) {
+		schemaTableHashes, err = c.fetchTargetTableNames(spanCtx, logger, targetName, conn)
+
+		return err
+	})
+	span.End(err)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch target tables")
+	}
+
+	numTables := 0
+	for _, tables := range schemaTableHashes {
+		numTables += len(tables)
+	}
+
+	if c.MaxTables > 0 && numTables > c.MaxTables {
+		return nil, fmt.Errorf("found %d tables to verify, exceeding the limit of %d; use narrower schema and table filters or raise the limit", numTables, c.MaxTables)
+	}
+
+	result := &targetResult{
+		hashes:        schemaTableHashes,
+		elapsed:       make(map[string]map[string]time.Duration),
+		hashedColumns: make(map[string]map[string][]string),
+	}
+
+	if isCockroachDB(conn) {
+		// Table test modes may configure test modes beyond the defaults.
+		for _, warning := range cockroachCapabilityWarnings(c.allTestModes(), conn.PgConn().ParameterStatus("crdb_version")) {
+			logger.Warn(warning)
+			result.warnings = append(result.warnings, warning)
+		}
+	}
+
+	// An empty verification would otherwise pass, e.g. when a typo in a
+	// schema filter matches nothing.
+	if numTables == 0 {
+		if c.FailOnNoTables {
+			return nil, errors.New("found no tables to verify; check the schema and table filters")
+		}
+
+		warning := "found no tables to verify on target " + targetName
+		logger.Warn(warning)
+		result.warnings = append(result.warnings, warning)
+	}
+
+	pool := newConnPool(conn)
+	defer pool.close(ctx)
+
+	if c.usesTestMode(TestModeColumns) {
+		if err := c.growConnPool(ctx, pool, c.ColumnParallelism, targetName); err != nil {
+			return nil, errors.Wrap(err, "failed to open connections for the columns test")
+		}
+
+		// The extra connections must see the same snapshot as the target's
+		// connection, or the columns test runs on the target's connection
+		// alone. Snapshots cannot be exported on CockroachDB, and trying to
+		// would abort its transaction.
+		if c.ConsistentSnapshot && len(pool.opened) > 0 {
+			if isCockroachDB(conn) {
+				logger.Info("Snapshots cannot be shared on CockroachDB, running column tests one at a time")
+				pool.close(ctx)
+
+				pool = newConnPool(conn)
+			} else if err := c.withSavepoint(ctx, conn, func() error {
+				return shareSnapshot(ctx, conn, pool.opened)
+			}); err != nil {
+				logger.WithError(err).Warn("Failed to share consistent snapshot, running column tests one at a time")
+				pool.close(ctx)
+
+				pool = newConnPool(conn)
+			}
+		}
+	}
+
+	if err := c.runTestQueriesOnTarget(ctx, logger, targetName, conn, pool, result); err != nil {
+		return nil, errors.Wrap(err, "failed to run verification tests")
+	}
+
+	return result, nil
+}
+
+// fetchTargetTableNames enumerates the tables to verify on the target, keyed by
+// the schema names used for comparison.
+func (c Config) fetchTargetTableNames(ctx context.Context, logger *logrus.Entry, targetName string, conn *pgx.Conn) (SingleResult, error) {
 	schemaTableHashes := make(SingleResult)
+	c = c.withTargetShardedTables(targetName)
+
+	// Schema filters are configured with the schema names used for comparison,
+	// so are translated to the physical names on this target.
+	targetConfig := c
+	targetConfig.IncludeSchemas = c.physicalSchemas(targetName, c.IncludeSchemas)
+	targetConfig.ExcludeSchemas = c.physicalSchemas(targetName, c.ExcludeSchemas)
 
-	rows, err := conn.Query(ctx, buildGetTablesQuery(c.IncludeSchemas, c.ExcludeSchemas, c.IncludeTables, c.ExcludeTables))
+	query := buildGetTablesQuery(targetConfig)
+
+	rows, err := conn.Query(ctx, query)
 	if err != nil {
-		return schemaTableHashes, errors.Wrap(err, "failed to query for tables")
+		return schemaTableHashes, errors.Wrap(wrapQueryError(err, query), "failed to query for tables")
 	}
 
 	for rows.Next() {
-		var schema, table pgtype.Text
-		if err := rows.Scan(&schema, &table); err != nil {
+		var physicalSchema, table pgtype.Text
+		if err := rows.Scan(&physicalSchema, &table); err != nil {
 			return schemaTableHashes, errors.Wrap(err, "failed to scan row data for table names")
 		}
 
-		if _, ok := schemaTableHashes[schema.String]; !ok {
-			schemaTableHashes[schema.String] = make(map[string]map[string]string)
+		schema := c.comparisonSchema(targetName, physicalSchema.String)
+		// The shards of a sharded table are all listed as the logical table.
+		tableName := c.logicalTableName(physicalSchema.String, table.String)
+
+		if c.modifiedTables != nil && !c.modifiedTables[qualifiedTableName(schema, tableName)] {
+			logger.WithField("schema", schema).WithField("table", tableName).Debug("Skipping table not modified since the configured time")
+
+			continue
 		}
 
-		schemaTableHashes[schema.String][table.String] = make(map[string]string)
+		if !c.sampledTable(schema, tableName) {
+			logger.WithField("schema", schema).WithField("table", tableName).Debug("Skipping table not in the table sample")
 
-		for _, testMode := range c.TestModes {
-			schemaTableHashes[schema.String][table.String][testMode] = defaultErrorOutput
+			continue
 		}
-	}
 
-	return schemaTableHashes, nil
-}
+		if c.skippedPartitions[qualifiedTableName(schema, tableName)] {
+			logger.WithField("schema", schema).WithField("table", tableName).Debug("Skipping table not among the latest partitions")
 
-func (c Config) validColumnTarget(columnName string) bool {
-	if len(c.IncludeColumns) == 0 {
-		for _, excludedColumn := range c.ExcludeColumns {
-			if excludedColumn == columnName {
-				return false
-			}
+			continue
 		}
 
-		return true
-	}
+		if c.emptyTables[qualifiedTableName(schema, tableName)] {
+			logger.WithField("schema", schema).WithField("table", tableName).Debug("Skipping table empty on every target")
 
-	for _, includedColumn := range c.IncludeColumns {
-		if includedColumn == columnName {
-			return true
+			continue
+		}
+
+		if _, ok := schemaTableHashes[schema]; !ok {
+			schemaTableHashes[schema] = make(map[string]map[string]string)
+		}
+
+		schemaTableHashes[schema][tableName] = make(map[string]string)
+
+		for _, testMode := range c.testModesForTable(schema, tableName) {
+			schemaTableHashes[schema][tableName][testMode] = defaultErrorOutput
 		}
 	}
 
-	return false
+	if err := rows.Err(); err != nil {
+		return schemaTableHashes, errors.Wrap(wrapQueryError(err, query), "failed to query for tables")
+	}
+
+	return schemaTableHashes, nil
 }
 
-func (c Config) runTestQueriesOnTarget(ctx context.Context, logger *logrus.Entry, conn *pgx.Conn, schemaTableHashes SingleResult) (SingleResult, error) {
-	for schemaName, tables := range schemaTableHashes {
-		for tableName := range tables {
-			tableLogger := logger.WithField("table", tableName).WithField("schema", schemaName)
-			tableLogger.Info("Computing hash")
+// fetchModifiedTables returns the set of tables, as "schema.table", that the
+// table statistics suggest have been modified on any of the targets since the
+// configured time. If the statistics are unavailable on any target, e.g. on
+// CockroachDB, nil is returned and all tables are verified.
+func (c Config) fetchModifiedTables(ctx context.Context, conns []*pgx.Conn, targetNames []string) map[string]bool {
+	modifiedTables := make(map[string]bool)
+	query := buildGetModifiedTablesQuery(c.ModifiedSince)
 
-			rows, err := conn.Query(ctx, buildGetColumsQuery(schemaName, tableName))
-			if err != nil {
-				tableLogger.WithError(err).Error("Failed to query column names, data types")
+	for i, conn := range conns {
+		logger := c.Logger.WithField("target", targetNames[i])
 
-				continue
-			}
+		rows, err := conn.Query(ctx, query)
+		if err != nil {
+			logger.WithError(wrapQueryError(err, query)).Warn("Table statistics unavailable, verifying all tables")
 
-			allTableColumns := make(map[string]column)
+			return nil
+		}
 
-			for rows.Next() {
-				var columnName, dataType, constraintName, constraintType pgtype.Text
+		numTables := 0
 
-				err := rows.Scan(&columnName, &dataType, &constraintName, &constraintType)
-				if err != nil {
-					tableLogger.WithError(err).Error("Failed to parse column names, data types from query response")
+		for rows.Next() {
+			var schema, table pgtype.Text
 
-					continue
-				}
+			var modified bool
+			if err := rows.Scan(&schema, &table, &modified); err != nil {
+				rows.Close()
+				logger.WithError(err).Warn("Failed to scan table statistics, verifying all tables")
 
-				existing, ok := allTableColumns[columnName.String]
-				if ok {
-					existing.constraints = append(existing.constraints, constraintType.String)
-					allTableColumns[columnName.String] = existing
-				} else {
-					allTableColumns[columnName.String] = column{columnName.String, dataType.String, []string{constraintType.String}}
-				}
+				return nil
 			}
 
-			var tableColumns []column
+			numTables++
 
-			var primaryKeyColumnNames []string
+			if modified {
+				tableName := c.withTargetShardedTables(targetNames[i]).logicalTableName(schema.String, table.String)
+				modifiedTables[qualifiedTableName(c.comparisonSchema(targetNames[i], schema.String), tableName)] = true
+			}
+		}
 
-			for _, col := range allTableColumns {
-				if col.IsPrimaryKey() {
-					primaryKeyColumnNames = append(primaryKeyColumnNames, col.name)
-				}
+		if err := rows.Err(); err != nil || numTables == 0 {
+			logger.WithError(err).Warn("Table statistics unavailable, verifying all tables")
 
-				if c.validColumnTarget(col.name) {
-					tableColumns = append(tableColumns, col)
-				}
-			}
+			return nil
+		}
+	}
 
-			if len(primaryKeyColumnNames) == 0 {
-				tableLogger.Error("No primary keys found")
+	return modifiedTables
+}
 
-				continue
-			}
+// fetchEmptyTables returns the set of tables, as "schema.table", without any
+// rows on every target. Tables that could not be checked, or that are missing
+// on any target, are not considered empty and are verified as usual.
+func (c Config) fetchEmptyTables(ctx context.Context, conns []*pgx.Conn, targetNames []string) map[string]bool {
+	emptyCounts := make(map[string]int)
 
-			tableLogger.WithFields(logrus.Fields{
-				"primary_keys": primaryKeyColumnNames,
-				"columns":      tableColumns,
-			}).Info("Determined columns to hash")
+	for i, conn := range conns {
+		logger := c.Logger.WithField("target", targetNames[i])
 
-			for _, testMode := range c.TestModes {
-				testLogger := tableLogger.WithField("test", testMode)
+		targetConfig := c.withTargetShardedTables(targetNames[i])
 
-				var query string
+		schemaTables, err := targetConfig.fetchTargetTableNames(ctx, logger, targetNames[i], conn)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to enumerate tables, verifying all tables")
 
-				switch testMode {
-				case TestModeFull:
-					query = buildFullHashQuery(c, schemaName, tableName, tableColumns)
-				case TestModeBookend:
-					query = buildBookendHashQuery(c, schemaName, tableName, tableColumns, c.BookendLimit)
-				case TestModeSparse:
-					query = buildSparseHashQuery(c, schemaName, tableName, tableColumns, c.SparseMod)
-				case TestModeRowCount:
-					query = buildRowCountQuery(schemaName, tableName)
-				}
+			return nil
+		}
 
-				testLogger.Debugf("Generated query: %s", query)
+		for schemaName, tables := range schemaTables {
+			for tableName := range tables {
+				query := buildTableHasRowsQuery(targetConfig, c.physicalSchema(targetNames[i], schemaName), tableName, c.tablePredicates(targetNames[i], schemaName, tableName))
 
-				testOutput, err := runTestOnTable(ctx, conn, query)
-				if err != nil {
-					testLogger.WithError(err).Error("Failed to compute hash")
+				var hasRows bool
+				if err := conn.QueryRow(ctx, query).Scan(&hasRows); err != nil {
+					logger.WithError(wrapQueryError(err, query)).Warn("Failed to check whether table is empty, verifying it")
 
 					continue
 				}
 
-				schemaTableHashes[schemaName][tableName][testMode] = testOutput
-				testLogger.Infof("Hash computed: %s", testOutput)
+				if !hasRows {
+					emptyCounts[qualifiedTableName(schemaName, tableName)]++
+				}
 			}
 		}
 	}
 
-	return schemaTableHashes, nil
+	emptyTables := make(map[string]bool)
+
+	for table, count := range emptyCounts {
+		if count == len(conns) {
+			emptyTables[table] = true
+		}
+	}
+
+	return emptyTables
 }
 
-func runTestOnTable(ctx context.Context, conn *pgx.Conn, query string) (string, error) {
-	row := conn.QueryRow(ctx, query)
+// physicalSchema returns the name of the schema on the target that is compared
+// as the given schema.
+func (c Config) physicalSchema(targetName, schemaName string) string {
+	if physical, ok := c.TargetSchemas[targetName][schemaName]; ok {
+		return physical
+	}
 
-	var testOutput pgtype.Text
-	if err := row.Scan(&testOutput); err != nil {
-		switch err {
-		case pgx.ErrNoRows:
-			return "no rows", nil
-		default:
-			return "", errors.Wrap(err, "failed to scan test output")
+	return schemaName
+}
+
+// physicalSchemas returns the physical names of the given schemas on the target.
+func (c Config) physicalSchemas(targetName string, schemaNames []string) []string {
+	if len(c.TargetSchemas[targetName]) == 0 {
+		return schemaNames
+	}
+
+	physical := make([]string, len(schemaNames))
+	for i, schemaName := range schemaNames {
+		physical[i] = c.physicalSchema(targetName, schemaName)
+	}
+
+	return physical
+}
+
+// comparisonSchema returns the name used to compare the physical schema on the
+// target with the other targets.
+func (c Config) comparisonSchema(targetName, physicalSchemaName string) string {
+	for schemaName, physical := range c.TargetSchemas[targetName] {
+		if physical == physicalSchemaName {
+			return schemaName
 		}
 	}
 
+	return physicalSchemaName
+}
+
+// validColumnTarget returns whether the column should be hashed according to
+// the column filters. Primary key columns are always hashed, as the rows are
+// ordered by them.
+func (c Config) validColumnTarget(col column) bool {
+	if col.IsPrimaryKey() {
+		return true
+	}
+
+	for _, excludedType := range c.ExcludeColumnTypes {
+		if canonicalDataType(c, excludedType) == col.dataType {
+			return false
+		}
+	}
+
+	if len(c.IncludeColumns) == 0 {
+		for _, excludedColumn := range c.ExcludeColumns {
+			if excludedColumn == col.name {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	for _, includedColumn := range c.IncludeColumns {
+		if includedColumn == col.name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// comparableColumn returns whether the column can be reliably compared between
+// engines, either because its type has a consistent text representation or
+// because a type cast override has been configured for it.
+func (c Config) comparableColumn(col column) bool {
+	if _, ok := c.TypeCasts[strings.ToLower(col.dataType)]; ok {
+		return true
+	}
+
+	return !col.IsIncomparable()
+}
+
+// tablePredicates returns the SQL predicates used to filter the rows of the
+// given table on the given target.
+func (c Config) tablePredicates(targetName, schemaName, tableName string) []string {
+	var predicates []string
+
+	if filter, ok := c.RowFilters[qualifiedTableName(schemaName, tableName)]; ok {
+		predicates = append(predicates, filter)
+	}
+
+	if filter, ok := c.TargetRowFilters[targetName][qualifiedTableName(schemaName, tableName)]; ok {
+		predicates = append(predicates, filter)
+	}
+
+	if window, ok := c.TimeWindows[qualifiedTableName(schemaName, tableName)]; ok {
+		predicates = append(predicates, buildTimeWindowPredicate(c, window))
+	}
+
+	return predicates
+}
+
+func (c Config) runTestQueriesOnTarget(ctx context.Context, logger *logrus.Entry, targetName string, conn *pgx.Conn, pool *connPool, result *targetResult) error {
+	schemaTableHashes := result.hashes
+	engine := engineName(conn)
+
+	var tests []tableTest
+
+	for schemaName, tables := range schemaTableHashes {
+		for tableName := range tables {
+			// The schema name is used to compare results between targets, while
+			// the physical schema name is used to query this target.
+			physicalSchemaName := c.physicalSchema(targetName, schemaName)
+
+			tableLogger := logger.WithFields(logrus.Fields{"schema": schemaName, "table": tableName})
+			testModes := c.testModesForTable(schemaName, tableName)
+
+			// The existence test only relies on the tables listed, so the
+			// table is not queried if no other test modes run on it.
+			if containsString(testModes, TestModeExistence) {
+				schemaTableHashes[schemaName][tableName][TestModeExistence] = tableExistsOutput
+
+				if len(testModes) == 1 {
+					continue
+				}
+			}
+
+			tableLogger.Info("Computing hash")
+
+			var allTableColumns map[string]column
+
+			err := c.withSavepoint(ctx, conn, func() (err error) {
+				allTableColumns, err = c.fetchTableColumns(ctx, tableLogger, conn, physicalSchemaName, c.metadataTableName(physicalSchemaName, tableName))
+
+				return err
+			})
+			if err != nil {
+				tableLogger.WithError(err).Error("Failed to query column names, data types")
+
+				continue
+			}
+
+			var tableColumns []column
+
+			var primaryKeyColumnNames []string
+
+			var excludedPrimaryKeyErr error
+
+			for _, col := range allTableColumns {
+				if col.IsPrimaryKey() {
+					primaryKeyColumnNames = append(primaryKeyColumnNames, col.name)
+
+					for _, excludedColumn := range c.ExcludeColumns {
+						if excludedColumn == col.name && len(c.IncludeColumns) == 0 {
+							excludedPrimaryKeyErr = fmt.Errorf("column %s.%s.%s is part of the primary key and cannot be excluded from verification", schemaName, tableName, col.name)
+						}
+					}
+				}
+
+				if !c.validColumnTarget(col) {
+					continue
+				}
+
+				if !c.comparableColumn(col) {
+					if c.StrictTypes {
+						return fmt.Errorf("column %s.%s.%s has type %s which cannot be reliably compared between engines, and no type cast override is configured", schemaName, tableName, col.name, col.dataType)
+					}
+
+					warning := fmt.Sprintf("skipped column %s.%s.%s with incomparable type %s", schemaName, tableName, col.name, col.dataType)
+					tableLogger.Warn(warning)
+					result.warnings = append(result.warnings, warning)
+
+					continue
+				}
+
+				tableColumns = append(tableColumns, col)
+			}
+
+			// The DDL, defaults, nullability, comments, and constraints tests
+			// only rely on metadata, so do not require primary keys. They
+			// compare the table's whole definition, including the columns
+			// that are not selected or cannot be compared by the hash tests.
+			metadataColumns := make([]column, 0, len(allTableColumns))
+			for _, name := range sortedKeys(allTableColumns) {
+				metadataColumns = append(metadataColumns, allTableColumns[name])
+			}
+
+			for _, testMode := range testModes {
+				switch testMode {
+				case TestModeDDL:
+					schemaTableHashes[schemaName][tableName][testMode] = ddlFingerprint(metadataColumns)
+				case TestModeDefaults:
+					schemaTableHashes[schemaName][tableName][testMode] = columnDefaults(metadataColumns)
+				case TestModeNullability:
+					schemaTableHashes[schemaName][tableName][testMode] = columnNullability(metadataColumns)
+				case TestModeComments:
+					var output string
+
+					err := c.withSavepoint(ctx, conn, func() (err error) {
+						output, err = fetchCommentsFingerprint(ctx, conn, physicalSchemaName, c.metadataTableName(physicalSchemaName, tableName), metadataColumns)
+
+						return err
+					})
+					if err != nil {
+						tableLogger.WithError(err).Error("Failed to query comments")
+
+						output = defaultErrorOutput
+					}
+
+					schemaTableHashes[schemaName][tableName][testMode] = output
+				case TestModeConstraints:
+					var output string
+
+					err := c.withSavepoint(ctx, conn, func() (err error) {
+						output, err = fetchConstraintsFingerprint(ctx, conn, physicalSchemaName, c.metadataTableName(physicalSchemaName, tableName))
+
+						return err
+					})
+					if err != nil {
+						tableLogger.WithError(err).Error("Failed to query constraints")
+
+						output = defaultErrorOutput
+					}
+
+					schemaTableHashes[schemaName][tableName][testMode] = output
+				}
+			}
+
+			// The rows cannot be told apart without the whole primary key, so
+			// the tests that hash them fail on this table alone.
+			if excludedPrimaryKeyErr != nil {
+				tableLogger.WithError(excludedPrimaryKeyErr).Error("Failed to determine columns to hash")
+
+				for _, testMode := range testModes {
+					if _, ok := schemaTableHashes[schemaName][tableName][testMode]; !ok {
+						schemaTableHashes[schemaName][tableName][testMode] = errorOutput(excludedPrimaryKeyErr)
+					}
+				}
+
+				continue
+			}
+
+			// System columns are hashed, but are not part of the table's
+			// definition compared by the metadata tests.
+			tableColumns = append(tableColumns, c.systemColumns()...)
+
+			noPrimaryKey := len(primaryKeyColumnNames) == 0
+			if noPrimaryKey {
+				if !c.AllowNoPrimaryKey {
+					tableLogger.Error("No primary keys found")
+
+					continue
+				}
+
+				tableLogger.Warn("No primary keys found, hashing rows in any order")
+			}
+
+			tableLogger.WithFields(logrus.Fields{
+				"primary_keys": primaryKeyColumnNames,
+				"columns":      tableColumns,
+			}).Info("Determined columns to hash")
+
+			result.addHashedColumns(schemaName, tableName, tableColumns)
+			columnNames := result.hashedColumns[schemaName][tableName]
+
+			predicates := c.tablePredicates(targetName, schemaName, tableName)
+
+			if keys, ok := c.ExcludedPrimaryKeys[qualifiedTableName(schemaName, tableName)]; ok && len(keys) > 0 {
+				if noPrimaryKey {
+					tableLogger.Warn("Ignoring excluded primary keys for table without a primary key")
+				} else {
+					predicates = append(predicates, buildExcludedKeysPredicate(c, primaryKeyColumnNames, keys))
+				}
+			}
+
+			if containsString(testModes, TestModeColumns) {
+				output, err := c.runColumnTests(ctx, pool, physicalSchemaName, tableName, tableColumns, predicates, noPrimaryKey)
+				if err != nil {
+					tableLogger.WithError(err).Error("Failed to compute column hashes")
+
+					output = errorOutput(err)
+				}
+
+				schemaTableHashes[schemaName][tableName][TestModeColumns] = output
+			}
+
+			for _, testMode := range testModes {
+				mode, ok := lookupTestMode(testMode)
+				if !ok {
+					// Unregistered test modes have already been run above.
+					continue
+				}
+
+				if noPrimaryKey {
+					switch testMode {
+					case TestModeFull:
+						mode = unorderedFullTestMode{}
+					case TestModeBookend, TestModeSparse:
+						schemaTableHashes[schemaName][tableName][testMode] = noPrimaryKeyOutput
+
+						continue
+					}
+				}
+
+				if testMode == TestModeFull && c.ChunkSize > 0 && !noPrimaryKey {
+					test := tableTest{
+						schemaName: schemaName,
+						tableName:  tableName,
+						targetName: targetName,
+						engine:     engine,
+						testMode:   testMode,
+						columns:    columnNames,
+						logger:     tableLogger.WithField("mode", testMode),
+					}
+
+					start := time.Now()
+					output, err := c.runChunkedFullTest(ctx, test.logger, conn, physicalSchemaName, tableName, tableColumns, shardPredicates(c, tableColumns, predicates))
+					elapsed := time.Since(start)
+					c.finishTest(test, output, elapsed, err)
+
+					if err != nil {
+						schemaTableHashes[schemaName][tableName][testMode] = errorOutput(err)
+
+						continue
+					}
+
+					result.addElapsed(schemaName, tableName, elapsed)
+					schemaTableHashes[schemaName][tableName][testMode] = output
+
+					continue
+				}
+
+				if estimate, ok := c.smallBookendTables[qualifiedTableName(schemaName, tableName)]; ok && testMode == TestModeBookend && !noPrimaryKey {
+					if c.BookendAsFull {
+						tableLogger.WithField("estimated_rows", estimate).Info("Running the full test in place of the bookend test on small table")
+
+						mode = bookendAsFullTestMode{}
+					} else {
+						warning := c.smallBookendWarning(schemaName, tableName, estimate)
+						tableLogger.Warn(warning)
+						result.warnings = append(result.warnings, warning)
+					}
+				}
+
+				if testMode == TestModeHistogram {
+					expression, ok := c.HistogramColumns[qualifiedTableName(schemaName, tableName)]
+					if !ok {
+						schemaTableHashes[schemaName][tableName][testMode] = noHistogramOutput
+
+						continue
+					}
+
+					mode = histogramTestMode{expression: expression}
+				}
+
+				tests = append(tests, tableTest{
+					schemaName: schemaName,
+					tableName:  tableName,
+					targetName: targetName,
+					engine:     engine,
+					testMode:   testMode,
+					columns:    columnNames,
+					mode:       mode,
+					query:      mode.BuildQuery(c, physicalSchemaName, tableName, tableColumns, predicates),
+					logger:     tableLogger.WithField("mode", testMode),
+				})
+			}
+		}
+	}
+
+	if c.ExplainThreshold > 0 {
+		tests = c.checkExplainThreshold(tests, result)
+	}
+
+	switch {
+	case c.BatchedConsistentRun && len(tests) > 0:
+		batchConfig := c
+		batchConfig.QueryBatchSize = len(tests)
+		batchConfig.runBatchedTableTests(ctx, logger, conn, tests, result)
+	case c.QueryBatchSize > 1:
+		c.runBatchedTableTests(ctx, logger, conn, tests, result)
+	default:
+		c.runTableTests(ctx, conn, tests, result)
+	}
+
+	return nil
+}
+
+// fetchTableColumns queries the columns of the table, keyed by column name,
+// along with their data types, constraints, and defaults.
+func (c Config) fetchTableColumns(ctx context.Context, logger *logrus.Entry, conn *pgx.Conn, schemaName, tableName string) (map[string]column, error) {
+	columnsQuery := buildGetColumsQuery(c, schemaName, tableName)
+
+	rows, err := conn.Query(ctx, columnsQuery)
+	if err != nil {
+		return nil, wrapQueryError(err, columnsQuery)
+	}
+
+	allTableColumns := make(map[string]column)
+
+	for rows.Next() {
+		var columnName, dataType, constraintName, constraintType, columnDefault pgtype.Text
+
+		var ordinal int64
+
+		var isNullable bool
+
+		err := rows.Scan(&columnName, &dataType, &constraintName, &constraintType, &columnDefault, &ordinal, &isNullable)
+		if err != nil {
+			logger.WithError(err).Error("Failed to parse column names, data types from query response")
+
+			continue
+		}
+
+		existing, ok := allTableColumns[columnName.String]
+		if ok {
+			existing.constraints = append(existing.constraints, constraintType.String)
+			allTableColumns[columnName.String] = existing
+		} else {
+			allTableColumns[columnName.String] = column{
+				name:        columnName.String,
+				dataType:    canonicalDataType(c, dataType.String),
+				constraints: []string{constraintType.String},
+				defaultExpr: columnDefault.String,
+				isNullable:  isNullable,
+				ordinal:     ordinal,
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, wrapQueryError(err, columnsQuery)
+	}
+
+	if isCockroachDB(conn) && !hasPrimaryKey(allTableColumns) {
+		c.addCockroachPrimaryKeys(ctx, logger, conn, schemaName, tableName, allTableColumns)
+	}
+
+	return allTableColumns, nil
+}
+
+// fetchCockroachPrimaryKeys returns the names of the primary key columns of the
+// table from crdb_internal.
+func fetchCockroachPrimaryKeys(ctx context.Context, conn *pgx.Conn, schemaName, tableName string) ([]string, error) {
+	query := buildGetCockroachPrimaryKeysQuery(schemaName, tableName)
+
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, wrapQueryError(err, query)
+	}
+	defer rows.Close()
+
+	var names []string
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, errors.Wrap(err, "failed to parse primary keys")
+		}
+
+		names = append(names, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, wrapQueryError(err, query)
+	}
+
+	return names, nil
+}
+
+// hasPrimaryKey returns whether any of the columns is part of the primary key.
+func hasPrimaryKey(columns map[string]column) bool {
+	for _, col := range columns {
+		if col.IsPrimaryKey() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addCockroachPrimaryKeys marks the primary key columns of the table, found
+// through crdb_internal, as part of the primary key. Some CockroachDB versions
+// do not list primary keys in the information_schema constraint views used to
+// discover them, which would otherwise cause tables with primary keys to be
+// treated as having none. Failures are logged, leaving the columns unchanged.
+func (c Config) addCockroachPrimaryKeys(ctx context.Context, logger *logrus.Entry, conn *pgx.Conn, schemaName, tableName string, columns map[string]column) {
+	var names []string
+
+	// The query failing, e.g. without access to crdb_internal, must not abort
+	// a consistent snapshot for the queries after it.
+	err := c.withSavepoint(ctx, conn, func() (err error) {
+		names, err = fetchCockroachPrimaryKeys(ctx, conn, schemaName, tableName)
+
+		return err
+	})
+	if err != nil {
+		logger.WithError(err).Warn("Failed to query primary keys from crdb_internal")
+
+		return
+	}
+
+	for _, name := range names {
+		if col, ok := columns[name]; ok {
+			col.constraints = append(col.constraints, "PRIMARY KEY")
+			columns[name] = col
+		}
+	}
+
+	if len(names) > 0 {
+		logger.WithField("primary_keys", names).Debug("Found primary keys through crdb_internal")
+	}
+}
+
+// fetchCommentsFingerprint queries the comments on the table and its columns,
+// returning a fingerprint of the table comment and the comments on the given
+// columns.
+func fetchCommentsFingerprint(ctx context.Context, conn *pgx.Conn, schemaName, tableName string, columns []column) (string, error) {
+	query := buildGetCommentsQuery(schemaName, tableName)
+
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return "", wrapQueryError(err, query)
+	}
+	defer rows.Close()
+
+	var tableComment string
+
+	columnComments := make(map[string]string)
+
+	for rows.Next() {
+		var columnName, comment pgtype.Text
+		if err := rows.Scan(&columnName, &comment); err != nil {
+			return "", err
+		}
+
+		if comment.Status != pgtype.Present {
+			continue
+		}
+
+		if columnName.Status == pgtype.Present {
+			columnComments[columnName.String] = comment.String
+		} else {
+			tableComment = comment.String
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return "", wrapQueryError(err, query)
+	}
+
+	return commentsFingerprint(tableComment, columns, columnComments), nil
+}
+
+// fetchConstraintsFingerprint queries the CHECK and FOREIGN KEY constraints on
+// the table, returning a fingerprint of their normalized definitions.
+func fetchConstraintsFingerprint(ctx context.Context, conn *pgx.Conn, schemaName, tableName string) (string, error) {
+	query := buildGetConstraintsQuery(schemaName, tableName)
+
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return "", wrapQueryError(err, query)
+	}
+	defer rows.Close()
+
+	var definitions []string
+
+	for rows.Next() {
+		var definition pgtype.Text
+		if err := rows.Scan(&definition); err != nil {
+			return "", err
+		}
+
+		definitions = append(definitions, definition.String)
+	}
+
+	if err := rows.Err(); err != nil {
+		return "", wrapQueryError(err, query)
+	}
+
+	return constraintsFingerprint(definitions), nil
+}
+
+// tableTest is a single test query to run against a table.
+type tableTest struct {
+	schemaName string
+	tableName  string
+	targetName string
+	engine     string
+	testMode   string
+	columns    []string
+	mode       TestMode
+	query      string
+	logger     *logrus.Entry
+}
+
+// logTestResult logs the outcome of a test query as a structured log line.
+func (c Config) logTestResult(test tableTest, output string, elapsed time.Duration, err error) {
+	logger := test.logger.WithField("duration_ms", elapsed.Milliseconds())
+
+	if err != nil {
+		logger.WithError(err).WithFields(logrus.Fields{
+			"event":  logEventHashFailed,
+			"status": logStatusError,
+		}).Error("Failed to compute hash")
+
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"event":  logEventHashComputed,
+		"status": logStatusOK,
+		"hash":   c.logOutput(test.testMode, output),
+	}).Info("Hash computed")
+}
+
+// runTableTests runs each test query in turn, recording the outputs and time
+// taken.
+func (c Config) runTableTests(ctx context.Context, conn *pgx.Conn, tests []tableTest, result *targetResult) {
+	for _, test := range tests {
+		test.logger.Debugf("Generated query: %s", test.query)
+
+		start := time.Now()
+
+		spanCtx, span := c.startSpan(ctx, SpanTestQuery, map[string]string{
+			"target": test.targetName,
+			"schema": test.schemaName,
+			"table":  test.tableName,
+			"mode":   test.testMode,
+		})
+
+		var testOutput string
+
+		err := c.withSavepoint(spanCtx, conn, func() (err error) {
+			testOutput, err = runTestOnTable(spanCtx, conn, test.mode, test.query)
+
+			return err
+		})
+		span.End(err)
+
+		elapsed := time.Since(start)
+		c.finishTest(test, testOutput, elapsed, err)
+
+		if err != nil {
+			result.hashes[test.schemaName][test.tableName][test.testMode] = errorOutput(err)
+
+			continue
+		}
+
+		result.addElapsed(test.schemaName, test.tableName, elapsed)
+		result.hashes[test.schemaName][test.tableName][test.testMode] = testOutput
+	}
+}
+
+// runColumnTests hashes each of the columns of the table separately alongside
+// the primary key, running the queries concurrently over the connections in
+// the pool, and returns the hash of each column as a keyed output. Without a
+// primary key, each column is hashed in any order instead.
+func (c Config) runColumnTests(ctx context.Context, pool *connPool, schemaName, tableName string, columns []column, predicates []string, noPrimaryKey bool) (string, error) {
+	var primaryKeyColumns []column
+
+	for _, col := range columns {
+		if col.IsPrimaryKey() {
+			primaryKeyColumns = append(primaryKeyColumns, col)
+		}
+	}
+
+	var (
+		mutex  sync.Mutex
+		hashes = make(map[string]string)
+		errs   []error
+		wg     sync.WaitGroup
+	)
+
+	for _, col := range columns {
+		query := buildUnorderedHashQuery(c, schemaName, tableName, []column{col}, predicates)
+		if !noPrimaryKey {
+			hashedColumns := primaryKeyColumns
+			if !col.IsPrimaryKey() {
+				hashedColumns = append([]column{col}, primaryKeyColumns...)
+			}
+
+			query = buildFullHashQuery(c, schemaName, tableName, hashedColumns, predicates)
+		}
+
+		wg.Add(1)
+
+		go func(name, query string) {
+			defer wg.Done()
+
+			output, err := c.runPooledTest(ctx, pool, query)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if err != nil {
+				errs = append(errs, errors.Wrapf(err, "column %s", name))
+
+				return
+			}
+
+			hashes[strconv.Quote(name)] = output
+		}(col.name, query)
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return "", multierr.Combine(errs...)
+	}
+
+	return formatKeyedOutput(hashes), nil
+}
+
+// runPooledTest runs the test query on a connection from the pool.
+func (c Config) runPooledTest(ctx context.Context, pool *connPool, query string) (output string, err error) {
+	conn, err := pool.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer pool.release(conn)
+
+	err = c.withSavepoint(ctx, conn, func() (err error) {
+		output, err = runTestOnTable(ctx, conn, fullTestMode{}, query)
+
+		return err
+	})
+
+	return output, err
+}
+
+// runBatchedTableTests sends the test queries in batches of QueryBatchSize,
+// reducing the number of network round trips, and records the outputs. Since
+// a batch runs in an implicit transaction, a failed query also fails the
+// queries after it in the same batch. The time taken by each query is
+// approximated by the time waited for its result.
+func (c Config) runBatchedTableTests(ctx context.Context, logger *logrus.Entry, conn *pgx.Conn, tests []tableTest, result *targetResult) {
+	for start := 0; start < len(tests); start += c.QueryBatchSize {
+		end := start + c.QueryBatchSize
+		if end > len(tests) {
+			end = len(tests)
+		}
+
+		batch := &pgx.Batch{}
+
+		for _, test := range tests[start:end] {
+			test.logger.Debugf("Generated query: %s", test.query)
+			batch.Queue(test.query)
+		}
+
+		spanCtx, span := c.startSpan(ctx, SpanTestBatch, map[string]string{
+			"target": tests[start].targetName,
+			"size":   strconv.Itoa(end - start),
+		})
+
+		// A failed query fails the rest of the batch, so the savepoint is
+		// around the whole batch when in a consistent snapshot.
+		err := c.withSavepoint(spanCtx, conn, func() error {
+			lastResult := time.Now()
+			batchResults := conn.SendBatch(spanCtx, batch)
+
+			for _, test := range tests[start:end] {
+				testOutput, err := test.mode.ParseResult(batchResults.QueryRow())
+				if err != nil {
+					err = wrapQueryError(err, test.query)
+				}
+
+				elapsed := time.Since(lastResult)
+				lastResult = time.Now()
+				c.finishTest(test, testOutput, elapsed, err)
+
+				if err != nil {
+					result.hashes[test.schemaName][test.tableName][test.testMode] = errorOutput(err)
+
+					continue
+				}
+
+				result.addElapsed(test.schemaName, test.tableName, elapsed)
+				result.hashes[test.schemaName][test.tableName][test.testMode] = testOutput
+			}
+
+			return batchResults.Close()
+		})
+		if err != nil {
+			logger.WithError(err).Error("Failed to close batch results")
+		}
+
+		span.End(err)
+	}
+}
+
+func runTestOnTable(ctx context.Context, conn *pgx.Conn, mode TestMode, query string) (string, error) {
+	testOutput, err := mode.ParseResult(conn.QueryRow(ctx, query))
+	if err != nil {
+		return "", wrapQueryError(err, query)
+	}
+
+	return testOutput, nil
+}
+
+// wrapQueryError annotates an error from running a query with the query text
+// and, if the error was returned by the server, its SQLSTATE code and detail.
+func wrapQueryError(err error, query string) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return errors.Wrapf(err, "query failed: %s", query)
+	}
+
+	if pgErr.Detail != "" {
+		return errors.Wrapf(err, "query failed with SQLSTATE %s (%s): %s", pgErr.Code, pgErr.Detail, query)
+	}
+
+	return errors.Wrapf(err, "query failed with SQLSTATE %s: %s", pgErr.Code, query)
+}
+
+// The SQLSTATE code of errors raised when a lock cannot be acquired, such as
+// when the lock timeout is exceeded.
+const lockNotAvailableCode = "55P03"
+
+// errorOutput returns the output recorded for a test that failed with the
+// error, distinguishing lock timeouts from other errors.
+func errorOutput(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == lockNotAvailableCode {
+		return lockTimeoutOutput
+	}
+
+	return defaultErrorOutput
+}
+
+// scanTestOutput reads the output of a test query from the returned row.
+func scanTestOutput(row pgx.Row) (string, error) {
+	var testOutput pgtype.Text
+	if err := row.Scan(&testOutput); err != nil {
+		switch err {
+		case pgx.ErrNoRows:
+			// Grouped aggregates over an empty table return no rows.
+			return emptyTableOutput, nil
+		default:
+			return "", errors.Wrap(err, "failed to scan test output")
+		}
+	}
+
+	// Ungrouped aggregates over an empty table return a single NULL, which
+	// must not be confused with a hash of empty content.
+	if testOutput.Status != pgtype.Present {
+		return emptyTableOutput, nil
+	}
+
 	return testOutput.String, nil
 }
@@ -0,0 +1,208 @@
+//nolint:testpackage // unit test for internals, *_test pattern not appropriate
+package pgverify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidColumnTarget(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+
+		config   Config
+		column   column
+		expected bool
+	}{
+		{
+			name:     "no filters",
+			column:   column{name: "content", dataType: "text"},
+			expected: true,
+		},
+		{
+			name:     "excluded name",
+			config:   Config{ExcludeColumns: []string{"content"}},
+			column:   column{name: "content", dataType: "text"},
+			expected: false,
+		},
+		{
+			name:     "not included name",
+			config:   Config{IncludeColumns: []string{"other"}},
+			column:   column{name: "content", dataType: "text"},
+			expected: false,
+		},
+		{
+			name:     "excluded type",
+			config:   Config{ExcludeColumnTypes: []string{"BYTEA"}},
+			column:   column{name: "blob", dataType: "bytea"},
+			expected: false,
+		},
+		{
+			name:     "excluded type alias",
+			config:   Config{ExcludeColumnTypes: []string{"int8"}},
+			column:   column{name: "counter", dataType: "bigint"},
+			expected: false,
+		},
+		{
+			name:     "excluded type overrides included name",
+			config:   Config{IncludeColumns: []string{"blob"}, ExcludeColumnTypes: []string{"bytea"}},
+			column:   column{name: "blob", dataType: "bytea"},
+			expected: false,
+		},
+		{
+			name:     "primary key not included",
+			config:   Config{IncludeColumns: []string{"content"}},
+			column:   column{name: "id", dataType: "bigint", constraints: []string{"PRIMARY KEY"}},
+			expected: true,
+		},
+		{
+			name:     "primary key excluded type",
+			config:   Config{ExcludeColumnTypes: []string{"bigint"}},
+			column:   column{name: "id", dataType: "bigint", constraints: []string{"PRIMARY KEY"}},
+			expected: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.config.validColumnTarget(tc.column))
+		})
+	}
+}
+
+func TestTargetNames(t *testing.T) {
+	targets := []*pgx.ConnConfig{}
+
+	for _, uri := range []string{
+		"postgres://user@localhost:5432/prod",
+		"postgres://user@localhost:5433/prod_dr",
+		"postgres://root@remote:26257/prod",
+	} {
+		target, err := pgx.ParseConfig(uri)
+		require.NoError(t, err)
+
+		targets = append(targets, target)
+	}
+
+	require.Equal(t,
+		[]string{"user@localhost:5432/prod", "user@localhost:5433/prod_dr", "root@remote:26257/prod"},
+		Config{}.targetNames(targets),
+	)
+	require.Equal(t,
+		[]string{"primary", "user@localhost:5433/prod_dr", "root@remote:26257/prod"},
+		Config{Aliases: []string{"primary", ""}}.targetNames(targets),
+	)
+}
+
+func TestWrapQueryError(t *testing.T) {
+	query := "SELECT 1"
+
+	err := wrapQueryError(&pgconn.PgError{Code: "42P01", Message: "relation does not exist", Detail: "some detail"}, query)
+	require.Contains(t, err.Error(), "SQLSTATE 42P01 (some detail): SELECT 1")
+
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+
+	err = wrapQueryError(pgx.ErrTxClosed, query)
+	require.Contains(t, err.Error(), "query failed: SELECT 1")
+}
+
+func TestErrorOutput(t *testing.T) {
+	lockErr := wrapQueryError(&pgconn.PgError{Code: lockNotAvailableCode, Message: "canceling statement due to lock timeout"}, "SELECT 1")
+	require.Equal(t, lockTimeoutOutput, errorOutput(lockErr))
+	require.Equal(t, defaultErrorOutput, errorOutput(wrapQueryError(&pgconn.PgError{Code: "42P01"}, "SELECT 1")))
+	require.Equal(t, defaultErrorOutput, errorOutput(pgx.ErrNoRows))
+
+	results := NewResults([]string{"a", "b"}, []string{TestModeFull})
+	results.AddResult("a", SingleResult{"public": {"users": {TestModeFull: lockTimeoutOutput}}})
+	results.AddResult("b", SingleResult{"public": {"users": {TestModeFull: lockTimeoutOutput}}})
+	require.Equal(t, []string{"public.users test full has lock timeout output"}, errorStrings(results.CheckForErrors()))
+}
+
+func errorStrings(errs []error) []string {
+	strs := make([]string, len(errs))
+	for i, err := range errs {
+		strs[i] = err.Error()
+	}
+
+	return strs
+}
+
+type recordingTracer struct {
+	spans []string
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string, _ map[string]string) (context.Context, Span) {
+	r.spans = append(r.spans, name)
+
+	return ctx, noopSpan{}
+}
+
+func TestStartSpan(t *testing.T) {
+	ctx := context.Background()
+
+	_, span := Config{}.startSpan(ctx, SpanConnect, nil)
+	require.Equal(t, noopSpan{}, span)
+
+	tracer := &recordingTracer{}
+	_, span = NewConfig(WithTracer(tracer)).startSpan(ctx, SpanTestQuery, map[string]string{"mode": TestModeFull})
+	span.End(nil)
+	require.Equal(t, []string{SpanTestQuery}, tracer.spans)
+}
+
+func TestTableCallback(t *testing.T) {
+	var verifications []TableVerification
+
+	c := NewConfig(WithTableCallback(func(verification TableVerification) {
+		verifications = append(verifications, verification)
+	}))
+	test := tableTest{
+		schemaName: "public",
+		tableName:  "users",
+		targetName: "a",
+		engine:     "PostgreSQL 14.5",
+		testMode:   TestModeFull,
+		columns:    []string{"id", "name"},
+		query:      "SELECT 1",
+		logger:     c.Logger.WithField("target", "a"),
+	}
+
+	c.finishTest(test, "abc", time.Second, nil)
+
+	lockErr := &pgconn.PgError{Code: lockNotAvailableCode}
+	c.finishTest(test, "", time.Second, lockErr)
+
+	require.Equal(t, []TableVerification{
+		{Target: "a", Engine: "PostgreSQL 14.5", Schema: "public", Table: "users", TestMode: TestModeFull, Columns: []string{"id", "name"}, Query: "SELECT 1", Output: "abc", Duration: time.Second},
+		{Target: "a", Engine: "PostgreSQL 14.5", Schema: "public", Table: "users", TestMode: TestModeFull, Columns: []string{"id", "name"}, Query: "SELECT 1", Output: lockTimeoutOutput, Duration: time.Second, Err: lockErr},
+	}, verifications)
+}
+
+func TestBuildBeginAsOfSystemTimeQuery(t *testing.T) {
+	require.Equal(t, "BEGIN AS OF SYSTEM TIME '-10s'", buildBeginAsOfSystemTimeQuery("-10s"))
+	require.Equal(t, "BEGIN AS OF SYSTEM TIME '2024-01-16 19:00:00'' OR 1=1'", buildBeginAsOfSystemTimeQuery("2024-01-16 19:00:00' OR 1=1"))
+}
+
+func TestTargetSchemas(t *testing.T) {
+	c := NewConfig(WithTargetSchema("dr", "app", "app_dr"))
+
+	require.Equal(t, "app_dr", c.physicalSchema("dr", "app"))
+	require.Equal(t, "app", c.physicalSchema("primary", "app"))
+	require.Equal(t, "app", c.comparisonSchema("dr", "app_dr"))
+	require.Equal(t, "other", c.comparisonSchema("dr", "other"))
+	require.Equal(t, []string{"app_dr", "other"}, c.physicalSchemas("dr", []string{"app", "other"}))
+}
+
+func TestVerifyConnectionFailure(t *testing.T) {
+	target, err := pgx.ParseConfig("postgres://user@127.0.0.1:1/db?connect_timeout=1")
+	require.NoError(t, err)
+
+	results, err := NewConfig(WithAliases([]string{"unreachable"})).Verify(context.Background(), []*pgx.ConnConfig{target})
+	require.Error(t, err)
+	require.NotNil(t, results)
+	require.False(t, results.AllConnected())
+	require.Equal(t, "0 of 1 targets connected; 1 failed: unreachable", results.ConnectionSummary())
+}
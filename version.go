@@ -0,0 +1,189 @@
+package pgverify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+// fetchEngineVersion returns the engine and version string reported by the
+// target, e.g. "PostgreSQL 14.5 (Debian 14.5-1) on x86_64-pc-linux-gnu, ...".
+func fetchEngineVersion(ctx context.Context, conn *pgx.Conn) (string, error) {
+	var version string
+	if err := conn.QueryRow(ctx, "SELECT version()").Scan(&version); err != nil {
+		return "", errors.Wrap(err, "failed to query version")
+	}
+
+	return version, nil
+}
+
+// isCockroachDB returns whether the connection is to CockroachDB, which reports
+// its version in the crdb_version parameter when the connection is opened.
+func isCockroachDB(conn *pgx.Conn) bool {
+	return conn.PgConn().ParameterStatus("crdb_version") != ""
+}
+
+// shortVersion trims the build details from a version string, leaving the
+// engine and version, e.g. "PostgreSQL 14.5" or "CockroachDB CCL v23.2.0".
+func shortVersion(version string) string {
+	for _, separator := range []string{" (", " on "} {
+		if i := strings.Index(version, separator); i >= 0 {
+			version = version[:i]
+		}
+	}
+
+	return version
+}
+
+// addVersion records the engine version reported by a target.
+func (r *Results) addVersion(targetName, version string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.versions[targetName] = version
+}
+
+// Versions returns the engine version reported by each target, keyed by
+// target name, for the targets whose version could be queried.
+func (r *Results) Versions() map[string]string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	versions := make(map[string]string, len(r.versions))
+	for targetName, version := range r.versions {
+		versions[targetName] = version
+	}
+
+	return versions
+}
+
+// writeVersionsHeader writes a line with the engine and version of each
+// target, in target order, if any were recorded.
+func (r *Results) writeVersionsHeader(writer io.Writer) {
+	versions := r.Versions()
+
+	var engines []string
+
+	for _, targetName := range r.targetNames {
+		if version, ok := versions[targetName]; ok {
+			engines = append(engines, fmt.Sprintf("%s: %s", targetName, shortVersion(version)))
+		}
+	}
+
+	if len(engines) > 0 {
+		fmt.Fprintf(writer, "engines: %s\n", strings.Join(engines, ", "))
+	}
+}
+
+// cockroachVersionPattern matches the major and minor version in the
+// crdb_version parameter, e.g. "CockroachDB CCL v21.2.0 (x86_64-...)".
+var cockroachVersionPattern = regexp.MustCompile(`v(\d+)\.(\d+)`)
+
+// cockroachMinVersions are the oldest CockroachDB versions, as major and minor
+// versions, that each test mode is tested against: the oldest supported
+// version listed in the README, and the oldest image in the integration tests.
+// Older versions are not known to fail, only untested.
+var cockroachMinVersions = map[string][2]int{
+	TestModeBookend: {21, 2},
+	TestModeSparse:  {21, 2},
+}
+
+// parseCockroachVersion returns the major and minor version in a crdb_version
+// parameter, if it can be parsed.
+func parseCockroachVersion(version string) ([2]int, bool) {
+	match := cockroachVersionPattern.FindStringSubmatch(version)
+	if match == nil {
+		return [2]int{}, false
+	}
+
+	major, err := strconv.Atoi(match[1])
+	if err != nil {
+		return [2]int{}, false
+	}
+
+	minor, err := strconv.Atoi(match[2])
+	if err != nil {
+		return [2]int{}, false
+	}
+
+	return [2]int{major, minor}, true
+}
+
+// cockroachCapabilityWarnings returns a warning for each of the test modes
+// that has not been tested against the CockroachDB version, so that failures
+// on the target can be told apart from differences in the data. Versions that
+// cannot be parsed are assumed to be supported.
+func cockroachCapabilityWarnings(testModes []string, crdbVersion string) []string {
+	version, ok := parseCockroachVersion(crdbVersion)
+	if !ok {
+		return nil
+	}
+
+	var warnings []string
+
+	for _, testMode := range testModes {
+		minVersion, ok := cockroachMinVersions[testMode]
+		if !ok {
+			continue
+		}
+
+		if version[0] < minVersion[0] || (version[0] == minVersion[0] && version[1] < minVersion[1]) {
+			warnings = append(warnings, fmt.Sprintf("%s test mode is untested on CockroachDB < v%d.%d (target is v%d.%d); its queries may fail",
+				testMode, minVersion[0], minVersion[1], version[0], version[1]))
+		}
+	}
+
+	return warnings
+}
+
+// engineName returns the engine and version of the target from the parameters
+// reported when the connection was opened, e.g. "PostgreSQL 14.5".
+func engineName(conn *pgx.Conn) string {
+	if version := conn.PgConn().ParameterStatus("crdb_version"); version != "" {
+		return shortVersion(version)
+	}
+
+	return "PostgreSQL " + shortVersion(conn.PgConn().ParameterStatus("server_version"))
+}
+
+// matchesEngine returns whether the engine and version, as returned by
+// shortVersion, is the required engine, optionally with a version prefix,
+// ignoring case, e.g. "PostgreSQL 14.5" matches "postgresql" and
+// "PostgreSQL 14", but not "PostgreSQL 1". A required version ending in a dot,
+// e.g. "PostgreSQL 14.", already ends at a version boundary.
+func matchesEngine(engine, required string) bool {
+	engine, required = strings.ToLower(engine), strings.ToLower(strings.TrimSpace(required))
+	if !strings.HasPrefix(engine, required) {
+		return false
+	}
+
+	return len(engine) == len(required) || strings.HasSuffix(required, ".") || strings.ContainsAny(engine[len(required):len(required)+1], " .")
+}
+
+// checkRequiredEngine returns an error for each target whose engine could not
+// be detected or is not the required engine.
+func checkRequiredEngine(required string, targetNames []string, versions map[string]string) error {
+	var errs []error
+
+	for _, targetName := range targetNames {
+		version, ok := versions[targetName]
+		if !ok {
+			errs = append(errs, fmt.Errorf("target %s: failed to detect engine, required %s", targetName, required))
+
+			continue
+		}
+
+		if engine := shortVersion(version); !matchesEngine(engine, required) {
+			errs = append(errs, fmt.Errorf("target %s: engine is %s, not the required %s", targetName, engine, required))
+		}
+	}
+
+	return multierr.Combine(errs...)
+}
@@ -0,0 +1,42 @@
+//nolint:testpackage // unit test for internals, *_test pattern not appropriate
+package pgverify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCockroachCapabilityWarnings(t *testing.T) {
+	testModes := []string{TestModeRowCount, TestModeSparse}
+
+	require.Empty(t, cockroachCapabilityWarnings(testModes, "CockroachDB CCL v23.2.0 (x86_64-pc-linux-gnu, built 2024/01/16 19:28:40, go1.21.5)"))
+	require.Empty(t, cockroachCapabilityWarnings(testModes, "CockroachDB CCL v21.2.12"))
+	require.Empty(t, cockroachCapabilityWarnings([]string{TestModeRowCount}, "CockroachDB CCL v20.2.0"))
+	require.Empty(t, cockroachCapabilityWarnings(testModes, "unknown"))
+	require.Equal(t,
+		[]string{"sparse test mode is untested on CockroachDB < v21.2 (target is v20.2); its queries may fail"},
+		cockroachCapabilityWarnings(testModes, "CockroachDB CCL v20.2.0"))
+}
+
+func TestCheckRequiredEngine(t *testing.T) {
+	versions := map[string]string{
+		"a": "PostgreSQL 14.5 (Debian 14.5-1.pgdg110+1) on x86_64-pc-linux-gnu, compiled by gcc, 64-bit",
+		"b": "CockroachDB CCL v23.2.0 (x86_64-pc-linux-gnu, built 2024/01/16 19:28:40, go1.21.5)",
+	}
+
+	require.NoError(t, checkRequiredEngine("postgresql", []string{"a"}, versions))
+	require.NoError(t, checkRequiredEngine("PostgreSQL 14", []string{"a"}, versions))
+	require.Error(t, checkRequiredEngine("PostgreSQL 1", []string{"a"}, versions))
+	require.Error(t, checkRequiredEngine("PostgreSQL 15", []string{"a"}, versions))
+
+	err := checkRequiredEngine("PostgreSQL", []string{"a", "b", "c"}, versions)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "target b: engine is CockroachDB CCL v23.2.0, not the required PostgreSQL")
+	require.Contains(t, err.Error(), "target c: failed to detect engine")
+	require.NotContains(t, err.Error(), "target a")
+
+	require.NoError(t, checkRequiredEngine("PostgreSQL 14.", []string{"a"}, versions))
+	require.NoError(t, checkRequiredEngine("PostgreSQL ", []string{"a"}, versions))
+	require.Error(t, checkRequiredEngine("PostgreSQL 14.4", []string{"a"}, versions))
+}
@@ -0,0 +1,78 @@
+package pgverify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// WatchFunc is called with the results and error of each verification run
+// performed by Watch.
+type WatchFunc func(results *Results, err error)
+
+// Watch repeatedly runs all verification tests against the targets, waiting
+// for the interval between the end of one run and the start of the next, and
+// invokes the callback with the outcome of each run. It blocks until the
+// context is canceled, returning the context's error.
+func (c Config) Watch(ctx context.Context, targets []*pgx.ConnConfig, interval time.Duration, callback WatchFunc) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	if interval <= 0 {
+		return fmt.Errorf("invalid watch interval %s, must be positive", interval)
+	}
+
+	for {
+		results, err := c.Verify(ctx, targets)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		callback(results, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// DiffFailingTables compares the failing tables of two verification runs,
+// returning the tables that fail in the current run but did not in the
+// previous one, and the tables that failed in the previous run but no longer
+// do. Either set of results may be nil, which is treated as no failures.
+func DiffFailingTables(previous, current *Results) (newlyFailing, newlyPassing []string) {
+	previousFailing := make(map[string]bool)
+	currentFailing := make(map[string]bool)
+
+	if previous != nil {
+		for _, table := range previous.FailingTables() {
+			previousFailing[table] = true
+		}
+	}
+
+	if current != nil {
+		for _, table := range current.FailingTables() {
+			currentFailing[table] = true
+
+			if !previousFailing[table] {
+				newlyFailing = append(newlyFailing, table)
+			}
+		}
+	}
+
+	for table := range previousFailing {
+		if !currentFailing[table] {
+			newlyPassing = append(newlyPassing, table)
+		}
+	}
+
+	sort.Strings(newlyPassing)
+
+	return newlyFailing, newlyPassing
+}